@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"image/color"
+	"math"
+)
+
+// Annotations point things out on top of the data of any plotter. "Annotations" is a
+// list of objects, each one picks what it draws with "Type":
+//
+//	{"Type": "hline", "Y": 250, "Label": "SLO"}               horizontal reference line
+//	{"Type": "vline", "X": 12, "Label": "deploy"}             vertical reference line
+//	{"Type": "xrange", "From": 3, "To": 5, "Label": "outage"} shaded range of X
+//	{"Type": "yrange", "From": 100, "To": 200}                shaded range of Y
+//	{"Type": "text", "X": 4, "Y": 310, "Text": "spike"}       text at the point
+//	{"Type": "arrow", "X": 4, "Y": 310, "Text": "spike"}      arrow pointing to the point,
+//	                                                          with "DX" and "DY" placing its
+//	                                                          tail in points, 30 and 30 by
+//	                                                          default
+//
+// X values follow the X axis so they can be timestamps. Every annotation takes a
+// "Color", which can be an index into the palette of the chart, lines and arrows take
+// "Width" and "Dashes" in points as well
+
+var (
+	kAnnotationColor = color.RGBA{R: 200, G: 30, B: 30, A: 255}
+	kAnnotationFill  = color.NRGBA{R: 200, G: 30, B: 30, A: 48}
+)
+
+// parseAnnotations creates the plotters of the annotations, X values are converted
+// by xconv
+func parseAnnotations(v Value, xconv func(Value) (float64, error), palette []color.Color) ([]plot.Plotter, error) {
+	if v.Type != kValueTypeList {
+		return nil, fmt.Errorf("value must be a list but got type %s", v.Type.GetName())
+	}
+
+	ret := []plot.Plotter{}
+	for idx, x := range v.List.Value {
+		p, err := parseAnnotation(x, xconv, palette)
+		if err != nil {
+			return nil, fmt.Errorf("annotation %d,%v", idx, err)
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+func parseAnnotation(v Value, xconv func(Value) (float64, error), palette []color.Color) (plot.Plotter, error) {
+	if v.Type != kValueTypeObject {
+		return nil, fmt.Errorf("annotation must be an object but got type %s", v.Type.GetName())
+	}
+
+	var kind string
+	if t, err := JsonObjectGetMultipleKey(v, "Type", "type"); err != nil {
+		return nil, err
+	} else {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Type\" field is not a string")
+		} else {
+			kind = val
+		}
+	}
+
+	text := ""
+	if t, err := JsonObjectGetMultipleKey(v, "Text", "text", "Label", "label"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Text\" field is not a string")
+		} else {
+			text = val
+		}
+	}
+
+	number := func(keys ...string) (float64, error) {
+		t, err := JsonObjectGetMultipleKey(v, keys...)
+		if err != nil {
+			return 0, err
+		}
+		val, err := JsonGetNumber(t)
+		if err != nil {
+			return 0, fmt.Errorf("\"%s\" field is not a number", keys[0])
+		}
+		return val, nil
+	}
+
+	xvalue := func(keys ...string) (float64, error) {
+		t, err := JsonObjectGetMultipleKey(v, keys...)
+		if err != nil {
+			return 0, err
+		}
+		val, err := xconv(t)
+		if err != nil {
+			return 0, fmt.Errorf("\"%s\" field is invalid, %v", keys[0], err)
+		}
+		return val, nil
+	}
+
+	switch kind {
+	case "hline", "vline":
+		sty, err := parseAnnotationLine(v, kAnnotationColor, palette)
+		if err != nil {
+			return nil, err
+		}
+		if kind == "hline" {
+			y, err := number("Y", "y")
+			if err != nil {
+				return nil, err
+			}
+			return &hLine{Y: y, Label: text, LineStyle: sty}, nil
+		}
+		x, err := xvalue("X", "x")
+		if err != nil {
+			return nil, err
+		}
+		return &vLine{X: x, Label: text, LineStyle: sty}, nil
+
+	case "xrange", "yrange":
+		b := &band{Vertical: kind == "xrange", Label: text, Color: kAnnotationFill}
+		var err error
+		if b.Vertical {
+			if b.From, err = xvalue("From", "from"); err != nil {
+				return nil, err
+			}
+			if b.To, err = xvalue("To", "to"); err != nil {
+				return nil, err
+			}
+		} else {
+			if b.From, err = number("From", "from"); err != nil {
+				return nil, err
+			}
+			if b.To, err = number("To", "to"); err != nil {
+				return nil, err
+			}
+		}
+		if b.From > b.To {
+			b.From, b.To = b.To, b.From
+		}
+		if b.Color, err = parseAnnotationColor(v, kAnnotationFill, palette); err != nil {
+			return nil, err
+		}
+		return b, nil
+
+	case "text", "arrow":
+		x, err := xvalue("X", "x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := number("Y", "y")
+		if err != nil {
+			return nil, err
+		}
+		if kind == "text" {
+			clr, err := parseAnnotationColor(v, color.Black, palette)
+			if err != nil {
+				return nil, err
+			}
+			return &textLabel{X: x, Y: y, Text: text, Color: clr}, nil
+		}
+
+		sty, err := parseAnnotationLine(v, color.Black, palette)
+		if err != nil {
+			return nil, err
+		}
+		a := &arrow{X: x, Y: y, DX: vg.Points(30), DY: vg.Points(30), Text: text, LineStyle: sty}
+		for _, opt := range []struct {
+			keys []string
+			ptr  *vg.Length
+		}{
+			{[]string{"DX", "dx"}, &a.DX},
+			{[]string{"DY", "dy"}, &a.DY},
+		} {
+			if t, err := JsonObjectGetMultipleKey(v, opt.keys...); err == nil {
+				if val, err := JsonGetNumber(t); err != nil {
+					return nil, fmt.Errorf("\"%s\" field is not a number", opt.keys[0])
+				} else {
+					*opt.ptr = vg.Points(val)
+				}
+			}
+		}
+		return a, nil
+
+	default:
+		return nil, fmt.Errorf("annotation %s is unknown, must be hline, vline, xrange, yrange, text or arrow", kind)
+	}
+}
+
+func parseAnnotationColor(v Value, def color.Color, palette []color.Color) (color.Color, error) {
+	if t, err := JsonObjectGetMultipleKey(v, "Color", "color"); err == nil {
+		if clr, err := JsonToColor(t, palette); err != nil {
+			return nil, fmt.Errorf("\"Color\" field is invalid, %v", err)
+		} else {
+			return clr, nil
+		}
+	}
+	return def, nil
+}
+
+// parseAnnotationLine reads the style of a line, dashed by default
+func parseAnnotationLine(v Value, def color.Color, palette []color.Color) (draw.LineStyle, error) {
+	return JsonObjectToLineStyle(v, draw.LineStyle{
+		Color:  def,
+		Width:  vg.Points(1),
+		Dashes: []vg.Length{vg.Points(4), vg.Points(2)},
+	}, palette)
+}
+
+// band shades the range between From and To across the whole data area, a vertical
+// band covers a range of X
+type band struct {
+	Vertical bool
+	From     float64
+	To       float64
+	Label    string
+	Color    color.Color
+}
+
+func (b *band) Plot(c draw.Canvas, plt *plot.Plot) {
+	trX, trY := plt.Transforms(&c)
+
+	min, max := c.Min, c.Max
+	if b.Vertical {
+		min.X = vg.Length(math.Max(float64(trX(b.From)), float64(c.Min.X)))
+		max.X = vg.Length(math.Min(float64(trX(b.To)), float64(c.Max.X)))
+	} else {
+		min.Y = vg.Length(math.Max(float64(trY(b.From)), float64(c.Min.Y)))
+		max.Y = vg.Length(math.Min(float64(trY(b.To)), float64(c.Max.Y)))
+	}
+	if min.X >= max.X || min.Y >= max.Y {
+		return
+	}
+
+	c.FillPolygon(b.Color, []vg.Point{min, {X: max.X, Y: min.Y}, max, {X: min.X, Y: max.Y}})
+
+	if b.Label != "" {
+		// the fill is translucent, the label uses the same color but opaque
+		clr := color.NRGBAModel.Convert(b.Color).(color.NRGBA)
+		clr.A = 255
+		sty := overlayTextStyle(plt, clr)
+		sty.XAlign = draw.XLeft
+		sty.YAlign = draw.YTop
+		c.FillText(sty, vg.Point{X: min.X + vg.Points(2), Y: max.Y - vg.Points(2)}, b.Label)
+	}
+}
+
+// DataRange only covers the shaded axis
+func (b *band) DataRange() (xmin, xmax, ymin, ymax float64) {
+	if b.Vertical {
+		return b.From, b.To, math.Inf(1), math.Inf(-1)
+	}
+	return math.Inf(1), math.Inf(-1), b.From, b.To
+}
+
+func (b *band) Texts() []string { return []string{b.Label} }
+
+// textLabel writes the text with its left edge at the point
+type textLabel struct {
+	X, Y  float64
+	Text  string
+	Color color.Color
+}
+
+func (t *textLabel) Plot(c draw.Canvas, plt *plot.Plot) {
+	trX, trY := plt.Transforms(&c)
+	pt := vg.Point{X: trX(t.X), Y: trY(t.Y)}
+	if !c.Contains(pt) {
+		return
+	}
+	sty := overlayTextStyle(plt, t.Color)
+	sty.YAlign = draw.YCenter
+	c.FillText(sty, pt, t.Text)
+}
+
+func (t *textLabel) DataRange() (xmin, xmax, ymin, ymax float64) {
+	return t.X, t.X, t.Y, t.Y
+}
+
+func (t *textLabel) Texts() []string { return []string{t.Text} }
+
+// arrow points to the point from its tail, which is DX and DY away from it on the
+// canvas. The text is written at the tail
+type arrow struct {
+	X, Y   float64
+	DX, DY vg.Length
+	Text   string
+	draw.LineStyle
+}
+
+func (a *arrow) Plot(c draw.Canvas, plt *plot.Plot) {
+	trX, trY := plt.Transforms(&c)
+	head := vg.Point{X: trX(a.X), Y: trY(a.Y)}
+	if !c.Contains(head) {
+		return
+	}
+	tail := vg.Point{X: head.X + a.DX, Y: head.Y + a.DY}
+
+	c.StrokeLine2(a.LineStyle, tail.X, tail.Y, head.X, head.Y)
+
+	// the shaft keeps the dashes, the head is always solid
+	solid := a.LineStyle
+	solid.Dashes = nil
+
+	angle := math.Atan2(float64(a.DY), float64(a.DX))
+	size := float64(vg.Points(6))
+	for _, side := range []float64{-math.Pi / 6, math.Pi / 6} {
+		c.StrokeLine2(solid, head.X, head.Y,
+			head.X+vg.Length(size*math.Cos(angle+side)),
+			head.Y+vg.Length(size*math.Sin(angle+side)))
+	}
+
+	if a.Text != "" {
+		sty := overlayTextStyle(plt, a.Color)
+		sty.XAlign = draw.XCenter
+		sty.YAlign = draw.YBottom
+		if a.DY < 0 {
+			sty.YAlign = draw.YTop
+		}
+		c.FillText(sty, tail, a.Text)
+	}
+}
+
+func (a *arrow) DataRange() (xmin, xmax, ymin, ymax float64) {
+	return a.X, a.X, a.Y, a.Y
+}
+
+func (a *arrow) Texts() []string { return []string{a.Text} }
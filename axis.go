@@ -0,0 +1,443 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AxisConfig is the "XAxis"/"YAxis" block understood by every plotter. It is parsed
+// once when the chart is created and applied to the axis after the plotter has put
+// all its data on the chart, so it overrides whatever range the data gives
+type AxisConfig struct {
+	HasMin bool
+	Min    float64
+	HasMax bool
+	Max    float64
+
+	// "linear", "log" or "symlog"
+	Scale string
+
+	// the linear range around zero of a symlog scale
+	Threshold float64
+
+	// either a number of ticks or an explicit list of them
+	TickCount int
+	Ticks     []plot.Tick
+
+	// printf style format or "si" for SI prefixes, a Go time layout for time axis
+	Format string
+	Invert bool
+
+	// not nil when the values on this axis are timestamps
+	Time *TimeAxis
+}
+
+func ParseAxisConfig(v Value) (*AxisConfig, error) {
+	if v.Type != kValueTypeObject {
+		return nil, fmt.Errorf("value is not type object but type %s", v.Type.GetName())
+	}
+
+	axis := &AxisConfig{
+		Scale:     "linear",
+		Threshold: 1,
+	}
+
+	if ta, err := parseTimeAxis(v); err != nil {
+		return nil, err
+	} else {
+		axis.Time = ta
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Min", "min"); err == nil {
+		if val, err := axis.ParseValue(t); err != nil {
+			return nil, fmt.Errorf("\"Min\" field is invalid, %v", err)
+		} else {
+			axis.HasMin = true
+			axis.Min = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Max", "max"); err == nil {
+		if val, err := axis.ParseValue(t); err != nil {
+			return nil, fmt.Errorf("\"Max\" field is invalid, %v", err)
+		} else {
+			axis.HasMax = true
+			axis.Max = val
+		}
+	}
+
+	if axis.HasMin && axis.HasMax && axis.Min >= axis.Max {
+		return nil, fmt.Errorf("\"Min\" %v must be smaller than \"Max\" %v", axis.Min, axis.Max)
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Scale", "scale"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Scale\" field is not a string")
+		} else {
+			switch val {
+			case "linear":
+				axis.Scale = val
+			case "log", "symlog":
+				if axis.Time != nil {
+					return nil, fmt.Errorf("\"Scale\" %s cannot be used by a time axis", val)
+				}
+				axis.Scale = val
+			default:
+				return nil, fmt.Errorf("\"Scale\" %s is unknown, must be linear, log or symlog", val)
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Threshold", "threshold"); err == nil {
+		if val, err := JsonGetNumber(t); err != nil || val <= 0 {
+			return nil, fmt.Errorf("\"Threshold\" field must be a positive number")
+		} else {
+			axis.Threshold = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Format", "format"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Format\" field is not a string")
+		} else {
+			if axis.Time == nil && val != "si" {
+				if err := checkNumberFormat(val); err != nil {
+					return nil, fmt.Errorf("\"Format\" %s %v", val, err)
+				}
+			}
+			axis.Format = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Invert", "invert"); err == nil {
+		if val, err := JsonGetBoolean(t); err != nil {
+			return nil, fmt.Errorf("\"Invert\" field is not a boolean")
+		} else {
+			axis.Invert = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Ticks", "ticks"); err == nil {
+		switch t.Type {
+		case kValueTypeNumber:
+			if t.Number < 2 {
+				return nil, fmt.Errorf("\"Ticks\" needs at least 2 ticks but got %v", t.Number)
+			}
+			axis.TickCount = int(t.Number)
+
+		case kValueTypeList:
+			for idx, x := range t.List.Value {
+				if tick, err := axis.parseTick(x); err != nil {
+					return nil, fmt.Errorf("\"Ticks\" index %d, %v", idx, err)
+				} else {
+					axis.Ticks = append(axis.Ticks, tick)
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("\"Ticks\" field must be a number or a list but got type %s", t.Type.GetName())
+		}
+	}
+
+	return axis, nil
+}
+
+// checkNumberFormat makes sure the printf format takes exactly one number, which is
+// found by formatting one
+func checkNumberFormat(format string) error {
+	if !strings.Contains(format, "%") {
+		return fmt.Errorf("must be a printf format or \"si\"")
+	}
+	if out := fmt.Sprintf(format, 1.5); strings.Contains(out, "%!") {
+		return fmt.Errorf("must have one verb for a number, ie %%.2f, %%g or %%e, but formats 1.5 as %s", out)
+	}
+	return nil
+}
+
+// ParseValue reads a value living on this axis, which is a timestamp for time axis
+// and a number otherwise
+func (a *AxisConfig) ParseValue(v Value) (float64, error) {
+	if a.Time != nil {
+		return a.Time.Parse(v)
+	}
+	return JsonGetNumber(v)
+}
+
+// a tick is either a value or an object with "Value" and an optional "Label"
+func (a *AxisConfig) parseTick(v Value) (plot.Tick, error) {
+	if v.Type != kValueTypeObject {
+		if val, err := a.ParseValue(v); err != nil {
+			return plot.Tick{}, err
+		} else {
+			return plot.Tick{Value: val}, nil
+		}
+	}
+
+	tick := plot.Tick{}
+	if t, err := JsonObjectGetMultipleKey(v, "Value", "value"); err != nil {
+		return plot.Tick{}, err
+	} else {
+		if val, err := a.ParseValue(t); err != nil {
+			return plot.Tick{}, fmt.Errorf("tick \"Value\" field is invalid, %v", err)
+		} else {
+			tick.Value = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Label", "label"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return plot.Tick{}, fmt.Errorf("tick \"Label\" field is not a string")
+		} else {
+			tick.Label = val
+		}
+	}
+	return tick, nil
+}
+
+// Apply the config onto the axis. It fails when the range of the axis cannot be
+// drawn with the scale, ie a log scale over non positive numbers
+func (a *AxisConfig) Apply(axis *plot.Axis) error {
+	if a.HasMin {
+		axis.Min = a.Min
+	}
+	if a.HasMax {
+		axis.Max = a.Max
+	}
+
+	// a constant series, or a single bound past the data, leaves an empty range which
+	// is padded around what is there. "Min" above "Max" is refused when parsing
+	if axis.Min >= axis.Max {
+		switch {
+		case a.HasMin && !a.HasMax:
+			axis.Max = axis.Min + math.Max(1, math.Abs(axis.Min))
+		case a.HasMax && !a.HasMin:
+			axis.Min = axis.Max - math.Max(1, math.Abs(axis.Max))
+		case a.Scale == "log" && axis.Min > 0:
+			axis.Min, axis.Max = axis.Min/10, axis.Max*10
+		default:
+			axis.Min, axis.Max = axis.Min-1, axis.Max+1
+		}
+	}
+
+	// the ticks of the plotter, ie the names of the groups of a bar chart, are only
+	// replaced when the config asks for other ticks
+	ticker := axis.Tick.Marker
+	if ticker == nil {
+		ticker = plot.DefaultTicks{}
+	}
+
+	switch a.Scale {
+	case "log":
+		if axis.Min <= 0 {
+			return fmt.Errorf("log scale needs a positive range but the axis starts at %v, "+
+				"set \"Min\" to a positive number", axis.Min)
+		}
+		axis.Scale = plot.LogScale{}
+		ticker = plot.LogTicks{}
+	case "symlog":
+		axis.Scale = symlogScale{Threshold: a.Threshold}
+		ticker = symlogTicks{Threshold: a.Threshold}
+	default:
+		axis.Scale = plot.LinearScale{}
+	}
+
+	if a.TickCount != 0 {
+		ticker = countTicks{Count: a.TickCount}
+	}
+
+	if a.Time != nil {
+		ticker = calendarTicks{Axis: a.Time, Format: a.Format}
+	}
+
+	if len(a.Ticks) != 0 {
+		ticks := make(plot.ConstantTicks, len(a.Ticks))
+		copy(ticks, a.Ticks)
+		ticker = ticks
+	}
+
+	// the format only relabels the ticks that don't have a label of their own,
+	// calendar ticks are already labeled with it
+	if _, ok := ticker.(calendarTicks); !ok {
+		if a.Format != "" || len(a.Ticks) != 0 {
+			ticker = formatTicks{Ticker: ticker, Format: a.Format, Time: a.Time}
+		}
+	}
+
+	axis.Tick.Marker = ticker
+
+	if a.Invert {
+		axis.Scale = plot.InvertedScale{Normalizer: axis.Scale}
+	}
+	return nil
+}
+
+// symlogScale is linear around zero, within the threshold, and logarithmic outside
+// of it. It handles ranges crossing zero which a log scale cannot
+type symlogScale struct {
+	Threshold float64
+}
+
+func (s symlogScale) transform(x float64) float64 {
+	if x < 0 {
+		return -math.Log10(1 - x/s.Threshold)
+	}
+	return math.Log10(1 + x/s.Threshold)
+}
+
+func (s symlogScale) Normalize(min, max, x float64) float64 {
+	tmin := s.transform(min)
+	tmax := s.transform(max)
+	return (s.transform(x) - tmin) / (tmax - tmin)
+}
+
+// symlogTicks puts a tick at zero and at every power of ten outside the threshold
+type symlogTicks struct {
+	Threshold float64
+}
+
+func (s symlogTicks) Ticks(min, max float64) []plot.Tick {
+	ticks := []plot.Tick{}
+	if min <= 0 && max >= 0 {
+		ticks = append(ticks, plot.Tick{Value: 0, Label: "0"})
+	}
+
+	start := math.Floor(math.Log10(s.Threshold))
+	for e := start; ; e++ {
+		v := math.Pow(10, e)
+		if v > math.Max(math.Abs(min), math.Abs(max)) {
+			break
+		}
+		if v <= max && v >= min {
+			ticks = append(ticks, plot.Tick{Value: v, Label: formatSI(v)})
+		}
+		if -v <= max && -v >= min {
+			ticks = append(ticks, plot.Tick{Value: -v, Label: formatSI(-v)})
+		}
+	}
+	return ticks
+}
+
+// countTicks puts roughly Count ticks at round numbers across the range
+type countTicks struct {
+	Count int
+}
+
+func niceNumber(x float64) float64 {
+	exp := math.Floor(math.Log10(x))
+	f := x / math.Pow(10, exp)
+
+	var nf float64
+	switch {
+	case f <= 1:
+		nf = 1
+	case f <= 2:
+		nf = 2
+	case f <= 5:
+		nf = 5
+	default:
+		nf = 10
+	}
+	return nf * math.Pow(10, exp)
+}
+
+// every tick is counted from the first one instead of adding up the steps, and the
+// labels have as many decimals as the step, so 0.3 is not 0.30000000000000004
+func (c countTicks) Ticks(min, max float64) []plot.Tick {
+	step := niceNumber((max - min) / float64(c.Count-1))
+	decimals := 0
+	if e := -int(math.Floor(math.Log10(step))); e > 0 {
+		decimals = e
+	}
+
+	ticks := []plot.Tick{}
+	start := math.Ceil(min / step)
+	for i := 0.0; ; i++ {
+		v := (start + i) * step
+		if v > max+step*1e-9 {
+			break
+		}
+		// avoid printing things like -0 instead of 0
+		if math.Abs(v) < step*1e-9 {
+			v = 0
+		}
+		ticks = append(ticks, plot.Tick{Value: v, Label: strconv.FormatFloat(v, 'f', decimals, 64)})
+	}
+	return ticks
+}
+
+// formatTicks relabels the major ticks of another ticker. Ticks given with an
+// explicit label by the user keep their label
+type formatTicks struct {
+	Ticker plot.Ticker
+	Format string
+	Time   *TimeAxis
+}
+
+func (f formatTicks) Ticks(min, max float64) []plot.Tick {
+	ticks := f.Ticker.Ticks(min, max)
+	explicit := false
+	if _, ok := f.Ticker.(plot.ConstantTicks); ok {
+		explicit = true
+	}
+
+	for idx, t := range ticks {
+		if explicit && t.Label != "" {
+			continue
+		}
+		if !explicit && t.Label == "" {
+			// minor tick
+			continue
+		}
+		ticks[idx].Label = f.format(t.Value)
+	}
+	return ticks
+}
+
+func (f formatTicks) format(v float64) string {
+	switch {
+	case f.Time != nil && f.Format != "":
+		return f.Time.toTime(v).Format(f.Format)
+	case f.Time != nil:
+		return f.Time.toTime(v).Format("2006-01-02 15:04")
+	case f.Format == "si":
+		return formatSI(v)
+	case f.Format == "":
+		return fmt.Sprintf("%v", v)
+	default:
+		return fmt.Sprintf(f.Format, v)
+	}
+}
+
+// formatSI formats the number with a SI prefix, ie 1500 becomes 1.5k
+func formatSI(v float64) string {
+	prefixes := []struct {
+		scale  float64
+		prefix string
+	}{
+		{1e12, "T"},
+		{1e9, "G"},
+		{1e6, "M"},
+		{1e3, "k"},
+		{1, ""},
+		{1e-3, "m"},
+		{1e-6, "µ"},
+		{1e-9, "n"},
+	}
+
+	if v == 0 {
+		return "0"
+	}
+
+	abs := math.Abs(v)
+	for _, p := range prefixes {
+		if abs >= p.scale {
+			return fmt.Sprintf("%.3g%s", v/p.scale, p.prefix)
+		}
+	}
+
+	last := prefixes[len(prefixes)-1]
+	return fmt.Sprintf("%.3g%s", v/last.scale, last.prefix)
+}
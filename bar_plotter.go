@@ -2,17 +2,31 @@ package main
 
 import (
 	"fmt"
-	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
-	"gonum.org/v1/plot/plotutil"
 	"gonum.org/v1/plot/vg"
+	"image/color"
 )
 
 type barPlotter struct{}
 
 func (b *barPlotter) GetName() string { return "bar-plotter" }
 
-func (bar *barPlotter) Plot(path string, data Value) error {
+func (b *barPlotter) Summary() string {
+	return "draws groups of bars side by side"
+}
+
+func (b *barPlotter) Options() []OptionDoc {
+	return []OptionDoc{
+		{"Title", "string", "Plot", "the title of the chart"},
+		{"Y", "string", "Heights", "the label of the Y axis"},
+		{"Grids", "boolean", "false", "draws grid lines"},
+		{"Size", "number", "4", "the width and the height of the chart in inches"},
+		{"Width", "number", "4", "the width of a bar in points"},
+		{"Group", "object", "", "the groups by name, each one an object with \"Data\" and an optional \"Color\""},
+	}
+}
+
+func (bar *barPlotter) Render(data Value) (*Chart, error) {
 	title := "Plot"
 	ylabel := "Heights"
 	size := 4.0
@@ -49,12 +63,13 @@ func (bar *barPlotter) Plot(path string, data Value) error {
 		}
 	}
 
-	p, err := plot.New()
-	if grids {
-		p.Add(plotter.NewGrid())
-	}
+	chart, err := NewChart(data, size)
 	if err != nil {
-		return fmt.Errorf("\"bar-plotter\" cannot create plot due to reason %v", err)
+		return nil, fmt.Errorf("\"bar-plotter\" cannot create plot due to reason %v", err)
+	}
+	p := chart.Plot
+	if grids {
+		chart.Add(chart.NewGrid())
 	}
 	p.Title.Text = title
 	p.Y.Label.Text = ylabel
@@ -63,34 +78,43 @@ func (bar *barPlotter) Plot(path string, data Value) error {
 	grp, err := JsonObjectGetMultipleKey(data, "Group", "group")
 
 	if err != nil {
-		return fmt.Errorf("\"bar-plotter\" data doesn't have \"group\" field")
+		return nil, fmt.Errorf("\"bar-plotter\" data doesn't have \"group\" field")
 	}
 
 	if grp.Type != kValueTypeObject {
-		return fmt.Errorf("\"bar-plotter\" data field \"group\" must be an object, but got type %s", grp.Type.GetName())
+		return nil, fmt.Errorf("\"bar-plotter\" data field \"group\" must be an object, but got type %s", grp.Type.GetName())
 	}
 
 	sz := vg.Length(size)
 	xlabel := []string{}
 	offset := make([]float64, len(grp.Object.Value))
-	bars := make([]plot.Plotter, len(grp.Object.Value))
 	nums := []*plotter.Values{}
+	colors := []color.Color{}
 
 	// get all the Values from the input data and figure out the maxNum which is how many row will
 	// be showned up in the final generated graph/png
 	maxNum := 0
 	for k, v := range grp.Object.Value {
 		if v.Type != kValueTypeObject {
-			return fmt.Errorf("\"bar-plotter\" group's entry must be an object, but got type %s", v.Type.GetName())
+			return nil, fmt.Errorf("\"bar-plotter\" group's entry must be an object, but got type %s", v.Type.GetName())
 		}
 
 		xlabel = append(xlabel, k)
 
+		// nil takes the color from the palette
+		var clr color.Color
+		if c, err := JsonObjectGetMultipleKey(v, "Color", "color"); err == nil {
+			if clr, err = chart.JsonToColor(c); err != nil {
+				return nil, fmt.Errorf("\"bar-plotter\" group %s's field \"Color\" is invalid, %v", k, err)
+			}
+		}
+		colors = append(colors, clr)
+
 		if v, err := JsonObjectGetMultipleKey(v, "Data", "data"); err != nil {
-			return fmt.Errorf("\"bar-plotter\" each group must have a \"data\" field")
+			return nil, fmt.Errorf("\"bar-plotter\" each group must have a \"data\" field")
 		} else {
 			if val, err := JsonListToVector(v); err != nil {
-				return fmt.Errorf("\"bar-plotter\" each group's field \"Data\" must be a list of numbers")
+				return nil, fmt.Errorf("\"bar-plotter\" each group's field \"Data\" must be a list of numbers, %v", err)
 			} else {
 				nums = append(nums, val)
 				if maxNum < len(*val) {
@@ -127,28 +151,24 @@ func (bar *barPlotter) Plot(path string, data Value) error {
 	for idx, num := range nums {
 		bar, err := plotter.NewBarChart(*num, vg.Length(width))
 		if err != nil {
-			return fmt.Errorf("\"bar-plotter\" cannot create bar with error %v", err)
+			return nil, fmt.Errorf("\"bar-plotter\" cannot create bar with error %v", err)
 		}
 
 		bar.LineStyle.Width = vg.Length(0)
-		bar.Color = plotutil.Color(idx)
+		bar.Color = chart.Color(idx)
+		if colors[idx] != nil {
+			bar.Color = colors[idx]
+		}
 		bar.Offset = vg.Points(offset[idx])
-		bars[idx] = bar
-		idx++
-	}
 
-	p.Add(bars...)
-	{
-		idx := 0
-		for _, x := range xlabel {
-			p.Legend.Add(x, bars[idx].(*plotter.BarChart))
-			idx++
+		pts := make(plotter.XYs, len(*num))
+		for i, x := range *num {
+			pts[i].X = float64(i)
+			pts[i].Y = x
 		}
-
-		// tihs is the best bet for where the legend should show up
-		p.Legend.Top = true
-		p.Legend.Left = true
+		chart.AddSeries(xlabel[idx], bar.Color, pts, bar)
 	}
+
 	// generate X label name
 	{
 		labels := []string{}
@@ -158,12 +178,7 @@ func (bar *barPlotter) Plot(path string, data Value) error {
 		p.NominalX(labels...)
 	}
 
-	if err := p.Save(vg.Inch*sz, vg.Inch*sz, path); err != nil {
-		return fmt.Errorf("\"bar-plotter\" cannot save file to path %s with error %v",
-			path, err)
-	}
-
-	return nil
+	return chart, nil
 }
 
 func init() {
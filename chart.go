@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Chart is what a plotter renders into. It holds the gonum plot together with the
+// size it is supposed to be drawn at and the series that have been put on it, so the
+// same chart can be saved as an image or exported as an interactive html page
+type Chart struct {
+	Plot   *plot.Plot
+	Width  vg.Length
+	Height vg.Length
+	Series []*Series
+
+	// the look of the chart, from "Theme" of the config
+	Theme *Theme
+
+	// the "Legend" block of the config on top of the theme
+	Legend *LegendConfig
+
+	// the "Font" block of the config, nil for the font of the theme
+	Fonts *FontConfig
+
+	// the "XAxis", "YAxis" and "Y2Axis" blocks of the config, nil when not specified
+	XAxis  *AxisConfig
+	YAxis  *AxisConfig
+	Y2Axis *AxisConfig
+
+	// the plot lending its Y axis to the series on the right, nil when there is none
+	Right         *plot.Plot
+	rightPlotters []plot.Plotter
+
+	// a chart with panels is a grid of other charts, its own plot only carries
+	// the title of the whole grid
+	Panels [][]*Chart
+
+	// plotters that are not part of any series, ie grids
+	decorations []plot.Plotter
+
+	// the "Annotations" of the config, they are put on top once the plotter is done
+	annotations []plot.Plotter
+
+	// the coefficients of the fits by series, written into FitOutput when the chart
+	// is saved. FitOutput is empty when they are not asked for
+	FitOutput string
+	Fits      Value
+}
+
+// Series is a named data set shown on a chart. Points is the raw data in data
+// coordinates and it is only used by outputs that expose the values to the reader
+type Series struct {
+	Name     string
+	Color    color.Color
+	Points   plotter.XYs
+	Plotters []plot.Plotter
+
+	// drawn against the Y axis on the right
+	Right bool
+
+	// left out of the legend even though it has a name
+	NoLegend bool
+}
+
+// chartOptionDocs are the options every plotter takes since they are parsed by NewChart
+var chartOptionDocs = []OptionDoc{
+	{"Theme", "string|object", kDefaultTheme, "the name of a theme or a theme object"},
+	{"Palette", "string|list", "", "the colors of the series, the name of a palette or a list of colors"},
+	{"Legend", "boolean|string|object", "", "false hides the legend, a string is its position, an object has the rest of it"},
+	{"Font", "string|list|object", "", "a font, a fallback chain of fonts or an object with one for each kind of text"},
+	{"XAxis", "object", "", "the type, range, scale and ticks of the X axis"},
+	{"YAxis", "object", "", "the type, range, scale and ticks of the Y axis"},
+	{"Y2Axis", "object", "", "the Y axis on the right, used by the series with \"Axis\": \"right\""},
+	{"Annotations", "list", "", "lines, bands, texts and arrows put on top of the data"},
+}
+
+// NewChart creates an empty square chart whose side is size inches. The settings
+// shared by every plotter are parsed from the config here
+func NewChart(data Value, size float64) (*Chart, error) {
+	p, err := plot.New()
+	if err != nil {
+		return nil, err
+	}
+
+	sz := vg.Length(size) * vg.Inch
+	chart := &Chart{
+		Plot:   p,
+		Width:  sz,
+		Height: sz,
+		Theme:  NewTheme(kDefaultTheme),
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Theme", "theme"); err == nil {
+		if chart.Theme, err = ParseTheme(v); err != nil {
+			return nil, fmt.Errorf("\"Theme\" field is invalid, %v", err)
+		}
+	}
+
+	// a palette of the config only replaces the one of the theme for this chart
+	if v, err := JsonObjectGetMultipleKey(data, "Palette", "palette"); err == nil {
+		if palette, err := JsonToPalette(v, chart.Theme.Palette); err != nil {
+			return nil, fmt.Errorf("\"Palette\" field is invalid, %v", err)
+		} else {
+			theme := *chart.Theme
+			theme.Palette = palette
+			chart.Theme = &theme
+		}
+	}
+
+	if err := chart.Theme.Apply(p); err != nil {
+		return nil, err
+	}
+
+	chart.Legend = NewLegendConfig(chart.Theme)
+	if v, err := JsonObjectGetMultipleKey(data, "Legend", "legend"); err == nil {
+		if chart.Legend, err = ParseLegendConfig(v, chart.Theme); err != nil {
+			return nil, fmt.Errorf("\"Legend\" field is invalid, %v", err)
+		}
+	}
+	if chart.Legend.FontSize != 0 {
+		if p.Legend.TextStyle.Font, err = vg.MakeFont(chart.Theme.Font, chart.Legend.FontSize); err != nil {
+			return nil, fmt.Errorf("\"Legend\" font cannot be loaded, %v", err)
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Font", "font"); err == nil {
+		if chart.Fonts, err = ParseFontConfig(v); err != nil {
+			return nil, fmt.Errorf("\"Font\" field is invalid, %v", err)
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "XAxis", "xaxis"); err == nil {
+		if chart.XAxis, err = ParseAxisConfig(v); err != nil {
+			return nil, fmt.Errorf("\"XAxis\" field is invalid, %v", err)
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "YAxis", "yaxis"); err == nil {
+		if chart.YAxis, err = ParseAxisConfig(v); err != nil {
+			return nil, fmt.Errorf("\"YAxis\" field is invalid, %v", err)
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Y2Axis", "y2axis"); err == nil {
+		if chart.Y2Axis, err = ParseAxisConfig(v); err != nil {
+			return nil, fmt.Errorf("\"Y2Axis\" field is invalid, %v", err)
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Annotations", "annotations"); err == nil {
+		if chart.annotations, err = parseAnnotations(v, chart.XValue, chart.Theme.Palette); err != nil {
+			return nil, fmt.Errorf("\"Annotations\" field is invalid, %v", err)
+		}
+	}
+
+	return chart, nil
+}
+
+// Color is the color of the idx-th series in the palette of the theme
+func (c *Chart) Color(idx int) color.Color {
+	return c.Theme.Color(idx)
+}
+
+// JsonToColor reads a color of the config, an index refers to the palette of the chart
+func (c *Chart) JsonToColor(v Value) (color.Color, error) {
+	return JsonToColor(v, c.Theme.Palette)
+}
+
+// NewGrid creates grid lines in the style of the theme
+func (c *Chart) NewGrid() *plotter.Grid {
+	return c.Theme.NewGrid()
+}
+
+// Add puts plotters that don't belong to any series on the chart
+func (c *Chart) Add(ps ...plot.Plotter) {
+	c.decorations = append(c.decorations, ps...)
+	c.Plot.Add(ps...)
+}
+
+// AddSeries puts a named series on the chart. If the name is not empty the plotters
+// that can draw a thumbnail show up in the legend as well
+func (c *Chart) AddSeries(name string, clr color.Color, pts plotter.XYs, ps ...plot.Plotter) *Series {
+	c.Plot.Add(ps...)
+	return c.addSeries(name, clr, pts, ps)
+}
+
+// AddRightSeries is AddSeries for a series drawn against the Y axis on the right
+func (c *Chart) AddRightSeries(name string, clr color.Color, pts plotter.XYs, ps ...plot.Plotter) (*Series, error) {
+	if c.Right == nil {
+		p, err := plot.New()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Theme.Apply(p); err != nil {
+			return nil, err
+		}
+		c.Right = p
+	}
+	c.Right.Add(ps...)
+	c.rightPlotters = append(c.rightPlotters, ps...)
+
+	// the X axis is shared, so the main plot has to cover the series as well
+	for _, x := range ps {
+		if d, ok := x.(plot.DataRanger); ok {
+			xmin, xmax, _, _ := d.DataRange()
+			c.Plot.X.Min = math.Min(c.Plot.X.Min, xmin)
+			c.Plot.X.Max = math.Max(c.Plot.X.Max, xmax)
+		}
+	}
+
+	s := c.addSeries(name, clr, pts, ps)
+	s.Right = true
+	return s, nil
+}
+
+func (c *Chart) addSeries(name string, clr color.Color, pts plotter.XYs, ps []plot.Plotter) *Series {
+	s := &Series{
+		Name:     name,
+		Color:    clr,
+		Points:   pts,
+		Plotters: ps,
+	}
+	c.Series = append(c.Series, s)
+	return s
+}
+
+// Draw the chart onto the canvas
+func (c *Chart) Draw(dc draw.Canvas) {
+	if c.Panels != nil {
+		c.drawPanels(dc)
+	} else if c.Right != nil {
+		c.drawWithLegend(dc, func(dc draw.Canvas) { drawDual(dc, c.Plot, c.Right, c.rightPlotters) })
+	} else {
+		c.drawWithLegend(dc, c.Plot.Draw)
+	}
+}
+
+func (c *Chart) drawPanels(dc draw.Canvas) {
+	if c.Plot.BackgroundColor != nil {
+		dc.SetColor(c.Plot.BackgroundColor)
+		dc.Fill(dc.Rectangle.Path())
+	}
+
+	if c.Plot.Title.Text != "" {
+		dc.FillText(c.Plot.Title.TextStyle, vg.Point{
+			X: dc.Center().X,
+			Y: dc.Max.Y,
+		}, c.Plot.Title.Text)
+		dc.Max.Y -= c.Plot.Title.Height(c.Plot.Title.Text) + c.Plot.Title.Padding
+	}
+
+	rows := len(c.Panels)
+	cols := len(c.Panels[0])
+	tiles := draw.Tiles{
+		Rows:      rows,
+		Cols:      cols,
+		PadTop:    vg.Points(4),
+		PadBottom: vg.Points(4),
+		PadLeft:   vg.Points(4),
+		PadRight:  vg.Points(4),
+		PadX:      vg.Points(8),
+		PadY:      vg.Points(8),
+	}
+
+	// align the data area of every panel when the grid is full, which is what
+	// makes shared axes line up
+	plots := make([][]*plot.Plot, rows)
+	full := true
+	for r, row := range c.Panels {
+		plots[r] = make([]*plot.Plot, cols)
+		for col, panel := range row {
+			if panel == nil || panel.Panels != nil {
+				full = false
+				continue
+			}
+			plots[r][col] = panel.Plot
+		}
+	}
+
+	var canvases [][]draw.Canvas
+	if full {
+		canvases = plot.Align(plots, tiles, dc)
+	}
+
+	for r, row := range c.Panels {
+		for col, panel := range row {
+			if panel == nil {
+				continue
+			}
+			if full {
+				panel.Draw(canvases[r][col])
+			} else {
+				panel.Draw(tiles.At(dc, col, r))
+			}
+		}
+	}
+}
+
+// Save the chart into the file, the format is decided by the extension of the path.
+// The coefficients of the fits go into their own file when they are asked for
+func (c *Chart) Save(path string) error {
+	if err := c.save(path); err != nil {
+		return err
+	}
+	if c.FitOutput != "" {
+		if err := os.WriteFile(c.FitOutput, []byte(c.Fits.ToJson()+"\n"), 0644); err != nil {
+			return fmt.Errorf("cannot write \"FitOutput\" %s, %v", c.FitOutput, err)
+		}
+	}
+	return nil
+}
+
+func (c *Chart) save(path string) error {
+	format := strings.ToLower(filepath.Ext(path))
+	if len(format) != 0 {
+		format = format[1:]
+	}
+
+	switch format {
+	case "html", "htm":
+		return c.saveHtml(path)
+	default:
+		canvas, err := draw.NewFormattedCanvas(c.Width, c.Height, format)
+		if err != nil {
+			return err
+		}
+		c.Draw(draw.New(canvas))
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if _, err := canvas.WriteTo(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// axes are the axes drawn by the chart, the Y axis on the right is the last one
+func (c *Chart) axes() []*plot.Axis {
+	ret := []*plot.Axis{&c.Plot.X, &c.Plot.Y}
+	if c.Right != nil {
+		ret = append(ret, &c.Right.Y)
+	}
+	return ret
+}
+
+// XValue converts a value into the X coordinate, following the type of the X axis
+func (c *Chart) XValue(v Value) (float64, error) {
+	if c.XAxis != nil {
+		return c.XAxis.ParseValue(v)
+	}
+	return JsonGetNumber(v)
+}
+
+// applyAxes puts the axis configs onto the plot, or onto every panel when the chart
+// is a grid
+func (c *Chart) applyAxes(x, y *AxisConfig) error {
+	if c.Panels != nil {
+		for _, row := range c.Panels {
+			for _, panel := range row {
+				if panel == nil {
+					continue
+				}
+				if err := panel.applyAxes(x, y); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if x != nil {
+		if err := x.Apply(&c.Plot.X); err != nil {
+			return fmt.Errorf("\"XAxis\" cannot be applied, %v", err)
+		}
+	}
+	if y != nil {
+		if err := y.Apply(&c.Plot.Y); err != nil {
+			return fmt.Errorf("\"YAxis\" cannot be applied, %v", err)
+		}
+	}
+	if c.Right != nil && c.Y2Axis != nil {
+		if err := c.Y2Axis.Apply(&c.Right.Y); err != nil {
+			return fmt.Errorf("\"Y2Axis\" cannot be applied, %v", err)
+		}
+	}
+	return nil
+}
+
+// RenderChart asks the plotter to render the config into a chart and then applies
+// the settings shared by every plotter
+func RenderChart(plotter Plotter, data Value) (*Chart, error) {
+	chart, err := plotter.Render(data)
+	if err != nil {
+		return nil, err
+	}
+	if chart == nil {
+		return nil, fmt.Errorf("plotter %s doesn't generate any chart", plotter.GetName())
+	}
+
+	if len(chart.annotations) != 0 {
+		// a grid has no data area of its own, the panels are annotated by their configs
+		if chart.Panels != nil {
+			return nil, fmt.Errorf("\"Annotations\" of plotter %s must be put into the config of its panels",
+				plotter.GetName())
+		}
+		chart.Add(chart.annotations...)
+	}
+
+	if err := chart.applyAxes(chart.XAxis, chart.YAxis); err != nil {
+		return nil, err
+	}
+
+	// the fonts are picked for the texts, so they go last
+	if err := chart.applyFonts(); err != nil {
+		return nil, err
+	}
+	return chart, nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// The command line is a command followed by its flags and arguments:
+//
+//	jsonplot render [-input spec.json] [-fonts dir] [-set name=value] [-keep-going] [-report run.json]
+//	jsonplot validate [-input spec.json] [-fonts dir] [-set name=value]
+//	jsonplot list
+//	jsonplot describe <plotter>
+//	jsonplot schema [plotter]
+//	jsonplot fmt [-w] [file ...]
+//
+// render is the default, so flags without a command render like they always did. A
+// spec given as the argument of render and validate is the same as -input
+//
+// Every command exits with one of the exit codes below. render fails when any job
+// fails, it stops at the first one unless -keep-going is given
+
+const (
+	kExitOk = 0
+
+	// a job, a spec or a file failed
+	kExitFailed = 1
+
+	// the command line itself is wrong, ie an unknown command or flag
+	kExitUsage = 2
+)
+
+// command is a subcommand of the command line, run gets the arguments after the name
+// of the command and returns the exit code
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(prog string, args []string) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"render", "[flags] [spec.json]", "renders every job of the spec, the default command", runRender},
+		{"validate", "[flags] [spec.json]", "parses and renders every job of the spec without writing any file", runValidate},
+		{"list", "", "lists the plotters", runList},
+		{"describe", "<plotter>", "prints the options of the plotter with their types and defaults", runDescribe},
+		{"schema", "[plotter]", "prints the json schema of a spec, or of the config of the plotter", runSchema},
+		{"fmt", "[-w] [file ...]", "pretty prints spec files with sorted keys, stdin without files", runFmt},
+	}
+}
+
+func usage(w io.Writer, prog string) {
+	fmt.Fprintf(w, "usage: %s <command> [arguments]\n\ncommands:\n", prog)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", c.name, c.args, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nrun \"%s <command> -h\" for the flags of the command\n", prog)
+}
+
+// runCommand runs the command named by the first argument, flags without a command
+// are the flags of render
+func runCommand(prog string, args []string) int {
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelpFlag(args[0])) {
+		return runRender(prog, args)
+	}
+	if isHelpFlag(args[0]) || args[0] == "help" {
+		usage(os.Stdout, prog)
+		return kExitOk
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(prog, args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "command %s is unknown\n\n", args[0])
+	usage(os.Stderr, prog)
+	return kExitUsage
+}
+
+func isHelpFlag(x string) bool {
+	return x == "-h" || x == "-help" || x == "--help"
+}
+
+// newFlagSet is the flag set of the command, its usage lists the flags
+func newFlagSet(prog, name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s %s %s\n", prog, name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the flags, the exit code is only meaningful when ok is false
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return kExitOk, false
+		}
+		return kExitUsage, false
+	}
+	return kExitOk, true
+}
+
+// parseSpecArgs parses the flags of a command reading a spec, which can be given as
+// the only argument as well
+func parseSpecArgs(fs *flag.FlagSet, args []string) (*specFlags, int, bool) {
+	sf := newSpecFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return nil, code, false
+	}
+
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		sf.input = fs.Arg(0)
+	default:
+		fmt.Fprintf(os.Stderr, "%s takes at most one spec but got %d\n", fs.Name(), fs.NArg())
+		fs.Usage()
+		return nil, kExitUsage, false
+	}
+	return sf, kExitOk, true
+}
+
+func runRender(prog string, args []string) int {
+	fs := newFlagSet(prog, "render", "[flags] [spec.json]")
+	keepGoing := fs.Bool("keep-going", false, "renders the rest of the jobs after one fails, the exit code is still 1")
+	report := fs.String("report", "", "writes the outcome of every job as json into the file")
+	sf, code, ok := parseSpecArgs(fs, args)
+	if !ok {
+		return code
+	}
+
+	var rr *runReport
+	if spec, err := sf.load(); err != nil {
+		rr = &runReport{Err: err}
+	} else {
+		rr = doPlot(spec, *keepGoing)
+	}
+	if rr.Err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", rr.Err)
+	}
+
+	if *report != "" {
+		if err := rr.Save(*report); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return kExitFailed
+		}
+	}
+	if rr.Failed() {
+		return kExitFailed
+	}
+	return kExitOk
+}
+
+func runValidate(prog string, args []string) int {
+	sf, code, ok := parseSpecArgs(newFlagSet(prog, "validate", "[flags] [spec.json]"), args)
+	if !ok {
+		return code
+	}
+
+	spec, err := sf.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return kExitFailed
+	}
+	if doValidate(spec) != 0 {
+		return kExitFailed
+	}
+	return kExitOk
+}
+
+// plotterNames are the names of PlotterFactory, sorted
+func plotterNames() []string {
+	names := []string{}
+	for k := range PlotterFactory {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runList(prog string, args []string) int {
+	fs := newFlagSet(prog, "list", "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return kExitUsage
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, name := range plotterNames() {
+		summary := ""
+		if d, ok := PlotterFactory[name].(Describer); ok {
+			summary = d.Summary()
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, summary)
+	}
+	tw.Flush()
+	return kExitOk
+}
+
+// lookupPlotter finds the plotter named by the argument of describe and schema
+func lookupPlotter(name string) (Describer, error) {
+	p := NewPlotter(name)
+	if p == nil {
+		return nil, fmt.Errorf("plotter %s doesn't support, must be one of %v", name, plotterNames())
+	}
+	d, ok := p.(Describer)
+	if !ok {
+		return nil, fmt.Errorf("plotter %s doesn't describe its options", name)
+	}
+	return d, nil
+}
+
+func printOptions(w io.Writer, docs []OptionDoc) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "  NAME\tTYPE\tDEFAULT\tDESCRIPTION\n")
+	for _, o := range docs {
+		def := o.Default
+		if def == "" {
+			def = "-"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", o.Name, o.Type, def, o.Doc)
+	}
+	tw.Flush()
+}
+
+func runDescribe(prog string, args []string) int {
+	fs := newFlagSet(prog, "describe", "<plotter>")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return kExitUsage
+	}
+
+	d, err := lookupPlotter(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return kExitUsage
+	}
+
+	fmt.Fprintf(os.Stdout, "%s %s\n\noptions:\n", fs.Arg(0), d.Summary())
+	printOptions(os.Stdout, d.Options())
+	fmt.Fprintf(os.Stdout, "\noptions of every chart:\n")
+	printOptions(os.Stdout, chartOptionDocs)
+	return kExitOk
+}
+
+func runSchema(prog string, args []string) int {
+	fs := newFlagSet(prog, "schema", "[plotter]")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	var schema Value
+	switch fs.NArg() {
+	case 0:
+		schema = SpecSchema()
+	case 1:
+		d, err := lookupPlotter(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return kExitUsage
+		}
+		schema = JsonObjectWithKey(configSchema(d), jsonString(kSchemaDraft), "$schema")
+	default:
+		fs.Usage()
+		return kExitUsage
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", schema.ToJson())
+	return kExitOk
+}
+
+func runFmt(prog string, args []string) int {
+	fs := newFlagSet(prog, "fmt", "[-w] [file ...]")
+	write := fs.Bool("w", false, "writes the result back into the file instead of stdout")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if fs.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(os.Stderr, "fmt -w needs files\n")
+			return kExitUsage
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot read stdin with error %v\n", err)
+			return kExitFailed
+		}
+		out, err := doFmt(string(data))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "stdin is not valid json, %v\n", err)
+			return kExitFailed
+		}
+		fmt.Fprint(os.Stdout, out)
+		return kExitOk
+	}
+
+	code := kExitOk
+	for _, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot read %s with error %v\n", path, err)
+			code = kExitFailed
+			continue
+		}
+		out, err := doFmt(string(data))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s is not valid json, %v\n", path, err)
+			code = kExitFailed
+			continue
+		}
+
+		if !*write {
+			fmt.Fprint(os.Stdout, out)
+		} else if out != string(data) {
+			if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "cannot write %s with error %v\n", path, err)
+				code = kExitFailed
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// quiet sends what the commands print to nowhere for the rest of the test
+func quiet(t *testing.T) {
+	t.Helper()
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("%s cannot be opened, %v", os.DevNull, err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = null, null
+	t.Cleanup(func() {
+		os.Stdout, os.Stderr = stdout, stderr
+		null.Close()
+	})
+}
+
+func TestRunCommand(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"good.json":    `[{"Type": "hist-plotter", "Path": "a.png", "Config": {"Data": [1, 2, 2, 3]}}]`,
+		"bad.json":     `[{"Type": "pie-plotter", "Path": "a.png", "Config": {}}]`,
+		"broken.json":  `[{"Type": }]`,
+		"compact.json": `{"b":1,"a":[1,2]}`,
+	})
+	quiet(t)
+
+	for _, c := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"help"}, kExitOk},
+		{[]string{"-h"}, kExitOk},
+		{[]string{"list"}, kExitOk},
+		{[]string{"describe", "hist-plotter"}, kExitOk},
+		{[]string{"schema"}, kExitOk},
+		{[]string{"schema", "dot-plotter"}, kExitOk},
+		{[]string{"validate", filepath.Join(dir, "good.json")}, kExitOk},
+		{[]string{"validate", "-input", filepath.Join(dir, "good.json")}, kExitOk},
+		{[]string{"fmt", filepath.Join(dir, "compact.json")}, kExitOk},
+		{[]string{"render", "-h"}, kExitOk},
+
+		{[]string{"validate", filepath.Join(dir, "bad.json")}, kExitFailed},
+		{[]string{"validate", filepath.Join(dir, "broken.json")}, kExitFailed},
+		{[]string{"validate", filepath.Join(dir, "missing.json")}, kExitFailed},
+		{[]string{"fmt", filepath.Join(dir, "broken.json")}, kExitFailed},
+		{[]string{"fmt", filepath.Join(dir, "missing.json"), filepath.Join(dir, "compact.json")}, kExitFailed},
+
+		{[]string{"draw"}, kExitUsage},
+		{[]string{"render", "-colour"}, kExitUsage},
+		{[]string{"-colour"}, kExitUsage},
+		{[]string{"validate", "a.json", "b.json"}, kExitUsage},
+		{[]string{"validate", "-set", "novalue", "a.json"}, kExitUsage},
+		{[]string{"list", "hist-plotter"}, kExitUsage},
+		{[]string{"describe"}, kExitUsage},
+		{[]string{"describe", "pie-plotter"}, kExitUsage},
+		{[]string{"schema", "pie-plotter"}, kExitUsage},
+		{[]string{"schema", "dot-plotter", "bar-plotter"}, kExitUsage},
+		{[]string{"fmt", "-w"}, kExitUsage},
+	} {
+		if got := runCommand("jsonplot", c.args); got != c.want {
+			t.Errorf("command %v exits with %d, want %d", c.args, got, c.want)
+		}
+	}
+
+	// fmt -w rewrites the file in place
+	compact := filepath.Join(dir, "compact.json")
+	if got := runCommand("jsonplot", []string{"fmt", "-w", compact}); got != kExitOk {
+		t.Errorf("fmt -w exits with %d, want %d", got, kExitOk)
+	}
+	if data, _ := os.ReadFile(compact); string(data) == `{"b":1,"a":[1,2]}` {
+		t.Errorf("fmt -w left %s as it was", compact)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	dir := t.TempDir()
+	job := func(plotter, path string) string {
+		return fmt.Sprintf(`{"Type": %q, "Path": %q, "Config": {"Data": [1, 2, 2, 3]}}`, plotter,
+			filepath.Join(dir, path))
+	}
+	spec := writeTestFile(t, "spec.json", fmt.Sprintf("[%s, %s, %s]", job("hist-plotter", "a.png"),
+		job("pie-plotter", "b.png"), job("hist-plotter", "c.png")))
+	quiet(t)
+
+	for _, c := range []struct {
+		args   []string
+		code   int
+		status []string
+	}{
+		{[]string{spec}, kExitFailed, []string{kJobSucceeded, kJobFailed, kJobSkipped}},
+		{[]string{"-keep-going", spec}, kExitFailed, []string{kJobSucceeded, kJobFailed, kJobSucceeded}},
+	} {
+		report := filepath.Join(dir, "report.json")
+		args := append([]string{"render", "-report", report}, c.args...)
+		if got := runCommand("jsonplot", args); got != c.code {
+			t.Errorf("command %v exits with %d, want %d", args, got, c.code)
+		}
+
+		data, err := os.ReadFile(report)
+		if err != nil {
+			t.Errorf("command %v has no report, %v", args, err)
+			continue
+		}
+		rr, err := NewJsonParser(string(data)).Parse()
+		if err != nil {
+			t.Errorf("command %v has a report of invalid json, %v", args, err)
+			continue
+		}
+
+		for _, k := range []string{"Total", "Succeeded", "Failed", "Skipped", "Error", "Jobs"} {
+			if _, err := JsonObjectGetMultipleKey(rr, k); err != nil {
+				t.Errorf("command %v has a report without %s", args, k)
+			}
+		}
+		jobs, _ := JsonObjectGetMultipleKey(rr, "Jobs")
+		if jobs.Type != kValueTypeList || len(jobs.List.Value) != len(c.status) {
+			t.Errorf("command %v has jobs %s in the report, want %d jobs", args, jobs.ToJson(), len(c.status))
+			continue
+		}
+		for idx, x := range jobs.List.Value {
+			index, _ := JsonGetPath(x, "Index")
+			status, _ := JsonGetPath(x, "Status")
+			size, _ := JsonGetPath(x, "Size")
+			msg, _ := JsonGetPath(x, "Error")
+			if index.Number != float64(idx) || status.String != c.status[idx] {
+				t.Errorf("command %v has job %s in the report, want index %d %s", args, x.ToJson(), idx,
+					c.status[idx])
+			}
+			if (status.String == kJobSucceeded) != (size.Number > 0) ||
+				(status.String == kJobFailed) != (msg.Type == kValueTypeString) {
+				t.Errorf("command %v has job %s in the report with the wrong size or error", args, x.ToJson())
+			}
+		}
+	}
+
+	// the report is written when the spec cannot be read, with the error at the top
+	report := filepath.Join(dir, "broken.json")
+	missing := filepath.Join(dir, "missing.json")
+	if got := runCommand("jsonplot", []string{"-report", report, missing}); got != kExitFailed {
+		t.Errorf("render of a missing spec exits with %d, want %d", got, kExitFailed)
+	}
+	if data, err := os.ReadFile(report); err != nil {
+		t.Errorf("render of a missing spec has no report, %v", err)
+	} else if rr, err := NewJsonParser(string(data)).Parse(); err != nil {
+		t.Errorf("render of a missing spec has a report of invalid json, %v", err)
+	} else if msg, _ := JsonObjectGetMultipleKey(rr, "Error"); msg.Type != kValueTypeString {
+		t.Errorf("render of a missing spec has the error %s in the report, want a message", msg.ToJson())
+	}
+
+	unwritable := filepath.Join(dir, "no", "report.json")
+	if got := runCommand("jsonplot", []string{"-report", unwritable, spec}); got != kExitFailed {
+		t.Errorf("render with a report which cannot be written exits with %d, want %d", got, kExitFailed)
+	}
+}
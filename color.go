@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot/plotutil"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A color can be written in any of these forms wherever a config takes one:
+//
+//   - an object {"R": 255, "G": 128, "B": 0, "A": 255}
+//   - "#rgb", "#rrggbb" or "#rrggbbaa"
+//   - a CSS color name like "steelblue"
+//   - "rgb(255, 128, 0)", "rgba(255, 128, 0, 0.5)", "hsl(210, 60%, 40%)" or
+//     "hsla(210, 60%, 40%, 0.5)"
+//   - a colormap sampled at a point between 0 and 1, ie "viridis(0.3)"
+//   - a number, the index into the palette of the chart
+
+// PaletteFactory has the categorical palettes by lower case name
+var PaletteFactory map[string][]color.Color = make(map[string][]color.Color)
+
+// JsonToColor converts any form of color, palette is what a number indexes into
+func JsonToColor(v Value, palette []color.Color) (color.Color, error) {
+	switch v.Type {
+	case kValueTypeObject:
+		return JsonObjectToColor(v)
+	case kValueTypeString:
+		return ParseColor(v.String)
+	case kValueTypeNumber:
+		if v.Number < 0 || v.Number != math.Floor(v.Number) || len(palette) == 0 {
+			return nil, fmt.Errorf("color %v is not an index into the palette", v.Number)
+		}
+		return palette[int(v.Number)%len(palette)], nil
+	default:
+		return nil, fmt.Errorf("color must be an object, a string or a palette index but got type %s",
+			v.Type.GetName())
+	}
+}
+
+// ParseColor reads a color written as a string
+func ParseColor(text string) (color.Color, error) {
+	s := strings.ToLower(strings.TrimSpace(text))
+
+	if strings.HasPrefix(s, "#") {
+		return parseHexColor(s)
+	}
+
+	if open := strings.Index(s, "("); open > 0 && strings.HasSuffix(s, ")") {
+		name := strings.TrimSpace(s[:open])
+		args := strings.Split(s[open+1:len(s)-1], ",")
+		for idx := range args {
+			args[idx] = strings.TrimSpace(args[idx])
+		}
+
+		switch name {
+		case "rgb", "rgba":
+			return parseRgbColor(text, args)
+		case "hsl", "hsla":
+			return parseHslColor(text, args)
+		}
+
+		if m := NewColormap(name); m != nil {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("color %q must sample the colormap at one point", text)
+			}
+			t, err := strconv.ParseFloat(args[0], 64)
+			if err != nil || t < 0 || t > 1 {
+				return nil, fmt.Errorf("color %q must sample the colormap between 0 and 1", text)
+			}
+			return m.At(t), nil
+		}
+		return nil, fmt.Errorf("color %q is unknown, the function must be rgb, rgba, hsl, hsla or a colormap", text)
+	}
+
+	if clr, ok := cssColors[s]; ok {
+		return clr, nil
+	}
+	return nil, fmt.Errorf("color %q is unknown", text)
+}
+
+func parseHexColor(s string) (color.Color, error) {
+	hex := s[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return nil, fmt.Errorf("color %q must be #rgb, #rrggbb or #rrggbbaa", s)
+	}
+
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("color %q is not hexadecimal", s)
+	}
+	return color.NRGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, nil
+}
+
+// colorArgs reads the arguments of rgb() and hsl(), a percentage is scaled to full,
+// the optional fourth one is the alpha between 0 and 1
+func colorArgs(text string, args []string, full [3]float64) ([3]float64, uint8, error) {
+	var ret [3]float64
+	alpha := uint8(255)
+	if len(args) != 3 && len(args) != 4 {
+		return ret, 0, fmt.Errorf("color %q must have 3 or 4 components", text)
+	}
+
+	for idx, x := range args[:3] {
+		scale := 1.0
+		if strings.HasSuffix(x, "%") {
+			x = strings.TrimSuffix(x, "%")
+			scale = full[idx] / 100
+		}
+		val, err := strconv.ParseFloat(x, 64)
+		if err != nil {
+			return ret, 0, fmt.Errorf("color %q component %d is not a number", text, idx)
+		}
+		ret[idx] = val * scale
+	}
+
+	if len(args) == 4 {
+		a, err := strconv.ParseFloat(args[3], 64)
+		if err != nil || a < 0 || a > 1 {
+			return ret, 0, fmt.Errorf("color %q alpha must be a number between 0 and 1", text)
+		}
+		alpha = uint8(math.Round(a * 255))
+	}
+	return ret, alpha, nil
+}
+
+func parseRgbColor(text string, args []string) (color.Color, error) {
+	c, alpha, err := colorArgs(text, args, [3]float64{255, 255, 255})
+	if err != nil {
+		return nil, err
+	}
+	for idx, x := range c {
+		if x < 0 || x > 255 {
+			return nil, fmt.Errorf("color %q component %d must be between 0 and 255", text, idx)
+		}
+	}
+	return color.NRGBA{R: uint8(math.Round(c[0])), G: uint8(math.Round(c[1])), B: uint8(math.Round(c[2])), A: alpha}, nil
+}
+
+func parseHslColor(text string, args []string) (color.Color, error) {
+	c, alpha, err := colorArgs(text, args, [3]float64{360, 1, 1})
+	if err != nil {
+		return nil, err
+	}
+	h, s, l := math.Mod(c[0], 360), c[1], c[2]
+	if h < 0 {
+		h += 360
+	}
+	if s < 0 || s > 1 || l < 0 || l > 1 {
+		return nil, fmt.Errorf("color %q saturation and lightness must be percentages", text)
+	}
+
+	chroma := (1 - math.Abs(2*l-1)) * s
+	x := chroma * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - chroma/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = chroma, x, 0
+	case h < 120:
+		r, g, b = x, chroma, 0
+	case h < 180:
+		r, g, b = 0, chroma, x
+	case h < 240:
+		r, g, b = 0, x, chroma
+	case h < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+
+	to8 := func(v float64) uint8 { return uint8(math.Round((v + m) * 255)) }
+	return color.NRGBA{R: to8(r), G: to8(g), B: to8(b), A: alpha}, nil
+}
+
+// JsonToPalette reads the name of a palette, or a list of colors which can use the
+// indexes of the base palette
+func JsonToPalette(v Value, base []color.Color) ([]color.Color, error) {
+	switch v.Type {
+	case kValueTypeString:
+		if p, ok := PaletteFactory[strings.ToLower(v.String)]; ok {
+			return p, nil
+		}
+		names := []string{}
+		for k := range PaletteFactory {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("palette %s is unknown, must be one of %v", v.String, names)
+
+	case kValueTypeList:
+		if len(v.List.Value) == 0 {
+			return nil, fmt.Errorf("palette must not be empty")
+		}
+		ret := []color.Color{}
+		for idx, x := range v.List.Value {
+			if clr, err := JsonToColor(x, base); err != nil {
+				return nil, fmt.Errorf("palette color %d is invalid, %v", idx, err)
+			} else {
+				ret = append(ret, clr)
+			}
+		}
+		return ret, nil
+
+	default:
+		return nil, fmt.Errorf("palette must be a name or a list of colors but got type %s", v.Type.GetName())
+	}
+}
+
+// hexColors is for the tables below, they are all valid
+func hexColors(hex ...string) []color.Color {
+	ret := make([]color.Color, len(hex))
+	for idx, x := range hex {
+		clr, err := parseHexColor(x)
+		if err != nil {
+			panic(err)
+		}
+		ret[idx] = clr
+	}
+	return ret
+}
+
+var cssColors = map[string]color.Color{}
+
+func init() {
+	PaletteFactory["soft"] = plotutil.SoftColors
+	PaletteFactory["dark"] = plotutil.DarkColors
+	PaletteFactory["tableau10"] = hexColors("#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+		"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac")
+	PaletteFactory["okabe-ito"] = hexColors("#e69f00", "#56b4e9", "#009e73", "#f0e442", "#0072b2",
+		"#d55e00", "#cc79a7", "#000000")
+	PaletteFactory["set2"] = hexColors("#66c2a5", "#fc8d62", "#8da0cb", "#e78ac3", "#a6d854",
+		"#ffd92f", "#e5c494", "#b3b3b3")
+
+	for name, hex := range map[string]string{
+		"aliceblue": "#f0f8ff", "antiquewhite": "#faebd7", "aqua": "#00ffff", "aquamarine": "#7fffd4",
+		"azure": "#f0ffff", "beige": "#f5f5dc", "bisque": "#ffe4c4", "black": "#000000",
+		"blanchedalmond": "#ffebcd", "blue": "#0000ff", "blueviolet": "#8a2be2", "brown": "#a52a2a",
+		"burlywood": "#deb887", "cadetblue": "#5f9ea0", "chartreuse": "#7fff00", "chocolate": "#d2691e",
+		"coral": "#ff7f50", "cornflowerblue": "#6495ed", "cornsilk": "#fff8dc", "crimson": "#dc143c",
+		"cyan": "#00ffff", "darkblue": "#00008b", "darkcyan": "#008b8b", "darkgoldenrod": "#b8860b",
+		"darkgray": "#a9a9a9", "darkgreen": "#006400", "darkgrey": "#a9a9a9", "darkkhaki": "#bdb76b",
+		"darkmagenta": "#8b008b", "darkolivegreen": "#556b2f", "darkorange": "#ff8c00", "darkorchid": "#9932cc",
+		"darkred": "#8b0000", "darksalmon": "#e9967a", "darkseagreen": "#8fbc8f", "darkslateblue": "#483d8b",
+		"darkslategray": "#2f4f4f", "darkslategrey": "#2f4f4f", "darkturquoise": "#00ced1", "darkviolet": "#9400d3",
+		"deeppink": "#ff1493", "deepskyblue": "#00bfff", "dimgray": "#696969", "dimgrey": "#696969",
+		"dodgerblue": "#1e90ff", "firebrick": "#b22222", "floralwhite": "#fffaf0", "forestgreen": "#228b22",
+		"fuchsia": "#ff00ff", "gainsboro": "#dcdcdc", "ghostwhite": "#f8f8ff", "gold": "#ffd700",
+		"goldenrod": "#daa520", "gray": "#808080", "green": "#008000", "greenyellow": "#adff2f",
+		"grey": "#808080", "honeydew": "#f0fff0", "hotpink": "#ff69b4", "indianred": "#cd5c5c",
+		"indigo": "#4b0082", "ivory": "#fffff0", "khaki": "#f0e68c", "lavender": "#e6e6fa",
+		"lavenderblush": "#fff0f5", "lawngreen": "#7cfc00", "lemonchiffon": "#fffacd", "lightblue": "#add8e6",
+		"lightcoral": "#f08080", "lightcyan": "#e0ffff", "lightgoldenrodyellow": "#fafad2", "lightgray": "#d3d3d3",
+		"lightgreen": "#90ee90", "lightgrey": "#d3d3d3", "lightpink": "#ffb6c1", "lightsalmon": "#ffa07a",
+		"lightseagreen": "#20b2aa", "lightskyblue": "#87cefa", "lightslategray": "#778899", "lightslategrey": "#778899",
+		"lightsteelblue": "#b0c4de", "lightyellow": "#ffffe0", "lime": "#00ff00", "limegreen": "#32cd32",
+		"linen": "#faf0e6", "magenta": "#ff00ff", "maroon": "#800000", "mediumaquamarine": "#66cdaa",
+		"mediumblue": "#0000cd", "mediumorchid": "#ba55d3", "mediumpurple": "#9370db", "mediumseagreen": "#3cb371",
+		"mediumslateblue": "#7b68ee", "mediumspringgreen": "#00fa9a", "mediumturquoise": "#48d1cc",
+		"mediumvioletred": "#c71585", "midnightblue": "#191970", "mintcream": "#f5fffa", "mistyrose": "#ffe4e1",
+		"moccasin": "#ffe4b5", "navajowhite": "#ffdead", "navy": "#000080", "oldlace": "#fdf5e6",
+		"olive": "#808000", "olivedrab": "#6b8e23", "orange": "#ffa500", "orangered": "#ff4500",
+		"orchid": "#da70d6", "palegoldenrod": "#eee8aa", "palegreen": "#98fb98", "paleturquoise": "#afeeee",
+		"palevioletred": "#db7093", "papayawhip": "#ffefd5", "peachpuff": "#ffdab9", "peru": "#cd853f",
+		"pink": "#ffc0cb", "plum": "#dda0dd", "powderblue": "#b0e0e6", "purple": "#800080",
+		"rebeccapurple": "#663399", "red": "#ff0000", "rosybrown": "#bc8f8f", "royalblue": "#4169e1",
+		"saddlebrown": "#8b4513", "salmon": "#fa8072", "sandybrown": "#f4a460", "seagreen": "#2e8b57",
+		"seashell": "#fff5ee", "sienna": "#a0522d", "silver": "#c0c0c0", "skyblue": "#87ceeb",
+		"slateblue": "#6a5acd", "slategray": "#708090", "slategrey": "#708090", "snow": "#fffafa",
+		"springgreen": "#00ff7f", "steelblue": "#4682b4", "tan": "#d2b48c", "teal": "#008080",
+		"thistle": "#d8bfd8", "tomato": "#ff6347", "turquoise": "#40e0d0", "violet": "#ee82ee",
+		"wheat": "#f5deb3", "white": "#ffffff", "whitesmoke": "#f5f5f5", "yellow": "#ffff00",
+		"yellowgreen": "#9acd32", "transparent": "#00000000",
+	} {
+		cssColors[name] = hexColors(hex)[0]
+	}
+}
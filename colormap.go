@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+// A Colormap turns a number into a color by interpolating between its stops. Where a
+// config takes a colormap it is either the name or an object
+//
+//	{"Name": "viridis", "Domain": [0, 100], "Reverse": true}
+//
+// Values outside of the domain get the color of the nearest end
+type Colormap struct {
+	Name    string
+	Min     float64
+	Max     float64
+	Reverse bool
+	stops   []color.Color
+}
+
+// ColormapFactory has the stops of the colormaps by lower case name, evenly spaced
+// from 0 to 1
+var ColormapFactory map[string][]color.Color = make(map[string][]color.Color)
+
+// NewColormap is the colormap with the domain 0 to 1, nil if the name is unknown
+func NewColormap(name string) *Colormap {
+	stops, ok := ColormapFactory[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	return &Colormap{Name: strings.ToLower(name), Min: 0, Max: 1, stops: stops}
+}
+
+// ParseColormap reads a colormap by name or object, the domain is left to SetDomain
+// unless "Domain" is given
+func ParseColormap(v Value) (*Colormap, error) {
+	name := ""
+	switch v.Type {
+	case kValueTypeString:
+		name = v.String
+	case kValueTypeObject:
+		if t, err := JsonObjectGetMultipleKey(v, "Name", "name"); err != nil {
+			return nil, err
+		} else if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Name\" field is not a string")
+		} else {
+			name = val
+		}
+	default:
+		return nil, fmt.Errorf("colormap must be a name or an object but got type %s", v.Type.GetName())
+	}
+
+	m := NewColormap(name)
+	if m == nil {
+		names := []string{}
+		for k := range ColormapFactory {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("colormap %s is unknown, must be one of %v", name, names)
+	}
+
+	// no domain means it is up to the user of the colormap, ie the range of the data
+	m.Min, m.Max = math.NaN(), math.NaN()
+	if v.Type != kValueTypeObject {
+		return m, nil
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Domain", "domain"); err == nil {
+		if t.Type != kValueTypeList || len(t.List.Value) != 2 {
+			return nil, fmt.Errorf("\"Domain\" field must be a list of 2 numbers")
+		}
+		for idx, ptr := range []*float64{&m.Min, &m.Max} {
+			if val, err := JsonGetNumber(t.List.Value[idx]); err != nil {
+				return nil, fmt.Errorf("\"Domain\" field must be a list of 2 numbers")
+			} else {
+				*ptr = val
+			}
+		}
+		if m.Min >= m.Max {
+			return nil, fmt.Errorf("\"Domain\" field must go from the smaller number to the larger one")
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Reverse", "reverse"); err == nil {
+		if val, err := JsonGetBoolean(t); err != nil {
+			return nil, fmt.Errorf("\"Reverse\" field is not a boolean")
+		} else {
+			m.Reverse = val
+		}
+	}
+	return m, nil
+}
+
+// HasDomain tells if the domain was given, otherwise SetDomain must be called first
+func (m *Colormap) HasDomain() bool {
+	return !math.IsNaN(m.Min) && !math.IsNaN(m.Max)
+}
+
+// SetDomain sets the domain if it was not given
+func (m *Colormap) SetDomain(min, max float64) {
+	if m.HasDomain() {
+		return
+	}
+	if min >= max {
+		max = min + 1
+	}
+	m.Min, m.Max = min, max
+}
+
+// At is the color of the value
+func (m *Colormap) At(v float64) color.Color {
+	t := 0.0
+	if m.Max > m.Min {
+		t = (v - m.Min) / (m.Max - m.Min)
+	}
+	t = math.Max(0, math.Min(1, t))
+	if math.IsNaN(t) {
+		t = 0
+	}
+	if m.Reverse {
+		t = 1 - t
+	}
+
+	pos := t * float64(len(m.stops)-1)
+	idx := int(math.Floor(pos))
+	if idx >= len(m.stops)-1 {
+		return m.stops[len(m.stops)-1]
+	}
+	frac := pos - float64(idx)
+
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*frac))
+	}
+	a := color.NRGBAModel.Convert(m.stops[idx]).(color.NRGBA)
+	b := color.NRGBAModel.Convert(m.stops[idx+1]).(color.NRGBA)
+	return color.NRGBA{R: lerp(a.R, b.R), G: lerp(a.G, b.G), B: lerp(a.B, b.B), A: lerp(a.A, b.A)}
+}
+
+func init() {
+	ColormapFactory["viridis"] = hexColors("#440154", "#482878", "#3e4989", "#31688e", "#26828e",
+		"#1f9e89", "#35b779", "#6ece58", "#b5de2b", "#fde725")
+	ColormapFactory["magma"] = hexColors("#000004", "#180f3d", "#440f76", "#721f81", "#9e2f7f",
+		"#cd4071", "#f1605d", "#fd9668", "#feca8d", "#fcfdbf")
+	ColormapFactory["cividis"] = hexColors("#00224e", "#123570", "#3b496c", "#575d6d", "#707173",
+		"#8a8779", "#a69d75", "#c4b56c", "#e4cf5b", "#fee838")
+	ColormapFactory["rdbu"] = hexColors("#67001f", "#b2182b", "#d6604d", "#f4a582", "#fddbc7",
+		"#f7f7f7", "#d1e5f0", "#92c5de", "#4393c3", "#2166ac", "#053061")
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Data source lets a "Data" field refer to data living outside of the spec instead
+// of inlining every number. A data source is an object with a "File" or "Source"
+// field, ie
+//
+//   {"File": "latency.csv", "X": "ts", "Y": ["p50", "p99"]}
+//
+// and it is resolved into the same shape the inline data would have:
+//
+//   - with "X", an object of series, each one a list of {"X": x, "Y": y} points
+//   - without "X" and a single "Y", a list of numbers
+//   - without "X" and a list of "Y", an object of lists of numbers
+//
+// A plotter drawing points takes the position of each number as its X when there is
+// no "X", the numbers are never read as pairs of x and y
+//
+// Columns are picked by header name or by 0 based index. A relative "File" starts from
+// the directory of the input spec, the working directory when it is read from stdin
+
+type csvSource struct {
+	File      string
+	Delimiter rune
+	Comment   rune
+	Header    bool
+	X         *Value
+	Y         []Value
+	MultipleY bool
+	Missing   map[string]bool
+	OnMissing string
+}
+
+const (
+	kOnMissingSkip  = "skip"
+	kOnMissingZero  = "zero"
+	kOnMissingError = "error"
+)
+
+// IsDataSource tells whether the value is an object standing for external data
+func IsDataSource(v Value) bool {
+	if v.Type != kValueTypeObject {
+		return false
+	}
+	_, err := JsonObjectGetMultipleKey(v, "File", "file", "Source", "source")
+	return err == nil
+}
+
+// ResolveData loads the data when the value is a data source, otherwise the value is
+// returned as is
+func ResolveData(v Value) (Value, error) {
+	if !IsDataSource(v) {
+		return v, nil
+	}
+
+	format, err := dataSourceFormat(v)
+	if err != nil {
+		return NewNull(), err
+	}
+
+	switch format {
+	case "json":
+		src, err := parseJsonSource(v)
+		if err != nil {
+			return NewNull(), err
+		}
+		ret, err := src.load()
+		if err != nil {
+			return NewNull(), fmt.Errorf("data source %s, %v", src.File, err)
+		}
+		return ret, nil
+
+	case "jsonl", "ndjson":
+		src, err := parseJsonlSource(v)
+		if err != nil {
+			return NewNull(), err
+		}
+		ret, err := src.load()
+		if err != nil {
+			return NewNull(), fmt.Errorf("data source %s, %v", src.File, err)
+		}
+		return ret, nil
+
+	default:
+		src, err := parseCsvSource(v)
+		if err != nil {
+			return NewNull(), err
+		}
+		ret, err := src.load()
+		if err != nil {
+			return NewNull(), fmt.Errorf("data source %s, %v", src.File, err)
+		}
+		return ret, nil
+	}
+}
+
+// dataSourceFormat is the "Format" field of the data source, or guessed from the
+// extension of the file when it is not given
+func dataSourceFormat(v Value) (string, error) {
+	if t, err := JsonObjectGetMultipleKey(v, "Format", "format"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return "", fmt.Errorf("data source \"Format\" field is not a string")
+		} else {
+			switch strings.ToLower(val) {
+			case "csv", "tsv", "json", "jsonl", "ndjson":
+				return strings.ToLower(val), nil
+			default:
+				return "", fmt.Errorf("data source \"Format\" %s is unknown, must be csv, tsv, json, jsonl or ndjson",
+					val)
+			}
+		}
+	}
+
+	// a query only makes sense over a json document
+	if _, err := JsonObjectGetMultipleKey(v, "Query", "query"); err == nil {
+		return "json", nil
+	}
+
+	file := ""
+	if t, err := JsonObjectGetMultipleKey(v, "File", "file", "Source", "source"); err == nil {
+		file, _ = JsonGetString(t)
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return "json", nil
+	case ".jsonl", ".ndjson":
+		return "jsonl", nil
+	case ".tsv":
+		return "tsv", nil
+	default:
+		return "csv", nil
+	}
+}
+
+func jsonGetRune(v Value, name string) (rune, error) {
+	str, err := JsonGetString(v)
+	if err != nil {
+		return 0, fmt.Errorf("\"%s\" field is not a string", name)
+	}
+
+	// allow the escaped form since a tab is awkward to type in json
+	if str == "\\t" {
+		str = "\t"
+	}
+
+	r, size := utf8.DecodeRuneInString(str)
+	if size == 0 || size != len(str) {
+		return 0, fmt.Errorf("\"%s\" field must be a single character but got %q", name, str)
+	}
+	return r, nil
+}
+
+func parseCsvSource(v Value) (*csvSource, error) {
+	src := &csvSource{
+		Delimiter: ',',
+		Comment:   '#',
+		Header:    true,
+		Missing:   map[string]bool{"": true, "NA": true, "NaN": true, "null": true},
+		OnMissing: kOnMissingSkip,
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "File", "file"); err != nil {
+		return nil, err
+	} else {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("data source \"File\" field is not a string")
+		} else {
+			src.File = val
+		}
+	}
+
+	if format, _ := dataSourceFormat(v); format == "tsv" {
+		src.Delimiter = '\t'
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Delimiter", "delimiter"); err == nil {
+		if r, err := jsonGetRune(t, "Delimiter"); err != nil {
+			return nil, fmt.Errorf("data source %s, %v", src.File, err)
+		} else {
+			src.Delimiter = r
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Comment", "comment"); err == nil {
+		if r, err := jsonGetRune(t, "Comment"); err != nil {
+			return nil, fmt.Errorf("data source %s, %v", src.File, err)
+		} else {
+			src.Comment = r
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Header", "header"); err == nil {
+		if val, err := JsonGetBoolean(t); err != nil {
+			return nil, fmt.Errorf("data source %s, \"Header\" field is not a boolean", src.File)
+		} else {
+			src.Header = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Missing", "missing"); err == nil {
+		if t.Type != kValueTypeList {
+			return nil, fmt.Errorf("data source %s, \"Missing\" field must be a list of strings", src.File)
+		}
+		src.Missing = make(map[string]bool)
+		for _, x := range t.List.Value {
+			if val, err := JsonGetString(x); err != nil {
+				return nil, fmt.Errorf("data source %s, \"Missing\" field must be a list of strings", src.File)
+			} else {
+				src.Missing[val] = true
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "OnMissing", "onmissing"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("data source %s, \"OnMissing\" field is not a string", src.File)
+		} else {
+			switch val {
+			case kOnMissingSkip, kOnMissingZero, kOnMissingError:
+				src.OnMissing = val
+			default:
+				return nil, fmt.Errorf("data source %s, \"OnMissing\" %s is unknown, must be skip, zero or error",
+					src.File, val)
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "X", "x"); err == nil {
+		if t.Type != kValueTypeString && t.Type != kValueTypeNumber {
+			return nil, fmt.Errorf("data source %s, \"X\" field must be a column name or index", src.File)
+		}
+		src.X = &t
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Y", "y"); err != nil {
+		return nil, fmt.Errorf("data source %s, %v", src.File, err)
+	} else {
+		switch t.Type {
+		case kValueTypeString, kValueTypeNumber:
+			src.Y = []Value{t}
+		case kValueTypeList:
+			for _, x := range t.List.Value {
+				if x.Type != kValueTypeString && x.Type != kValueTypeNumber {
+					return nil, fmt.Errorf("data source %s, \"Y\" field must be a list of column names or indexes",
+						src.File)
+				}
+			}
+			src.Y = t.List.Value
+			src.MultipleY = true
+		default:
+			return nil, fmt.Errorf("data source %s, \"Y\" field must be a column name, index or a list of them",
+				src.File)
+		}
+	}
+
+	return src, nil
+}
+
+// a table read from the file
+type csvTable struct {
+	header []string
+	rows   [][]string
+
+	// line number of each row for error reporting
+	lines []int
+}
+
+func (src *csvSource) read() (*csvTable, error) {
+	f, err := os.Open(src.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comma = src.Delimiter
+	r.Comment = src.Comment
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	table := &csvTable{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if src.Header && table.header == nil {
+			table.header = record
+			continue
+		}
+
+		line, _ := r.FieldPos(0)
+		table.rows = append(table.rows, record)
+		table.lines = append(table.lines, line)
+	}
+	return table, nil
+}
+
+// column finds the index of a column given by its header name or its index
+func (t *csvTable) column(v Value) (int, string, error) {
+	if v.Type == kValueTypeNumber {
+		idx := int(v.Number)
+		if idx < 0 || float64(idx) != v.Number {
+			return 0, "", fmt.Errorf("column index %v is invalid", v.Number)
+		}
+		name := fmt.Sprintf("%d", idx)
+		if idx < len(t.header) {
+			name = t.header[idx]
+		}
+		return idx, name, nil
+	}
+
+	for idx, name := range t.header {
+		if strings.TrimSpace(name) == v.String {
+			return idx, v.String, nil
+		}
+	}
+
+	if t.header == nil {
+		return 0, "", fmt.Errorf("column %q cannot be found since the file doesn't have a header, "+
+			"use a column index instead", v.String)
+	}
+	return 0, "", fmt.Errorf("column %q doesn't exist in header", v.String)
+}
+
+// cell returns the cell and whether it is a missing value
+func (src *csvSource) cell(t *csvTable, row, col int) (string, bool) {
+	if col >= len(t.rows[row]) {
+		return "", true
+	}
+	val := strings.TrimSpace(t.rows[row][col])
+	return val, src.Missing[val]
+}
+
+// number parses a Y cell, the returned bool is false when the cell is missing and
+// should be skipped
+func (src *csvSource) number(t *csvTable, row, col int, name string) (Value, bool, error) {
+	val, missing := src.cell(t, row, col)
+	if missing {
+		switch src.OnMissing {
+		case kOnMissingZero:
+			return Value{Type: kValueTypeNumber}, true, nil
+		case kOnMissingError:
+			return NewNull(), false, fmt.Errorf("line %d, column %s has missing value %q", t.lines[row], name, val)
+		default:
+			return NewNull(), false, nil
+		}
+	}
+
+	num, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return NewNull(), false, fmt.Errorf("line %d, column %s value %q is not a number", t.lines[row], name, val)
+	}
+	return Value{Type: kValueTypeNumber, Number: num}, true, nil
+}
+
+func (src *csvSource) load() (Value, error) {
+	table, err := src.read()
+	if err != nil {
+		return NewNull(), err
+	}
+
+	xcol := -1
+	if src.X != nil {
+		if xcol, _, err = table.column(*src.X); err != nil {
+			return NewNull(), err
+		}
+	}
+
+	series := NewObject()
+	var single Value
+
+	for _, y := range src.Y {
+		ycol, name, err := table.column(y)
+		if err != nil {
+			return NewNull(), err
+		}
+
+		list := NewList()
+		for row := range table.rows {
+			yval, ok, err := src.number(table, row, ycol, name)
+			if err != nil {
+				return NewNull(), err
+			}
+			if !ok {
+				continue
+			}
+
+			if xcol < 0 {
+				list.Value = append(list.Value, yval)
+				continue
+			}
+
+			xstr, missing := src.cell(table, row, xcol)
+			if missing {
+				if src.OnMissing == kOnMissingError {
+					return NewNull(), fmt.Errorf("line %d, X column has missing value %q", table.lines[row], xstr)
+				}
+				continue
+			}
+
+			// X cells which are not numbers are kept as strings so they can be
+			// parsed as timestamps later
+			xval := Value{Type: kValueTypeString, String: xstr}
+			if num, err := strconv.ParseFloat(xstr, 64); err == nil {
+				xval = Value{Type: kValueTypeNumber, Number: num}
+			}
+
+			pt := NewObject()
+			pt.Value["X"] = xval
+			pt.Value["Y"] = yval
+			list.Value = append(list.Value, Value{Type: kValueTypeObject, Object: pt})
+		}
+
+		single = Value{Type: kValueTypeList, List: list}
+		series.Value[name] = single
+	}
+
+	if xcol < 0 && !src.MultipleY {
+		return single, nil
+	}
+	return Value{Type: kValueTypeObject, Object: series}, nil
+}
+
+// resolveList resolves a data source which is expected to give a single list. A data
+// source with X gives an object of series, it is unwrapped when it only has one
+func resolveList(v Value) (Value, error) {
+	if !IsDataSource(v) {
+		return v, nil
+	}
+
+	v, err := ResolveData(v)
+	if err != nil {
+		return NewNull(), err
+	}
+
+	if v.Type == kValueTypeObject && len(v.Object.Value) == 1 {
+		for _, x := range v.Object.Value {
+			if x.Type == kValueTypeList {
+				return x, nil
+			}
+		}
+	}
+	return v, nil
+}
+
+// indexPoints turns the lists of numbers of a data source without X into lists of
+// points whose X is the position of the number, anything else is returned as is
+func indexPoints(v Value) Value {
+	switch v.Type {
+	case kValueTypeList:
+		for _, x := range v.List.Value {
+			if x.Type != kValueTypeNumber {
+				return v
+			}
+		}
+		list := NewList()
+		for idx, x := range v.List.Value {
+			pt := NewObject()
+			pt.Value["X"] = Value{Type: kValueTypeNumber, Number: float64(idx)}
+			pt.Value["Y"] = x
+			list.Value = append(list.Value, Value{Type: kValueTypeObject, Object: pt})
+		}
+		return Value{Type: kValueTypeList, List: list}
+
+	case kValueTypeObject:
+		series := NewObject()
+		for k, x := range v.Object.Value {
+			series.Value[k] = indexPoints(x)
+		}
+		return Value{Type: kValueTypeObject, Object: series}
+
+	default:
+		return v
+	}
+}
+
+// resolvePoints resolves a data source which is expected to give series of points
+func resolvePoints(v Value) (Value, error) {
+	if !IsDataSource(v) {
+		return v, nil
+	}
+
+	v, err := ResolveData(v)
+	if err != nil {
+		return NewNull(), err
+	}
+	return indexPoints(v), nil
+}
+
+// withDataDir makes the relative files of the data sources in v start from dir, and
+// the font files of its "Font" fields
+func withDataDir(v Value, dir string) Value {
+	if dir == "" {
+		return v
+	}
+
+	switch v.Type {
+	case kValueTypeList:
+		list := NewList()
+		for _, x := range v.List.Value {
+			list.Value = append(list.Value, withDataDir(x, dir))
+		}
+		return Value{Type: kValueTypeList, List: list}
+
+	case kValueTypeObject:
+		source := IsDataSource(v)
+		obj := NewObject()
+		for k, x := range v.Object.Value {
+			switch {
+			case source && x.Type == kValueTypeString && !filepath.IsAbs(x.String) &&
+				(k == "File" || k == "file" || k == "Source" || k == "source"):
+				obj.Value[k] = Value{Type: kValueTypeString, String: filepath.Join(dir, x.String)}
+			case k == "Font" || k == "font":
+				obj.Value[k] = withFontDir(x, dir)
+			default:
+				obj.Value[k] = withDataDir(x, dir)
+			}
+		}
+		return Value{Type: kValueTypeObject, Object: obj}
+
+	default:
+		return v
+	}
+}
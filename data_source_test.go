@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const kCsvTestData = `# latency of the api
+ts,p50,p99,host
+1,10,100,a
+2,12,NA,b
+3,,130,a
+4,15,150,b
+`
+
+// writeTestFile writes the file into the temporary directory of the test and returns
+// its path
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("file %s cannot be written, %v", path, err)
+	}
+	return path
+}
+
+// withTestFile puts the file into the data source given without its "File"
+func withTestFile(t *testing.T, source, file string) Value {
+	t.Helper()
+	return mustParseJson(t, fmt.Sprintf(`{"File": %q, `, file)+strings.TrimPrefix(source, "{"))
+}
+
+func TestCsvSource(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		content string
+		source  string
+		want    string
+	}{
+		{"a.csv", kCsvTestData, `{"Y": "p50"}`, `[10, 12, 15]`},
+		{"a.csv", kCsvTestData, `{"Y": 1}`, `[10, 12, 15]`},
+		{"a.csv", kCsvTestData, `{"Y": ["p50"]}`, `{"p50": [10, 12, 15]}`},
+		{"a.csv", kCsvTestData, `{"Y": "p99", "OnMissing": "zero"}`, `[100, 0, 130, 150]`},
+		{"a.csv", kCsvTestData, `{"X": "ts", "Y": ["p50", "p99"]}`,
+			`{"p50": [{"X": 1, "Y": 10}, {"X": 2, "Y": 12}, {"X": 4, "Y": 15}],
+			  "p99": [{"X": 1, "Y": 100}, {"X": 3, "Y": 130}, {"X": 4, "Y": 150}]}`},
+		{"a.csv", kCsvTestData, `{"X": "host", "Y": "p99", "Missing": ["NA"]}`,
+			`{"p99": [{"X": "a", "Y": 100}, {"X": "a", "Y": 130}, {"X": "b", "Y": 150}]}`},
+		{"a.tsv", "1\t2\n3\t4\n", `{"Header": false, "X": 0, "Y": 1}`, `{"1": [{"X": 1, "Y": 2}, {"X": 3, "Y": 4}]}`},
+		{"a.txt", "x;y\n1;2\n// skipped\n3;4\n", `{"Delimiter": ";", "Comment": "/", "X": "x", "Y": "y"}`,
+			`{"y": [{"X": 1, "Y": 2}, {"X": 3, "Y": 4}]}`},
+		{"a.csv", "t,v\n2024-03-01T00:00:00Z,1\n", `{"X": "t", "Y": "v"}`,
+			`{"v": [{"X": "2024-03-01T00:00:00Z", "Y": 1}]}`},
+	} {
+		file := writeTestFile(t, c.name, c.content)
+		got, err := ResolveData(withTestFile(t, c.source, file))
+		if err != nil {
+			t.Errorf("source %s failed, %v", c.source, err)
+			continue
+		}
+		want := mustParseValue(t, c.want)
+		if !sameJson(got, want) {
+			t.Errorf("source %s got %s, want %s", c.source, got.ToJson(), want.ToJson())
+		}
+	}
+}
+
+func TestCsvSourceError(t *testing.T) {
+	file := writeTestFile(t, "a.csv", kCsvTestData)
+
+	for _, c := range []struct {
+		source string
+		msg    string
+	}{
+		{`{"Y": "p75"}`, `column "p75" doesn't exist in header`},
+		{`{"Y": 1.5}`, "column index 1.5 is invalid"},
+		{`{"Y": "host"}`, `line 3, column host value "a" is not a number`},
+		{`{"Y": "p99", "OnMissing": "error"}`, `line 4, column p99 has missing value "NA"`},
+		{`{"X": "p50", "Y": "p99", "OnMissing": "error"}`, `line 4, column p99 has missing value "NA"`},
+		{`{"Y": "p50", "OnMissing": "drop"}`, `"OnMissing" drop is unknown, must be skip, zero or error`},
+		{`{"Y": "p50", "Delimiter": ";;"}`, `"Delimiter"`},
+		{`{"Y": "p50", "Header": "yes"}`, `"Header" field is not a boolean`},
+		{`{"Y": "p50", "Missing": "NA"}`, `"Missing" field must be a list of strings`},
+		{`{"X": true, "Y": "p50"}`, `"X" field must be a column name or index`},
+		{`{"Y": [true]}`, `"Y" field must be a list of column names or indexes`},
+		{`{"X": "ts"}`, "Y"},
+		{`{"Y": "p50", "Format": "xlsx"}`, `"Format" xlsx is unknown, must be csv, tsv, json, jsonl or ndjson`},
+	} {
+		_, err := ResolveData(withTestFile(t, c.source, file))
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("source %s got error %v, want %q", c.source, err, c.msg)
+		}
+	}
+
+	_, err := ResolveData(withTestFile(t, `{"Y": "v"}`, writeTestFile(t, "b.csv", "1,2\n")))
+	if err == nil || !strings.Contains(err.Error(), `column "v" doesn't exist in header`) {
+		t.Errorf("source without the column got error %v", err)
+	}
+	_, err = ResolveData(withTestFile(t, `{"Header": false, "Y": "v"}`, writeTestFile(t, "c.csv", "1,2\n")))
+	if err == nil || !strings.Contains(err.Error(), "the file doesn't have a header, use a column index instead") {
+		t.Errorf("source without a header got error %v", err)
+	}
+	_, err = ResolveData(withTestFile(t, `{"Y": "v"}`, filepath.Join(t.TempDir(), "missing.csv")))
+	if err == nil || !strings.Contains(err.Error(), "missing.csv") {
+		t.Errorf("source of a missing file got error %v", err)
+	}
+}
+
+func TestResolvePoints(t *testing.T) {
+	file := writeTestFile(t, "a.csv", kCsvTestData)
+
+	for _, c := range []struct {
+		source string
+		want   string
+	}{
+		{`{"Y": "p50"}`, `[{"X": 0, "Y": 10}, {"X": 1, "Y": 12}, {"X": 2, "Y": 15}]`},
+		{`{"Y": ["p50", "p99"]}`, `{"p50": [{"X": 0, "Y": 10}, {"X": 1, "Y": 12}, {"X": 2, "Y": 15}],
+			"p99": [{"X": 0, "Y": 100}, {"X": 1, "Y": 130}, {"X": 2, "Y": 150}]}`},
+		{`{"X": "ts", "Y": "p50"}`, `{"p50": [{"X": 1, "Y": 10}, {"X": 2, "Y": 12}, {"X": 4, "Y": 15}]}`},
+	} {
+		got, err := resolvePoints(withTestFile(t, c.source, file))
+		if err != nil {
+			t.Errorf("source %s failed, %v", c.source, err)
+			continue
+		}
+		want := mustParseValue(t, c.want)
+		if !sameJson(got, want) {
+			t.Errorf("source %s got %s, want %s", c.source, got.ToJson(), want.ToJson())
+		}
+	}
+
+	// the numbers of a source are never read as pairs of x and y
+	pts, err := JsonListToPointListWithX(withTestFile(t, `{"Y": "p50"}`, file), func(v Value) (float64, error) {
+		return JsonGetNumber(v)
+	})
+	if err != nil || len(*pts) != 3 || (*pts)[2].X != 2 || (*pts)[2].Y != 15 {
+		t.Errorf("points of the source got %v %v, want 3 indexed points", pts, err)
+	}
+}
+
+func TestWithDataDir(t *testing.T) {
+	abs := filepath.Join(t.TempDir(), "b.csv")
+	job := mustParseJson(t, fmt.Sprintf(`{
+		"Path": "out.png",
+		"Config": {
+			"Data": {"a": {"File": "a.csv", "Y": "v"}, "b": {"File": %q, "Y": "v"}, "c": [1, 2]},
+			"Title": "a.csv",
+			"Font": ["Helvetica", "fonts/a.ttf"],
+			"Theme": {"Font": "b.ttf"}
+		}
+	}`, abs))
+
+	got := withDataDir(job, "specs")
+	want := mustParseJson(t, fmt.Sprintf(`{
+		"Path": "out.png",
+		"Config": {
+			"Data": {"a": {"File": "specs/a.csv", "Y": "v"}, "b": {"File": %q, "Y": "v"}, "c": [1, 2]},
+			"Title": "a.csv",
+			"Font": ["Helvetica", "specs/fonts/a.ttf"],
+			"Theme": {"Font": "specs/b.ttf"}
+		}
+	}`, abs))
+	if !sameJson(got, want) {
+		t.Errorf("job in specs got %s, want %s", got.ToJson(), want.ToJson())
+	}
+
+	if got := withDataDir(job, ""); !sameJson(got, job) {
+		t.Errorf("job in the working directory got %s, want it unchanged", got.ToJson())
+	}
+}
@@ -2,10 +2,10 @@ package main
 
 import (
 	"fmt"
-	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/plotutil"
 	"gonum.org/v1/plot/vg"
+	"sort"
 )
 
 type dotPlotter struct{}
@@ -14,10 +14,28 @@ func (d *dotPlotter) GetName() string {
 	return "dot-plotter"
 }
 
-func (d *dotPlotter) Plot(path string, data Value) error {
+func (d *dotPlotter) Summary() string {
+	return "draws each series of points as a line with markers"
+}
+
+func (d *dotPlotter) Options() []OptionDoc {
+	return append([]OptionDoc{
+		{"Title", "string", "dot-plot", "the title of the chart"},
+		{"X", "string", "X", "the label of the X axis"},
+		{"Y", "string", "Y", "the label of the Y axis"},
+		{"Y2", "string", "", "the label of the Y axis on the right"},
+		{"Grids", "boolean", "false", "draws grid lines"},
+		{"Size", "number", "4", "the width and the height of the chart in inches"},
+		{"Data", "object", "", "the series by name, each one a list of points, a data source or an object with options"},
+		{"FitOutput", "string", "", "the json file the coefficients of the fits are written into"},
+	}, seriesOptionDocs...)
+}
+
+func (d *dotPlotter) Render(data Value) (*Chart, error) {
 	title := "dot-plot"
 	xlabel := "X"
 	ylabel := "Y"
+	y2label := ""
 	grids := false
 	size := 4.0
 
@@ -42,6 +60,13 @@ func (d *dotPlotter) Plot(path string, data Value) error {
 		}
 	}
 
+	// get the label of the right Y axis
+	if v, err := JsonObjectGetMultipleKey(data, "Y2", "y2"); err == nil {
+		if val, err := JsonGetString(v); err == nil {
+			y2label = val
+		}
+	}
+
 	// get the grids
 	if v, err := JsonObjectGetMultipleKey(data, "Grids", "grids"); err == nil {
 		if val, err := JsonGetBoolean(v); err == nil {
@@ -57,49 +82,121 @@ func (d *dotPlotter) Plot(path string, data Value) error {
 	}
 
 	// set up the plotter
-	p, err := plot.New()
+	chart, err := NewChart(data, size)
 	if err != nil {
-		return fmt.Errorf("cannot create plotter %v", err)
+		return nil, fmt.Errorf("cannot create plotter %v", err)
 	}
 
+	p := chart.Plot
 	p.Title.Text = title
 	p.X.Label.Text = xlabel
 	p.Y.Label.Text = ylabel
 
 	if grids {
-		p.Add(plotter.NewGrid())
+		chart.Add(chart.NewGrid())
 	}
 
-	// a list of interface used to feed AddLinePoints
-	arg := []interface{}{}
-
 	// get the data from it
 	if v, err := JsonObjectGetMultipleKey(data, "Data", "data"); err == nil {
+		if v, err = resolvePoints(v); err != nil {
+			return nil, fmt.Errorf("dot-plotter \"data\" field cannot be loaded, %v", err)
+		}
+
 		if v.Type != kValueTypeObject {
-			return fmt.Errorf("\"data\" field must be an object but got type %s,%s", v.Type.GetName())
+			return nil, fmt.Errorf("\"data\" field must be an object but got type %s", v.Type.GetName())
+		}
+
+		defaults, err := parseSeriesOptions(data, &seriesOptions{Axis: kAxisLeft}, chart.Theme.Palette)
+		if err != nil {
+			return nil, fmt.Errorf("dot-plotter %v", err)
+		}
+
+		keys := []string{}
+		for key := range v.Object.Value {
+			keys = append(keys, key)
 		}
+		sort.Strings(keys)
+
+		// go through each key value pair in the data list and render them, the style
+		// of each series follows plotutil.AddLinePoints
+		fits := NewObject()
+		for idx, key := range keys {
+			val := v.Object.Value[key]
+			opt := defaults
+			if isSeriesObject(val) {
+				if opt, err = parseSeriesOptions(val, defaults, chart.Theme.Palette); err != nil {
+					return nil, fmt.Errorf("dot-plotter \"data\" field \"%s\" %v", key, err)
+				}
+				if t, err := JsonObjectGetMultipleKey(val, "Legend", "legend"); err == nil {
+					if show, err := JsonGetBoolean(t); err != nil {
+						return nil, fmt.Errorf("dot-plotter \"data\" field \"%s\" \"Legend\" field is not a boolean", key)
+					} else {
+						opt.HideLegend = !show
+					}
+				}
+				val, _ = JsonObjectGetMultipleKey(val, "Data", "data")
+			}
 
-		// go through each key value pair in the data list and render them
-		for key, val := range v.Object.Value {
-			if pts, err := JsonListToPointList(val); err != nil {
-				return fmt.Errorf("dot-plotter \"data\" field \"%s\" cannot convert "+
+			if pts, err := JsonListToPointListWithX(val, chart.XValue); err != nil {
+				return nil, fmt.Errorf("dot-plotter \"data\" field \"%s\" cannot convert "+
 					"to a list of points for reason %v", key, err)
 			} else {
-				arg = append(arg, key)
-				arg = append(arg, *pts)
+				// the fit sees every point, only the drawn line is reduced
+				raw := *pts
+				*pts = opt.reduce(raw)
+
+				l, sc, err := plotter.NewLinePoints(*pts)
+				if err != nil {
+					return nil, fmt.Errorf("dot-plotter \"data\" field \"%s\" cannot be plotted "+
+						"for reason %v", key, err)
+				}
+				l.Color = opt.color(chart.Color(idx))
+				l.Dashes = plotutil.Dashes(idx)
+				sc.Color = l.Color
+				sc.Shape = plotutil.Shape(idx)
+				opt.colorByY(sc, *pts)
+				if err := opt.addTo(chart, key, l.Color, *pts, l, sc); err != nil {
+					return nil, fmt.Errorf("dot-plotter \"data\" field \"%s\" cannot be plotted "+
+						"for reason %v", key, err)
+				}
+
+				if opt.Fit != nil {
+					fit, err := opt.Fit.Fit(raw)
+					if err != nil {
+						return nil, fmt.Errorf("dot-plotter \"data\" field \"%s\" cannot be fitted "+
+							"for reason %v", key, err)
+					}
+
+					fl := &plotter.Line{XYs: fit.Curve, LineStyle: plotter.DefaultLineStyle}
+					fl.Color = l.Color
+					fl.Width = vg.Points(1.5)
+					fl.Dashes = []vg.Length{vg.Points(6), vg.Points(3)}
+					if err := opt.addTo(chart, key+" "+fit.Label(), fl.Color, fit.Curve, fl); err != nil {
+						return nil, fmt.Errorf("dot-plotter \"data\" field \"%s\" cannot be fitted "+
+							"for reason %v", key, err)
+					}
+					fits.Value[key] = fit.ToValue()
+				}
 			}
 		}
-	}
 
-	plotutil.AddLinePoints(p, arg...)
+		// the coefficients go into a sidecar json so they can be read by other tools,
+		// it is written next to the chart when the chart is saved
+		if v, err := JsonObjectGetMultipleKey(data, "FitOutput", "fitoutput"); err == nil {
+			path, err := JsonGetString(v)
+			if err != nil {
+				return nil, fmt.Errorf("dot-plotter \"FitOutput\" field is not a string")
+			}
+			chart.FitOutput = path
+			chart.Fits = Value{Type: kValueTypeObject, Object: fits}
+		}
+	}
 
-	sz := vg.Length(size)
-	// save it to png file
-	if err = p.Save(sz*vg.Inch, sz*vg.Inch, path); err != nil {
-		return fmt.Errorf("dot-plotter cannot save file to %s, due to reason %v", path, err)
+	if chart.Right != nil {
+		chart.Right.Y.Label.Text = y2label
 	}
 
-	return nil
+	return chart, nil
 }
 
 func init() {
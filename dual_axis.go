@@ -0,0 +1,93 @@
+package main
+
+import (
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"math"
+)
+
+// A gonum plot only has one Y axis. The series drawn against the Y axis on the right
+// live in a second plot which only lends its Y axis: the main plot is drawn with room
+// left on the right side, then the plotters of the second plot are drawn into the same
+// data area and its Y axis is drawn along the right edge. X always follows the main
+// plot
+
+// syncRightAxis makes the right plot share the X axis of the main plot
+func syncRightAxis(left, right *plot.Plot) {
+	right.X = left.X
+}
+
+// rightAxisWidth is the room the right axis takes, the tick labels are measured on
+// the final range
+func rightAxisWidth(axis *plot.Axis) vg.Length {
+	width := vg.Length(0)
+	for _, t := range axis.Tick.Marker.Ticks(axis.Min, axis.Max) {
+		if w := textWidth(axis.Tick.Label, t.Label); t.Label != "" && w > width {
+			width = w
+		}
+	}
+	width += axis.Padding + axis.Tick.Length + vg.Points(2)
+
+	if axis.Label.Text != "" {
+		sty := axis.Label.TextStyle
+		sty.Rotation = 0
+		width += sty.Height(axis.Label.Text) + vg.Points(2)
+	}
+	return width
+}
+
+// reserveRightAxis is what is left of the canvas for the main plot
+func reserveRightAxis(dc draw.Canvas, right *plot.Plot) draw.Canvas {
+	dc.Max.X -= rightAxisWidth(&right.Y)
+	return dc
+}
+
+// drawRightAxis draws the axis along the right edge of the data area da, the label
+// goes to the right edge of the whole canvas dc
+func drawRightAxis(dc, da draw.Canvas, axis *plot.Axis) {
+	x := da.Max.X + axis.Padding
+	dc.StrokeLine2(axis.LineStyle, x, da.Min.Y, x, da.Max.Y)
+
+	for _, t := range axis.Tick.Marker.Ticks(axis.Min, axis.Max) {
+		if t.Value < math.Min(axis.Min, axis.Max) || t.Value > math.Max(axis.Min, axis.Max) {
+			continue
+		}
+		y := da.Y(axis.Norm(t.Value))
+
+		length := axis.Tick.Length
+		if t.IsMinor() {
+			length /= 2
+		}
+		dc.StrokeLine2(axis.Tick.LineStyle, x, y, x+length, y)
+
+		if t.Label != "" {
+			sty := axis.Tick.Label
+			sty.XAlign = draw.XLeft
+			sty.YAlign = draw.YCenter
+			dc.FillText(sty, vg.Point{X: x + axis.Tick.Length + vg.Points(2), Y: y}, t.Label)
+		}
+	}
+
+	if axis.Label.Text != "" {
+		sty := axis.Label.TextStyle
+		sty.Rotation = -math.Pi / 2
+		sty.XAlign = draw.XCenter
+		sty.YAlign = draw.YTop
+		dc.FillText(sty, vg.Point{X: dc.Max.X, Y: (da.Min.Y + da.Max.Y) / 2}, axis.Label.Text)
+	}
+}
+
+// drawDual draws the main plot together with the plotters of the right plot
+func drawDual(dc draw.Canvas, left, right *plot.Plot, ps []plot.Plotter) {
+	syncRightAxis(left, right)
+
+	lc := reserveRightAxis(dc, right)
+	left.Draw(lc)
+
+	da := left.DataCanvas(lc)
+	for _, p := range ps {
+		p.Plot(da, right)
+	}
+	drawRightAxis(dc, da, &right.Y)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Expr is an arithmetic expression over the fields of a record, used to derive new
+// columns, ie "(bytes_in + bytes_out) / 1024". A field is a dotted path into the
+// record and "@" is the record itself, which is how a list of plain numbers is
+// referred to. Supported are + - * / %, parentheses and a few functions:
+// abs, sqrt, log, log10, exp, floor, ceil, round, min and max
+type Expr struct {
+	Text string
+	root exprNode
+}
+
+type exprNode interface {
+	eval(rec Value) (float64, error)
+}
+
+type exprNumber float64
+
+type exprField string
+
+type exprUnary struct {
+	x exprNode
+}
+
+type exprBinary struct {
+	op   byte
+	l, r exprNode
+}
+
+type exprCall struct {
+	name string
+	args []exprNode
+}
+
+var exprFuncs = map[string]int{
+	"abs":   1,
+	"sqrt":  1,
+	"log":   1,
+	"log10": 1,
+	"exp":   1,
+	"floor": 1,
+	"ceil":  1,
+	"round": 1,
+	"min":   2,
+	"max":   2,
+}
+
+func (n exprNumber) eval(rec Value) (float64, error) {
+	return float64(n), nil
+}
+
+// fieldValue picks a field out of a record, "@" being the record itself
+func fieldValue(rec Value, path string) (Value, error) {
+	if path == "@" || path == "" {
+		return rec, nil
+	}
+	return JsonGetPath(rec, strings.TrimPrefix(path, "@."))
+}
+
+func (n exprField) eval(rec Value) (float64, error) {
+	v, err := fieldValue(rec, string(n))
+	if err != nil {
+		return 0, err
+	}
+	if v.Type != kValueTypeNumber {
+		return 0, fmt.Errorf("field %s is not a number but type %s", string(n), v.Type.GetName())
+	}
+	return v.Number, nil
+}
+
+func (n *exprUnary) eval(rec Value) (float64, error) {
+	x, err := n.x.eval(rec)
+	return -x, err
+}
+
+func (n *exprBinary) eval(rec Value) (float64, error) {
+	l, err := n.l.eval(rec)
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.r.eval(rec)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	case '/':
+		return l / r, nil
+	default:
+		return math.Mod(l, r), nil
+	}
+}
+
+func (n *exprCall) eval(rec Value) (float64, error) {
+	args := make([]float64, len(n.args))
+	for idx, x := range n.args {
+		v, err := x.eval(rec)
+		if err != nil {
+			return 0, err
+		}
+		args[idx] = v
+	}
+
+	switch n.name {
+	case "abs":
+		return math.Abs(args[0]), nil
+	case "sqrt":
+		return math.Sqrt(args[0]), nil
+	case "log":
+		return math.Log(args[0]), nil
+	case "log10":
+		return math.Log10(args[0]), nil
+	case "exp":
+		return math.Exp(args[0]), nil
+	case "floor":
+		return math.Floor(args[0]), nil
+	case "ceil":
+		return math.Ceil(args[0]), nil
+	case "round":
+		return math.Round(args[0]), nil
+	case "min":
+		return math.Min(args[0], args[1]), nil
+	default:
+		return math.Max(args[0], args[1]), nil
+	}
+}
+
+// the lexing helpers are shared with the query parser
+type exprParser struct {
+	queryParser
+}
+
+func (p *exprParser) error(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q around %d, %s", p.text, p.pos, fmt.Sprintf(format, args...))
+}
+
+func isFieldChar(c byte) bool {
+	return c == '_' || c == '.' || c == '@' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *exprParser) expr() (exprNode, error) {
+	l, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		c := p.peek()
+		if c != '+' && c != '-' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l = &exprBinary{op: c, l: l, r: r}
+	}
+}
+
+func (p *exprParser) term() (exprNode, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		c := p.peek()
+		if c != '*' && c != '/' && c != '%' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = &exprBinary{op: c, l: l, r: r}
+	}
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	p.skipSpace()
+	if p.consume("-") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	p.skipSpace()
+	c := p.peek()
+
+	switch {
+	case c == '(':
+		p.pos++
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.error("expect a \")\"")
+		}
+		return x, nil
+
+	case (c >= '0' && c <= '9') || c == '.':
+		start := p.pos
+		for !p.eof() && strings.IndexByte("0123456789.eE", p.peek()) >= 0 {
+			// the sign of an exponent, ie 1e-3
+			if (p.peek() == 'e' || p.peek() == 'E') && p.pos+1 < len(p.text) &&
+				(p.text[p.pos+1] == '-' || p.text[p.pos+1] == '+') {
+				p.pos++
+			}
+			p.pos++
+		}
+		num, err := strconv.ParseFloat(p.text[start:p.pos], 64)
+		if err != nil {
+			return nil, p.error("%s is not a number", p.text[start:p.pos])
+		}
+		return exprNumber(num), nil
+
+	case isFieldChar(c):
+		start := p.pos
+		for !p.eof() && isFieldChar(p.peek()) {
+			p.pos++
+		}
+		name := p.text[start:p.pos]
+
+		p.skipSpace()
+		if !p.consume("(") {
+			return exprField(name), nil
+		}
+
+		arity, ok := exprFuncs[name]
+		if !ok {
+			return nil, p.error("function %s is unknown", name)
+		}
+		call := &exprCall{name: name}
+		for {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, x)
+			p.skipSpace()
+			if p.consume(")") {
+				break
+			}
+			if !p.consume(",") {
+				return nil, p.error("expect a \",\" or \")\" in arguments of %s", name)
+			}
+		}
+		if len(call.args) != arity {
+			return nil, p.error("function %s takes %d arguments but got %d", name, arity, len(call.args))
+		}
+		return call, nil
+
+	default:
+		if p.eof() {
+			return nil, p.error("expression ends unexpectedly")
+		}
+		return nil, p.error("unexpected character %q", c)
+	}
+}
+
+func CompileExpr(text string) (*Expr, error) {
+	p := &exprParser{queryParser{text: text}}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.error("unexpected character %q", p.peek())
+	}
+	return &Expr{Text: text, root: root}, nil
+}
+
+// Eval computes the expression for the record
+func (e *Expr) Eval(rec Value) (float64, error) {
+	return e.root.eval(rec)
+}
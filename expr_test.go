@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	rec := mustParseJson(t, `{"a": 2, "b": {"c": 3}, "s": "x"}`)
+
+	for _, c := range []struct {
+		expr string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"12 / 3 / 2", 2},
+		{"7 % 4", 3},
+		{"-a + 1", -1},
+		{"--a", 2},
+		{"a * b.c", 6},
+		{"@.a / 4", 0.5},
+		{"1e-3 * 1000", 1},
+		{"2.5E2", 250},
+		{".5 + a", 2.5},
+		{"max(a, b.c) - min(a, 1)", 2},
+		{"sqrt(16) + abs(-2)", 6},
+		{"round(2.5) + floor(1.9) + ceil(1.1)", 6},
+		{"log10(1000)", 3},
+		{"exp(0) + log(1)", 1},
+		{"max(a * 2, (b.c + 1) * 2)", 8},
+	} {
+		e, err := CompileExpr(c.expr)
+		if err != nil {
+			t.Errorf("expression %s failed, %v", c.expr, err)
+			continue
+		}
+		if got, err := e.Eval(rec); err != nil {
+			t.Errorf("expression %s failed, %v", c.expr, err)
+		} else if math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("expression %s got %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestExprEvalNumber(t *testing.T) {
+	e, err := CompileExpr("@ * 2 + 1")
+	if err != nil {
+		t.Fatalf("expression failed, %v", err)
+	}
+	if got, err := e.Eval(Value{Type: kValueTypeNumber, Number: 5}); err != nil || got != 11 {
+		t.Errorf("expression %s got %v %v, want 11", e.Text, got, err)
+	}
+}
+
+func TestExprEvalError(t *testing.T) {
+	rec := mustParseJson(t, `{"a": 2, "s": "x"}`)
+
+	for _, c := range []struct {
+		expr string
+		msg  string
+	}{
+		{"s + 1", "field s is not a number but type string"},
+		{"max(a, s)", "field s is not a number but type string"},
+		{"missing * 2", "missing"},
+	} {
+		e, err := CompileExpr(c.expr)
+		if err != nil {
+			t.Errorf("expression %s failed to compile, %v", c.expr, err)
+			continue
+		}
+		if _, err := e.Eval(rec); err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("expression %s got error %v, want %q", c.expr, err, c.msg)
+		}
+	}
+}
+
+func TestCompileExprError(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{"", 0, "expression ends unexpectedly"},
+		{"1 +", 3, "expression ends unexpectedly"},
+		{"(1 + 2", 6, `expect a ")"`},
+		{"foo(1)", 4, "function foo is unknown"},
+		{"min(1)", 6, "function min takes 2 arguments but got 1"},
+		{"max(1 2)", 6, `expect a "," or ")" in arguments of max`},
+		{"1 2", 2, `unexpected character '2'`},
+		{"1.2.3", 5, "1.2.3 is not a number"},
+		{"a # b", 2, `unexpected character '#'`},
+		{"2 * )", 4, `unexpected character ')'`},
+	} {
+		_, err := CompileExpr(c.expr)
+		if err == nil {
+			t.Errorf("expression %q compiled, want an error", c.expr)
+			continue
+		}
+		at := fmt.Sprintf("around %d,", c.pos)
+		if !strings.Contains(err.Error(), at) || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("expression %q got error %q, want %q %s", c.expr, err, at, c.msg)
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot/plotter"
+	"math"
+	"sort"
+	"strings"
+)
+
+// fitSpec is a regression or a smoothing curve drawn over an XY series. "Fit" is either
+// the name of the model or an object with "Type" and the options of the model:
+//
+//	"linear"                           y = a + bx
+//	{"Type": "poly", "Degree": 3}      polynomial, degree 2 by default
+//	"exp"                              y = a e^(bx), needs positive y
+//	"power"                            y = a x^b, needs positive x and y
+//	{"Type": "lowess", "Span": 0.3}    locally weighted regression over the given
+//	                                   fraction of the points, 2/3 by default
+type fitSpec struct {
+	Type   string
+	Degree int
+	Span   float64
+}
+
+// fitResult is the fitted model together with the curve to draw
+type fitResult struct {
+	Type         string
+	Equation     string
+	Coefficients []float64
+	R2           float64
+	N            int
+	Curve        plotter.XYs
+}
+
+const (
+	kFitSamples = 200
+
+	// robustifying iterations of lowess
+	kLowessIterations = 2
+
+	// lowess is quadratic in the points, a longer series is fitted on a subsample
+	kLowessPoints = 2000
+)
+
+func parseFit(v Value) (*fitSpec, error) {
+	f := &fitSpec{Degree: 2, Span: 2.0 / 3}
+
+	switch v.Type {
+	case kValueTypeString:
+		f.Type = v.String
+	case kValueTypeObject:
+		if t, err := JsonObjectGetMultipleKey(v, "Type", "type"); err != nil {
+			return nil, err
+		} else {
+			if val, err := JsonGetString(t); err != nil {
+				return nil, fmt.Errorf("\"Type\" field is not a string")
+			} else {
+				f.Type = val
+			}
+		}
+
+		if t, err := JsonObjectGetMultipleKey(v, "Degree", "degree"); err == nil {
+			if val, err := JsonGetNumber(t); err != nil || val < 1 || val > 10 || val != math.Floor(val) {
+				return nil, fmt.Errorf("\"Degree\" field must be an integer between 1 and 10")
+			} else {
+				f.Degree = int(val)
+			}
+		}
+
+		if t, err := JsonObjectGetMultipleKey(v, "Span", "span"); err == nil {
+			if val, err := JsonGetNumber(t); err != nil || val <= 0 || val > 1 {
+				return nil, fmt.Errorf("\"Span\" field must be a number in (0, 1]")
+			} else {
+				f.Span = val
+			}
+		}
+	default:
+		return nil, fmt.Errorf("value must be a string or an object but got type %s", v.Type.GetName())
+	}
+
+	switch f.Type {
+	case "linear", "poly", "exp", "power", "lowess":
+	default:
+		return nil, fmt.Errorf("fit %s is unknown, must be linear, poly, exp, power or lowess", f.Type)
+	}
+	return f, nil
+}
+
+// solve the linear system a x = b by gaussian elimination with partial pivoting
+func solveLinear(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("the points don't determine the fit")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+
+		for r := col + 1; r < n; r++ {
+			k := a[r][col] / a[col][col]
+			for c := col; c < n; c++ {
+				a[r][c] -= k * a[col][c]
+			}
+			b[r] -= k * b[col]
+		}
+	}
+
+	x := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		sum := b[r]
+		for c := r + 1; c < n; c++ {
+			sum -= a[r][c] * x[c]
+		}
+		x[r] = sum / a[r][r]
+	}
+	return x, nil
+}
+
+// polyFit fits the coefficients c[0] + c[1]x + ... + c[degree]x^degree. The fit is
+// done on x standardized, which keeps timestamps from making the system singular,
+// and the coefficients are expanded back afterwards. The returned model evaluates
+// the standardized polynomial, which stays precise where the expanded one cancels out
+func polyFit(xs, ys []float64, degree int) ([]float64, func(float64) float64, error) {
+	if len(xs) <= degree {
+		return nil, nil, fmt.Errorf("a degree %d fit needs more than %d points", degree, degree)
+	}
+
+	m := statMean(xs)
+	s := statStdDev(xs)
+	if s == 0 || math.IsNaN(s) {
+		return nil, nil, fmt.Errorf("the points don't determine the fit")
+	}
+
+	n := degree + 1
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n)
+	}
+	b := make([]float64, n)
+
+	for idx, x := range xs {
+		u := (x - m) / s
+		pow := make([]float64, 2*n)
+		pow[0] = 1
+		for k := 1; k < len(pow); k++ {
+			pow[k] = pow[k-1] * u
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				a[i][j] += pow[i+j]
+			}
+			b[i] += pow[i] * ys[idx]
+		}
+	}
+
+	cu, err := solveLinear(a, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// c_k ((x - m) / s)^k expanded with the binomial theorem
+	c := make([]float64, n)
+	for k, ck := range cu {
+		scale := ck / math.Pow(s, float64(k))
+		binom := 1.0
+		for j := 0; j <= k; j++ {
+			c[j] += scale * binom * math.Pow(-m, float64(k-j))
+			binom = binom * float64(k-j) / float64(j+1)
+		}
+	}
+	return c, func(x float64) float64 { return polyEval(cu, (x-m)/s) }, nil
+}
+
+func polyEval(c []float64, x float64) float64 {
+	y := 0.0
+	for k := len(c) - 1; k >= 0; k-- {
+		y = y*x + c[k]
+	}
+	return y
+}
+
+// rSquared is the coefficient of determination of the predictions
+func rSquared(ys, pred []float64) float64 {
+	mean := statMean(ys)
+	var res, tot float64
+	for idx, y := range ys {
+		res += (y - pred[idx]) * (y - pred[idx])
+		tot += (y - mean) * (y - mean)
+	}
+	if tot == 0 {
+		return 1
+	}
+	return 1 - res/tot
+}
+
+// formatPoly writes the polynomial from the highest degree down, ie 2x^2 - x + 3
+func formatPoly(c []float64) string {
+	b := strings.Builder{}
+	for k := len(c) - 1; k >= 0; k-- {
+		v := c[k]
+		if v == 0 && len(c) > 1 {
+			continue
+		}
+
+		switch {
+		case b.Len() == 0 && v < 0:
+			b.WriteString("-")
+		case b.Len() != 0 && v < 0:
+			b.WriteString(" - ")
+		case b.Len() != 0:
+			b.WriteString(" + ")
+		}
+
+		b.WriteString(fmt.Sprintf("%.4g", math.Abs(v)))
+		switch k {
+		case 0:
+		case 1:
+			b.WriteString("x")
+		default:
+			b.WriteString(fmt.Sprintf("x^%d", k))
+		}
+	}
+	if b.Len() == 0 {
+		return "y = 0"
+	}
+	return "y = " + b.String()
+}
+
+// sampleCurve evaluates the model across the range of the points
+func sampleCurve(xs []float64, f func(float64) float64) plotter.XYs {
+	min, max := statMin(xs), statMax(xs)
+	pts := make(plotter.XYs, 0, kFitSamples)
+	for i := 0; i < kFitSamples; i++ {
+		x := min + (max-min)*float64(i)/float64(kFitSamples-1)
+		y := f(x)
+		if math.IsNaN(y) || math.IsInf(y, 0) {
+			continue
+		}
+		pts = append(pts, plotter.XY{X: x, Y: y})
+	}
+	return pts
+}
+
+// Fit the model to the points, points with NaN or infinite values are ignored
+func (f *fitSpec) Fit(pts plotter.XYs) (*fitResult, error) {
+	xs, ys := []float64{}, []float64{}
+	for _, p := range pts {
+		if math.IsNaN(p.X) || math.IsNaN(p.Y) || math.IsInf(p.X, 0) || math.IsInf(p.Y, 0) {
+			continue
+		}
+		xs = append(xs, p.X)
+		ys = append(ys, p.Y)
+	}
+	if len(xs) < 2 {
+		return nil, fmt.Errorf("fit %s needs at least 2 points but got %d", f.Type, len(xs))
+	}
+
+	ret := &fitResult{Type: f.Type, N: len(xs)}
+	pred := make([]float64, len(xs))
+	var model func(float64) float64
+
+	switch f.Type {
+	case "linear", "poly":
+		degree := f.Degree
+		if f.Type == "linear" {
+			degree = 1
+		}
+		c, poly, err := polyFit(xs, ys, degree)
+		if err != nil {
+			return nil, err
+		}
+		ret.Coefficients = c
+		ret.Equation = formatPoly(c)
+		model = poly
+
+	case "exp", "power":
+		lx, ly := make([]float64, len(xs)), make([]float64, len(ys))
+		for idx := range xs {
+			if ys[idx] <= 0 {
+				return nil, fmt.Errorf("fit %s needs positive y but got %v", f.Type, ys[idx])
+			}
+			ly[idx] = math.Log(ys[idx])
+			lx[idx] = xs[idx]
+			if f.Type == "power" {
+				if xs[idx] <= 0 {
+					return nil, fmt.Errorf("fit power needs positive x but got %v", xs[idx])
+				}
+				lx[idx] = math.Log(xs[idx])
+			}
+		}
+
+		c, _, err := polyFit(lx, ly, 1)
+		if err != nil {
+			return nil, err
+		}
+		a, b := math.Exp(c[0]), c[1]
+		ret.Coefficients = []float64{a, b}
+
+		if f.Type == "exp" {
+			ret.Equation = fmt.Sprintf("y = %.4ge^(%.4gx)", a, b)
+			model = func(x float64) float64 { return a * math.Exp(b*x) }
+		} else {
+			ret.Equation = fmt.Sprintf("y = %.4gx^%.4g", a, b)
+			model = func(x float64) float64 { return a * math.Pow(x, b) }
+		}
+
+	case "lowess":
+		fitted := lowess(xs, ys, f.Span)
+		copy(pred, fitted)
+		ret.R2 = rSquared(ys, pred)
+		ret.Equation = fmt.Sprintf("lowess span %.2g", f.Span)
+
+		order := make([]int, len(xs))
+		for idx := range order {
+			order[idx] = idx
+		}
+		sort.SliceStable(order, func(i, j int) bool { return xs[order[i]] < xs[order[j]] })
+		for _, idx := range order {
+			ret.Curve = append(ret.Curve, plotter.XY{X: xs[idx], Y: fitted[idx]})
+		}
+		return ret, nil
+	}
+
+	for idx, x := range xs {
+		pred[idx] = model(x)
+	}
+	ret.R2 = rSquared(ys, pred)
+	ret.Curve = sampleCurve(xs, model)
+	return ret, nil
+}
+
+// Label is the text of the fit in the legend
+func (r *fitResult) Label() string {
+	return fmt.Sprintf("%s (R² = %.3f)", r.Equation, r.R2)
+}
+
+// ToValue is the fit written into the sidecar file
+func (r *fitResult) ToValue() Value {
+	obj := NewObject()
+	obj.Value["Type"] = Value{Type: kValueTypeString, String: r.Type}
+	obj.Value["Equation"] = Value{Type: kValueTypeString, String: r.Equation}
+	obj.Value["R2"] = Value{Type: kValueTypeNumber, Number: r.R2}
+	obj.Value["N"] = Value{Type: kValueTypeNumber, Number: float64(r.N)}
+
+	coef := NewList()
+	for _, c := range r.Coefficients {
+		coef.Value = append(coef.Value, Value{Type: kValueTypeNumber, Number: c})
+	}
+	obj.Value["Coefficients"] = Value{Type: kValueTypeList, List: coef}
+	return Value{Type: kValueTypeObject, Object: obj}
+}
+
+func tricube(d float64) float64 {
+	if d >= 1 {
+		return 0
+	}
+	t := 1 - d*d*d
+	return t * t * t
+}
+
+// lowess returns the smoothed value at every x, following Cleveland's algorithm
+// with a local linear fit and bisquare robustness weights. Above kLowessPoints points
+// the fit is done on an even subsample of them and interpolated in between
+func lowess(xs, ys []float64, span float64) []float64 {
+	n := len(xs)
+	order := make([]int, n)
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool { return xs[order[i]] < xs[order[j]] })
+
+	stride := (n + kLowessPoints - 1) / kLowessPoints
+	sx, sy := []float64{}, []float64{}
+	for i := 0; i < n; i += stride {
+		sx = append(sx, xs[order[i]])
+		sy = append(sy, ys[order[i]])
+	}
+	if (n-1)%stride != 0 {
+		sx = append(sx, xs[order[n-1]])
+		sy = append(sy, ys[order[n-1]])
+	}
+	fitted := lowessSorted(sx, sy, span)
+
+	ret := make([]float64, n)
+	if stride == 1 {
+		for i, idx := range order {
+			ret[idx] = fitted[i]
+		}
+		return ret
+	}
+	for idx, x := range xs {
+		j := sort.SearchFloat64s(sx, x)
+		switch {
+		case j == 0:
+			ret[idx] = fitted[0]
+		case j == len(sx):
+			ret[idx] = fitted[len(sx)-1]
+		case sx[j] == x:
+			ret[idx] = fitted[j]
+		default:
+			t := (x - sx[j-1]) / (sx[j] - sx[j-1])
+			ret[idx] = fitted[j-1] + t*(fitted[j]-fitted[j-1])
+		}
+	}
+	return ret
+}
+
+// lowessSorted is lowess on points sorted by x. The k nearest points of a point are a
+// window around it, and x is taken relative to the point so large x like timestamps
+// keep their precision
+func lowessSorted(xs, ys []float64, span float64) []float64 {
+	n := len(xs)
+	k := int(math.Ceil(span * float64(n)))
+	if k < 2 {
+		k = 2
+	}
+	if k > n {
+		k = n
+	}
+
+	robust := make([]float64, n)
+	for idx := range robust {
+		robust[idx] = 1
+	}
+
+	fitted := make([]float64, n)
+
+	for iter := 0; iter <= kLowessIterations; iter++ {
+		lo := 0
+		for i := 0; i < n; i++ {
+			for lo+k < n && xs[i]-xs[lo] > xs[lo+k]-xs[i] {
+				lo++
+			}
+			h := math.Max(xs[i]-xs[lo], xs[lo+k-1]-xs[i])
+
+			var sw, sx, sy, sxx, sxy float64
+			for j := lo; j < lo+k; j++ {
+				d := xs[j] - xs[i]
+				w := robust[j]
+				if h > 0 {
+					w *= tricube(math.Abs(d) / h)
+				} else if d != 0 {
+					w = 0
+				}
+				sw += w
+				sx += w * d
+				sy += w * ys[j]
+				sxx += w * d * d
+				sxy += w * d * ys[j]
+			}
+
+			if sw == 0 {
+				fitted[i] = ys[i]
+				continue
+			}
+			mx, my := sx/sw, sy/sw
+			varx := sxx/sw - mx*mx
+			if varx <= 1e-12*h*h {
+				fitted[i] = my
+				continue
+			}
+			slope := (sxy/sw - mx*my) / varx
+			fitted[i] = my - slope*mx
+		}
+
+		if iter == kLowessIterations {
+			break
+		}
+
+		res := make([]float64, n)
+		for i := range res {
+			res[i] = math.Abs(ys[i] - fitted[i])
+		}
+		s := statPercentile(res, 50)
+		if s == 0 {
+			break
+		}
+		for i := range robust {
+			u := res[i] / (6 * s)
+			if u >= 1 {
+				robust[i] = 0
+			} else {
+				robust[i] = (1 - u*u) * (1 - u*u)
+			}
+		}
+	}
+	return fitted
+}
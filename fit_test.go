@@ -0,0 +1,174 @@
+package main
+
+import (
+	"gonum.org/v1/plot/plotter"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testPoints samples f at the xs
+func testPoints(xs []float64, f func(float64) float64) plotter.XYs {
+	pts := make(plotter.XYs, len(xs))
+	for idx, x := range xs {
+		pts[idx] = plotter.XY{X: x, Y: f(x)}
+	}
+	return pts
+}
+
+func TestFit(t *testing.T) {
+	xs := []float64{1, 2, 3, 4, 5, 6}
+
+	for _, c := range []struct {
+		fit      string
+		f        func(float64) float64
+		coef     []float64
+		equation string
+	}{
+		{`"linear"`, func(x float64) float64 { return 1 + 2*x }, []float64{1, 2}, "y = 2x + 1"},
+		{`"linear"`, func(x float64) float64 { return 3 - x }, []float64{3, -1}, "y = -1x + 3"},
+		{`{"Type": "poly", "Degree": 2}`, func(x float64) float64 { return x*x - 2*x + 3 }, []float64{3, -2, 1},
+			"y = 1x^2 - 2x + 3"},
+		{`{"Type": "poly", "Degree": 3}`, func(x float64) float64 { return 0.5*x*x*x + x*x - x + 2 },
+			[]float64{2, -1, 1, 0.5}, "y = 0.5x^3 + 1x^2 - 1x + 2"},
+		{`"exp"`, func(x float64) float64 { return 2 * math.Exp(0.5*x) }, []float64{2, 0.5}, "y = 2e^(0.5x)"},
+		{`"power"`, func(x float64) float64 { return 3 * math.Pow(x, 1.5) }, []float64{3, 1.5}, "y = 3x^1.5"},
+	} {
+		spec, err := parseFit(mustParseValue(t, c.fit))
+		if err != nil {
+			t.Errorf("fit %s is invalid, %v", c.fit, err)
+			continue
+		}
+		ret, err := spec.Fit(testPoints(xs, c.f))
+		if err != nil {
+			t.Errorf("fit %s failed, %v", c.fit, err)
+			continue
+		}
+		for idx := range c.coef {
+			if math.Abs(ret.Coefficients[idx]-c.coef[idx]) > 1e-6 {
+				t.Errorf("fit %s got coefficients %v, want %v", c.fit, ret.Coefficients, c.coef)
+				break
+			}
+		}
+		if ret.Equation != c.equation || math.Abs(ret.R2-1) > 1e-9 || ret.N != len(xs) {
+			t.Errorf("fit %s got %s with R2 %v of %d points, want %s with R2 1", c.fit, ret.Equation, ret.R2,
+				ret.N, c.equation)
+		}
+		if len(ret.Curve) != kFitSamples || ret.Curve[0].X != 1 || ret.Curve[kFitSamples-1].X != 6 {
+			t.Errorf("fit %s curve has %d points, want %d across the points", c.fit, len(ret.Curve), kFitSamples)
+		}
+	}
+}
+
+func TestFitTimestamps(t *testing.T) {
+	// the x of a day of minutes since the epoch, a fit on the raw powers of x is
+	// singular
+	xs := make([]float64, 1440)
+	for idx := range xs {
+		xs[idx] = 1.7e9 + 60*float64(idx)
+	}
+
+	for _, c := range []struct {
+		fit string
+		f   func(float64) float64
+	}{
+		{`"linear"`, func(x float64) float64 { return 5 + (x-1.7e9)/60 }},
+		{`{"Type": "poly", "Degree": 2}`, func(x float64) float64 { return math.Pow((x-1.7e9)/3600, 2) }},
+		{`{"Type": "lowess", "Span": 0.1}`, func(x float64) float64 { return (x - 1.7e9) / 60 }},
+	} {
+		spec, _ := parseFit(mustParseValue(t, c.fit))
+		ret, err := spec.Fit(testPoints(xs, c.f))
+		if err != nil {
+			t.Errorf("fit %s failed, %v", c.fit, err)
+			continue
+		}
+		if ret.R2 < 0.999999 {
+			t.Errorf("fit %s on timestamps got R2 %v, want 1", c.fit, ret.R2)
+		}
+		for _, p := range ret.Curve {
+			if want := c.f(p.X); math.Abs(p.Y-want) > 1e-3*math.Max(1, math.Abs(want)) {
+				t.Errorf("fit %s at %v got %v, want %v", c.fit, p.X, p.Y, want)
+				break
+			}
+		}
+	}
+}
+
+func TestLowess(t *testing.T) {
+	// a line with an outlier, the robustness weights keep the outlier from pulling
+	// the line towards it
+	xs := make([]float64, 50)
+	ys := make([]float64, 50)
+	for idx := range xs {
+		xs[idx] = float64(49 - idx)
+		ys[idx] = 2 * xs[idx]
+	}
+	ys[20] = 500
+
+	fitted := lowess(xs, ys, 0.5)
+	for idx := range xs {
+		if idx != 20 && math.Abs(fitted[idx]-2*xs[idx]) > 1e-6 {
+			t.Errorf("lowess at %v got %v, want %v", xs[idx], fitted[idx], 2*xs[idx])
+		}
+	}
+	if math.Abs(fitted[20]-2*xs[20]) > 1 {
+		t.Errorf("lowess at the outlier got %v, want about %v", fitted[20], 2*xs[20])
+	}
+
+	// a series longer than kLowessPoints is fitted on a subsample, every point still
+	// gets its value
+	n := 3*kLowessPoints + 7
+	xs, ys = make([]float64, n), make([]float64, n)
+	for idx := range xs {
+		xs[idx] = float64(idx) / 100
+		ys[idx] = math.Sin(xs[idx])
+	}
+	fitted = lowess(xs, ys, 0.01)
+	for idx := range xs {
+		if math.Abs(fitted[idx]-ys[idx]) > 1e-2 {
+			t.Errorf("lowess of %d points at %v got %v, want %v", n, xs[idx], fitted[idx], ys[idx])
+			break
+		}
+	}
+}
+
+func TestFitError(t *testing.T) {
+	for _, c := range []struct {
+		fit string
+		pts plotter.XYs
+		msg string
+	}{
+		{`"linear"`, plotter.XYs{{X: 1, Y: 1}}, "fit linear needs at least 2 points but got 1"},
+		{`"linear"`, plotter.XYs{{X: 1, Y: 1}, {X: math.NaN(), Y: 2}}, "needs at least 2 points but got 1"},
+		{`"linear"`, plotter.XYs{{X: 1, Y: 1}, {X: 1, Y: 2}}, "the points don't determine the fit"},
+		{`{"Type": "poly", "Degree": 3}`, plotter.XYs{{X: 1, Y: 1}, {X: 2, Y: 2}, {X: 3, Y: 1}},
+			"a degree 3 fit needs more than 3 points"},
+		{`"exp"`, plotter.XYs{{X: 1, Y: 1}, {X: 2, Y: -2}}, "fit exp needs positive y but got -2"},
+		{`"power"`, plotter.XYs{{X: 0, Y: 1}, {X: 2, Y: 2}}, "fit power needs positive x but got 0"},
+	} {
+		spec, _ := parseFit(mustParseValue(t, c.fit))
+		if _, err := spec.Fit(c.pts); err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("fit %s got error %v, want %q", c.fit, err, c.msg)
+		}
+	}
+}
+
+func TestParseFitError(t *testing.T) {
+	for _, c := range []struct {
+		fit string
+		msg string
+	}{
+		{`"spline"`, "fit spline is unknown, must be linear, poly, exp, power or lowess"},
+		{`3`, "value must be a string or an object but got type number"},
+		{`{"Degree": 2}`, "Type"},
+		{`{"Type": 1}`, `"Type" field is not a string`},
+		{`{"Type": "poly", "Degree": 0}`, `"Degree" field must be an integer between 1 and 10`},
+		{`{"Type": "poly", "Degree": 2.5}`, `"Degree" field must be an integer between 1 and 10`},
+		{`{"Type": "lowess", "Span": 0}`, `"Span" field must be a number in (0, 1]`},
+		{`{"Type": "lowess", "Span": 1.5}`, `"Span" field must be a number in (0, 1]`},
+	} {
+		if _, err := parseFit(mustParseValue(t, c.fit)); err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("fit %s got error %v, want %q", c.fit, err, c.msg)
+		}
+	}
+}
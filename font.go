@@ -0,0 +1,461 @@
+package main
+
+import (
+	"fmt"
+	"github.com/golang/freetype/truetype"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// The fonts gonum knows are the Liberation fonts under their Postscript names, ie
+// "Times-Roman" and "Helvetica", which have no glyph for CJK and a lot of symbols.
+// Other fonts are TTF files, or OTF files with TrueType outlines, loaded either by
+// their path or from the directory given by -fonts, where every file can be used by
+// its name without the extension as well as by the name inside of the font.
+//
+// "Font" of a config is a font, a list of them or an object with one for each kind of
+// text:
+//
+//	"Font": ["NotoSansSC-Regular", "fonts/DejaVuSans.ttf"]
+//	"Font": {"Title": "NotoSansSC-Bold", "Label": "NotoSansSC-Regular", "Tick": "Helvetica"}
+//
+// A list is a fallback chain, the font of the theme being the last resort. Every
+// character is drawn with the first font of the chain that has a glyph for it, so a
+// text can mix scripts no single font covers. Gonum lays out each text, ie the title
+// or the label of an axis, with one font: the first of the chain having every glyph
+// of the text, or the one missing the fewest. A font file given by a relative path
+// is found from the directory of the input, like the files of data sources
+
+var (
+	// the font files which are loaded, by their path
+	loadedFontFiles = map[string]bool{}
+)
+
+// isFontPath tells a font file apart from the name of a font
+func isFontPath(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".ttf" || ext == ".otf" || strings.ContainsRune(name, os.PathSeparator)
+}
+
+// LoadFontFile loads the font file and makes it usable by its path and by its names
+// which are not taken yet
+func LoadFontFile(path string) error {
+	if loadedFontFiles[path] {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// truetype only reads glyf outlines, the CFF ones of most .otf files start with
+	// their own tag
+	if len(data) >= 4 && string(data[:4]) == "OTTO" {
+		return fmt.Errorf("font %s has CFF outlines which are not supported, only TrueType "+
+			"outlines are", path)
+	}
+	font, err := truetype.Parse(data)
+	if err != nil {
+		return fmt.Errorf("font %s cannot be parsed, only TrueType outlines are supported, %v", path, err)
+	}
+
+	vg.AddFont(path, font)
+	loadedFontFiles[path] = true
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for _, name := range []string{
+		base,
+		font.Name(truetype.NameIDFontFullName),
+		font.Name(truetype.NameIDFontFamily),
+	} {
+		if name == "" {
+			continue
+		}
+		if _, err := vg.MakeFont(name, vg.Points(10)); err != nil {
+			vg.AddFont(name, font)
+		}
+	}
+	return nil
+}
+
+// LoadFontDir loads every font file under the directory. A file which cannot be
+// parsed is skipped and reported in the returned list
+func LoadFontDir(dir string) ([]error, error) {
+	skipped := []error{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".ttf" && ext != ".otf" {
+			return nil
+		}
+		if err := LoadFontFile(path); err != nil {
+			skipped = append(skipped, err)
+		}
+		return nil
+	})
+	return skipped, err
+}
+
+// CheckFont makes sure the font can be used, loading it when it is a path
+func CheckFont(name string) error {
+	if isFontPath(name) {
+		return LoadFontFile(name)
+	}
+	if _, err := vg.MakeFont(name, vg.Points(10)); err != nil {
+		return fmt.Errorf("font %s is unknown, %v", name, err)
+	}
+	return nil
+}
+
+// withFontDir makes the relative font files of a "Font" field start from dir, the
+// names of fonts are left as they are
+func withFontDir(v Value, dir string) Value {
+	switch v.Type {
+	case kValueTypeString:
+		if isFontPath(v.String) && !filepath.IsAbs(v.String) {
+			return Value{Type: kValueTypeString, String: filepath.Join(dir, v.String)}
+		}
+
+	case kValueTypeList:
+		list := NewList()
+		for _, x := range v.List.Value {
+			list.Value = append(list.Value, withFontDir(x, dir))
+		}
+		return Value{Type: kValueTypeList, List: list}
+
+	case kValueTypeObject:
+		obj := NewObject()
+		for k, x := range v.Object.Value {
+			obj.Value[k] = withFontDir(x, dir)
+		}
+		return Value{Type: kValueTypeObject, Object: obj}
+	}
+	return v
+}
+
+// FontChain is a list of fonts, tried in order
+type FontChain []string
+
+// ParseFontChain reads a font or a list of them, every font is checked
+func ParseFontChain(v Value) (FontChain, error) {
+	chain := FontChain{}
+	switch v.Type {
+	case kValueTypeString:
+		chain = append(chain, v.String)
+	case kValueTypeList:
+		for _, x := range v.List.Value {
+			if val, err := JsonGetString(x); err != nil {
+				return nil, fmt.Errorf("font must be a string but got type %s", x.Type.GetName())
+			} else {
+				chain = append(chain, val)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("font must be a string or a list of them but got type %s", v.Type.GetName())
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("font list must not be empty")
+	}
+	for _, x := range chain {
+		if err := CheckFont(x); err != nil {
+			return nil, err
+		}
+	}
+	return chain, nil
+}
+
+// missingGlyphs counts the characters of the texts the font has no glyph for,
+// spaces and control characters never have one
+func missingGlyphs(font *vg.Font, texts []string) int {
+	tt := font.Font()
+	if tt == nil {
+		return 0
+	}
+
+	n := 0
+	for _, text := range texts {
+		for _, r := range text {
+			if unicode.IsSpace(r) || unicode.IsControl(r) {
+				continue
+			}
+			if tt.Index(r) == 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Pick is the first font of the chain with every glyph of the texts, or the one that
+// misses the fewest when none of them has all. Gonum measures the texts with it
+func (fc FontChain) Pick(size vg.Length, texts ...string) (vg.Font, error) {
+	var best vg.Font
+	bestMissing := -1
+	for _, name := range fc {
+		font, err := vg.MakeFont(name, size)
+		if err != nil {
+			return font, fmt.Errorf("font %s cannot be loaded, %v", name, err)
+		}
+		missing := missingGlyphs(&font, texts)
+		if missing == 0 {
+			return font, nil
+		}
+		if bestMissing < 0 || missing < bestMissing {
+			best, bestMissing = font, missing
+		}
+	}
+	return best, nil
+}
+
+// Fallback is the text handler drawing every character with the first font of the
+// chain which has it
+func (fc FontChain) Fallback(size vg.Length) (draw.TextHandler, error) {
+	ft := fallbackText{}
+	for _, name := range fc {
+		font, err := vg.MakeFont(name, size)
+		if err != nil {
+			return nil, fmt.Errorf("font %s cannot be loaded, %v", name, err)
+		}
+		ft.fonts = append(ft.fonts, font)
+	}
+	return ft, nil
+}
+
+// fontRun is a piece of a line written with a single font
+type fontRun struct {
+	font vg.Font
+	text string
+}
+
+// fallbackText writes every character with the first of the fonts that has a glyph
+// for it, and with the font of the text style when none has. It is the plain text of
+// gonum split into runs of the same font
+type fallbackText struct {
+	fonts []vg.Font
+}
+
+// runs splits the line by the font of its characters, a space stays with the run it
+// is in
+func (ft fallbackText) runs(line string, font vg.Font) []fontRun {
+	fonts := []vg.Font{font}
+	for _, x := range ft.fonts {
+		x.Size = font.Size
+		fonts = append(fonts, x)
+	}
+
+	runs := []fontRun{}
+	cur, start := -1, 0
+	for idx, r := range line {
+		pick := cur
+		if !unicode.IsSpace(r) && !unicode.IsControl(r) || cur < 0 {
+			pick = 0
+			for n := 1; n < len(fonts); n++ {
+				if tt := fonts[n].Font(); tt != nil && tt.Index(r) != 0 {
+					pick = n
+					break
+				}
+			}
+		}
+		if pick != cur {
+			if cur >= 0 {
+				runs = append(runs, fontRun{fonts[cur], line[start:idx]})
+			}
+			cur, start = pick, idx
+		}
+	}
+	if cur >= 0 {
+		runs = append(runs, fontRun{fonts[cur], line[start:]})
+	}
+	return runs
+}
+
+// width is the width of the line written with its runs
+func (ft fallbackText) width(line string, font vg.Font) vg.Length {
+	w := vg.Length(0)
+	for _, run := range ft.runs(line, font) {
+		w += run.font.Width(run.text)
+	}
+	return w
+}
+
+// Box is the box of the text like plain text has, with the width of the runs
+func (ft fallbackText) Box(txt string, fnt vg.Font) (width, height, depth vg.Length) {
+	_, height, depth = draw.PlainTextHandler{}.Box(txt, fnt)
+	for _, line := range strings.Split(strings.TrimRight(txt, "\n"), "\n") {
+		if w := ft.width(line, fnt); w > width {
+			width = w
+		}
+	}
+	return width, height, depth
+}
+
+// Draw writes the text like plain text does, one run after another
+func (ft fallbackText) Draw(c *draw.Canvas, txt string, sty draw.TextStyle, pt vg.Point) {
+	txt = strings.TrimRight(txt, "\n")
+	if len(txt) == 0 {
+		return
+	}
+
+	c.SetColor(sty.Color)
+	if sty.Rotation != 0 {
+		c.Push()
+		c.Rotate(sty.Rotation)
+	}
+
+	cos := vg.Length(math.Cos(sty.Rotation))
+	sin := vg.Length(math.Sin(sty.Rotation))
+	pt.X, pt.Y = pt.Y*sin+pt.X*cos, pt.Y*cos-pt.X*sin
+
+	lines := strings.Split(txt, "\n")
+	pt.Y += sty.Height(txt)*vg.Length(sty.YAlign) - sty.Font.Extents().Ascent
+	for idx, line := range lines {
+		at := pt.Add(vg.Point{
+			X: vg.Length(sty.XAlign) * ft.width(line, sty.Font),
+			Y: vg.Length(len(lines)-idx) * sty.Font.Size,
+		})
+		for _, run := range ft.runs(line, sty.Font) {
+			c.FillString(run.font, at, run.text)
+			at.X += run.font.Width(run.text)
+		}
+	}
+
+	if sty.Rotation != 0 {
+		c.Pop()
+	}
+}
+
+// textWidth is the widest line of the text as the handler of the style writes it
+func textWidth(sty draw.TextStyle, txt string) vg.Length {
+	if ft, ok := sty.Handler.(fallbackText); ok {
+		w, _, _ := ft.Box(txt, sty.Font)
+		return w
+	}
+	return sty.Width(txt)
+}
+
+// FontConfig is the "Font" block of a config, the chains of each kind of text. A nil
+// chain is the font of the theme
+type FontConfig struct {
+	Title  FontChain
+	Label  FontChain
+	Tick   FontChain
+	Legend FontChain
+}
+
+// ParseFontConfig reads a font, a list of fonts or an object with one for each kind
+// of text
+func ParseFontConfig(v Value) (*FontConfig, error) {
+	if v.Type != kValueTypeObject {
+		chain, err := ParseFontChain(v)
+		if err != nil {
+			return nil, err
+		}
+		return &FontConfig{Title: chain, Label: chain, Tick: chain, Legend: chain}, nil
+	}
+
+	fc := &FontConfig{}
+	for _, x := range []struct {
+		keys []string
+		ptr  *FontChain
+	}{
+		{[]string{"Title", "title"}, &fc.Title},
+		{[]string{"Label", "label"}, &fc.Label},
+		{[]string{"Tick", "tick"}, &fc.Tick},
+		{[]string{"Legend", "legend"}, &fc.Legend},
+	} {
+		if t, err := JsonObjectGetMultipleKey(v, x.keys...); err == nil {
+			if chain, err := ParseFontChain(t); err != nil {
+				return nil, fmt.Errorf("\"%s\" field is invalid, %v", x.keys[0], err)
+			} else {
+				*x.ptr = chain
+			}
+		}
+	}
+	return fc, nil
+}
+
+// texter is implemented by the plotters which write text, so their text is taken
+// into account when the font of the legend is picked
+type texter interface {
+	Texts() []string
+}
+
+// pickFont sets the font of the text style to the one of the chain for the texts and
+// its handler to the fallback through the chain, the font of the theme ends it
+func (c *Chart) pickFont(chain FontChain, sty *draw.TextStyle, texts ...string) error {
+	if chain == nil {
+		return nil
+	}
+	chain = append(append(FontChain{}, chain...), c.Theme.Font)
+	font, err := chain.Pick(sty.Font.Size, texts...)
+	if err != nil {
+		return err
+	}
+	handler, err := chain.Fallback(font.Size)
+	if err != nil {
+		return err
+	}
+	sty.Font, sty.Handler = font, handler
+	return nil
+}
+
+// applyFonts picks the fonts of the texts once the chart has all of them
+func (c *Chart) applyFonts() error {
+	for _, row := range c.Panels {
+		for _, panel := range row {
+			if panel == nil {
+				continue
+			}
+			if err := panel.applyFonts(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.Fonts == nil {
+		return nil
+	}
+	if err := c.pickFont(c.Fonts.Title, &c.Plot.Title.TextStyle, c.Plot.Title.Text); err != nil {
+		return err
+	}
+	if c.Panels != nil {
+		return nil
+	}
+
+	for _, axis := range c.axes() {
+		if err := c.pickFont(c.Fonts.Label, &axis.Label.TextStyle, axis.Label.Text); err != nil {
+			return err
+		}
+		ticks := []string{}
+		if axis.Tick.Marker != nil {
+			for _, t := range axis.Tick.Marker.Ticks(axis.Min, axis.Max) {
+				ticks = append(ticks, t.Label)
+			}
+		}
+		if err := c.pickFont(c.Fonts.Tick, &axis.Tick.Label, ticks...); err != nil {
+			return err
+		}
+	}
+
+	texts := []string{}
+	for _, e := range c.legendEntries() {
+		texts = append(texts, e.Name)
+	}
+	for _, x := range c.decorations {
+		if t, ok := x.(texter); ok {
+			texts = append(texts, t.Texts()...)
+		}
+	}
+	return c.pickFont(c.Fonts.Legend, &c.Plot.Legend.TextStyle, texts...)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// "ForEach" turns one job into a job for each of its items, the items are either a
+// list of values or a glob of files:
+//
+//	{
+//	    "ForEach": ["api", "auth", "billing"],
+//	    "Type": "dot-plotter", "Path": "latency-${item}.png",
+//	    "Config": {"Title": "Latency of ${item}", "Data": {"Query": "latency.${item}", ...}}
+//	}
+//
+//	{"ForEach": "data/*.csv", "Path": "out/${item.stem}.png", ...}
+//
+// ${item} is the item and ${index} its position in the list starting from 0. An item
+// which is an object or a list is walked into by a path, ie ${item.name} for
+// {"name": "api"}. The file of a glob has ${item.name} for its base name, ${item.stem}
+// for the base name without the extension and ${item.dir} for its directory. A glob
+// is relative to the directory of the input like the files of data sources, and so
+// are its files. An empty list is an error rather than dropping the job.
+//
+// The jobs are expanded in place before they are run, so every job of an expansion has
+// its own index
+
+// forEachItems reads the items of "ForEach", the files of a glob are sorted
+func forEachItems(v Value, dir string) ([]Value, error) {
+	switch v.Type {
+	case kValueTypeList:
+		return v.List.Value, nil
+
+	case kValueTypeString:
+		pattern := v.String
+		if dir != "" && !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("glob %s is invalid, %v", v.String, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("glob %s matches no file", v.String)
+		}
+		sort.Strings(files)
+
+		items := []Value{}
+		for _, x := range files {
+			if pattern != v.String {
+				if rel, err := filepath.Rel(dir, x); err == nil {
+					x = rel
+				}
+			}
+			items = append(items, Value{Type: kValueTypeString, String: x})
+		}
+		return items, nil
+
+	default:
+		return nil, fmt.Errorf("must be a list or a glob but got type %s", v.Type.GetName())
+	}
+}
+
+// expandForEach expands the jobs with "ForEach" and replaces the variables of
+// "ForEach" left in every job, dir is where a glob starts
+func expandForEach(jobs []Value, dir string) ([]Value, error) {
+	ret := []Value{}
+	for idx, job := range jobs {
+		t, err := JsonObjectGetMultipleKey(job, "ForEach", "foreach")
+		if err != nil {
+			if x, err := newLoopScope(nil, 0).substitute(job); err != nil {
+				return nil, fmt.Errorf("index %d,%v", idx, err)
+			} else {
+				ret = append(ret, x)
+			}
+			continue
+		}
+
+		items, err := forEachItems(t, dir)
+		if err != nil {
+			return nil, fmt.Errorf("index %d,\"ForEach\" field is invalid, %v", idx, err)
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("index %d,\"ForEach\" field has no item", idx)
+		}
+
+		body := NewObject()
+		for k, x := range job.Object.Value {
+			if k != "ForEach" && k != "foreach" {
+				body.Value[k] = x
+			}
+		}
+
+		for n := range items {
+			x, err := newLoopScope(&items[n], n).substitute(Value{Type: kValueTypeObject, Object: body})
+			if err != nil {
+				return nil, fmt.Errorf("index %d,\"ForEach\" item %d, %v", idx, n, err)
+			}
+			ret = append(ret, x)
+		}
+	}
+	return ret, nil
+}
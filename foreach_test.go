@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandForEach(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"data/b.csv": "",
+		"data/a.csv": "",
+	})
+	data := filepath.Join(dir, "data")
+
+	for _, c := range []struct {
+		jobs string
+		dir  string
+		want string
+	}{
+		{`[{"ForEach": ["api", "web"], "Path": "${item}-${index}.png"}]`, "",
+			`[{"Path": "api-0.png"}, {"Path": "web-1.png"}]`},
+		{`[{"ForEach": [{"name": "api", "p": 99}], "Path": "${item.name}.png", "Config": {"Y": "${item.p}"}}]`, "",
+			`[{"Path": "api.png", "Config": {"Y": 99}}]`},
+		{`[{"Path": "a.png"}, {"foreach": [1, 2], "Path": "${item}.png"}, {"Path": "$${item}.png"}]`, "",
+			`[{"Path": "a.png"}, {"Path": "1.png"}, {"Path": "2.png"}, {"Path": "${item}.png"}]`},
+		{`[{"ForEach": "` + filepath.Join(data, "*.csv") + `", "Path": "out/${item.stem}.png",
+		    "Config": {"Data": {"${item.name}": {"File": "${item}"}}, "Title": "${item.dir}"}}]`, "",
+			`[{"Path": "out/a.png", "Config": {"Data": {"${item.name}": {"File": "` + filepath.Join(data, "a.csv") + `"}},
+			   "Title": "` + data + `"}},
+			  {"Path": "out/b.png", "Config": {"Data": {"${item.name}": {"File": "` + filepath.Join(data, "b.csv") + `"}},
+			   "Title": "` + data + `"}}]`},
+		// a glob relative to the input gives its files relative to the input too
+		{`[{"ForEach": "data/*.csv", "Path": "out/${item.stem}.png",
+		    "Config": {"Data": {"${item.name}": {"File": "${item}"}}, "Title": "${item.dir}"}}]`, dir,
+			`[{"Path": "out/a.png", "Config": {"Data": {"${item.name}": {"File": "data/a.csv"}}, "Title": "data"}},
+			  {"Path": "out/b.png", "Config": {"Data": {"${item.name}": {"File": "data/b.csv"}}, "Title": "data"}}]`},
+	} {
+		jobs := mustParseJson(t, c.jobs)
+		got, err := expandForEach(jobs.List.Value, c.dir)
+		if err != nil {
+			t.Errorf("jobs %s failed, %v", c.jobs, err)
+			continue
+		}
+		want := mustParseJson(t, c.want)
+		if list := (Value{Type: kValueTypeList, List: &List{Value: got}}); !sameJson(list, want) {
+			t.Errorf("jobs %s got %s, want %s", c.jobs, list.ToJson(), want.ToJson())
+		}
+	}
+}
+
+func TestExpandForEachError(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"data/a.csv": ""})
+
+	for _, c := range []struct {
+		jobs string
+		msg  string
+	}{
+		{`[{"Path": "a.png"}, {"ForEach": "data/*.tsv"}]`,
+			`index 1,"ForEach" field is invalid, glob data/*.tsv matches no file`},
+		{`[{"ForEach": "data/[.csv"}]`, `index 0,"ForEach" field is invalid, glob data/[.csv is invalid`},
+		{`[{"ForEach": 5}]`, `index 0,"ForEach" field is invalid, must be a list or a glob but got type number`},
+		{`[{"ForEach": []}]`, `index 0,"ForEach" field has no item`},
+		{`[{"ForEach": [{"a": 1}], "Path": "${item.b}"}]`,
+			`index 0,"ForEach" item 0, around 1,35, variable item.b, path b, key b doesn't exist`},
+		{`[{"Path": "${item}.png"}]`, `variable item is only defined in a job with "ForEach"`},
+	} {
+		jobs := mustParseJson(t, c.jobs)
+		if _, err := expandForEach(jobs.List.Value, dir); err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("jobs %s got error %v, want %q", c.jobs, err, c.msg)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot/vg"
+	"math"
+	"sort"
+)
+
+// gridPlotter lays out multiple charts into rows and columns of one canvas. The
+// panels are either listed explicitly under "Panels", each one with its own "Type"
+// and "Config", or generated by "Facet" which splits one object field of a config
+// into small multiples that always share their scales
+type gridPlotter struct{}
+
+func (g *gridPlotter) GetName() string { return "grid-plotter" }
+
+func (g *gridPlotter) Summary() string {
+	return "lays out the charts of other plotters into rows and columns"
+}
+
+func (g *gridPlotter) Options() []OptionDoc {
+	return []OptionDoc{
+		{"Title", "string", "", "the title of the whole grid"},
+		{"Size", "number", "3", "the width and the height of a panel in inches"},
+		{"Rows", "number", "", "the number of rows, picked from the number of panels when not given"},
+		{"Cols", "number", "", "the number of columns, picked from the number of panels when not given"},
+		{"ShareX", "boolean", "false", "gives every panel the same X range"},
+		{"ShareY", "boolean", "false", "gives every panel the same Y range"},
+		{"Panels", "list", "", "the panels, each one an object with \"Type\" and \"Config\""},
+		{"Facet", "object", "", "splits the field \"By\" of one \"Config\" into a panel for each of its entries"},
+	}
+}
+
+type gridPanel struct {
+	plotter Plotter
+	config  Value
+}
+
+func (g *gridPlotter) parsePanels(v Value) ([]gridPanel, error) {
+	if v.Type != kValueTypeList {
+		return nil, fmt.Errorf("\"grid-plotter\" field \"Panels\" must be a list but got type %s", v.Type.GetName())
+	}
+
+	panels := []gridPanel{}
+	for idx, x := range v.List.Value {
+		t, err := JsonObjectGetMultipleKey(x, "Type", "type")
+		if err != nil {
+			return nil, fmt.Errorf("\"grid-plotter\" panel %d,%v", idx, err)
+		}
+
+		name, err := JsonGetString(t)
+		if err != nil {
+			return nil, fmt.Errorf("\"grid-plotter\" panel %d,\"Type\" field is not a string", idx)
+		}
+
+		plotter := NewPlotter(name)
+		if plotter == nil {
+			return nil, fmt.Errorf("\"grid-plotter\" panel %d,plotter %s doesn't support", idx, name)
+		}
+		if plotter.GetName() == g.GetName() {
+			return nil, fmt.Errorf("\"grid-plotter\" panel %d,grid-plotter cannot be nested", idx)
+		}
+
+		config, err := JsonObjectGetMultipleKey(x, "Config", "config")
+		if err != nil {
+			return nil, fmt.Errorf("\"grid-plotter\" panel %d,%v", idx, err)
+		}
+
+		panels = append(panels, gridPanel{plotter: plotter, config: config})
+	}
+
+	return panels, nil
+}
+
+// parseFacet splits the field named by "By" of the facet's config into one panel per
+// entry. Each panel gets a copy of the config whose field only has that entry, and the
+// name of the entry becomes the title of the panel
+func (g *gridPlotter) parseFacet(v Value) ([]gridPanel, error) {
+	if v.Type != kValueTypeObject {
+		return nil, fmt.Errorf("\"grid-plotter\" field \"Facet\" must be an object but got type %s", v.Type.GetName())
+	}
+
+	var plotter Plotter
+	by := "Data"
+
+	if t, err := JsonObjectGetMultipleKey(v, "Type", "type"); err != nil {
+		return nil, fmt.Errorf("\"grid-plotter\" facet %v", err)
+	} else {
+		if name, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"grid-plotter\" facet \"Type\" field is not a string")
+		} else {
+			plotter = NewPlotter(name)
+			if plotter == nil {
+				return nil, fmt.Errorf("\"grid-plotter\" facet plotter %s doesn't support", name)
+			}
+			if plotter.GetName() == g.GetName() {
+				return nil, fmt.Errorf("\"grid-plotter\" facet cannot be a grid-plotter")
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "By", "by"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"grid-plotter\" facet \"By\" field is not a string")
+		} else {
+			by = val
+		}
+	}
+
+	config, err := JsonObjectGetMultipleKey(v, "Config", "config")
+	if err != nil {
+		return nil, fmt.Errorf("\"grid-plotter\" facet %v", err)
+	}
+
+	field, err := JsonObjectGet(config, by)
+	if err != nil {
+		return nil, fmt.Errorf("\"grid-plotter\" facet config %v", err)
+	}
+	if field.Type != kValueTypeObject {
+		return nil, fmt.Errorf("\"grid-plotter\" facet field \"%s\" must be an object but got type %s",
+			by, field.Type.GetName())
+	}
+
+	keys := []string{}
+	for k := range field.Object.Value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	panels := []gridPanel{}
+	for _, k := range keys {
+		split := NewObject()
+		split.Value[k] = field.Object.Value[k]
+
+		obj := NewObject()
+		for ck, cv := range config.Object.Value {
+			obj.Value[ck] = cv
+		}
+		obj.Value[by] = Value{Type: kValueTypeObject, Object: split}
+		obj.Value["Title"] = Value{Type: kValueTypeString, String: k}
+		delete(obj.Value, "title")
+
+		panels = append(panels, gridPanel{
+			plotter: plotter,
+			config:  Value{Type: kValueTypeObject, Object: obj},
+		})
+	}
+
+	return panels, nil
+}
+
+func (g *gridPlotter) Render(data Value) (*Chart, error) {
+	title := ""
+	size := 3.0
+	rows := 0
+	cols := 0
+	shareX := false
+	shareY := false
+
+	if v, err := JsonObjectGetMultipleKey(data, "Title", "title"); err == nil {
+		if val, err := JsonGetString(v); err == nil {
+			title = val
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Size", "size"); err == nil {
+		if val, err := JsonGetNumber(v); err == nil {
+			size = val
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Rows", "rows"); err == nil {
+		if val, err := JsonGetNumber(v); err == nil {
+			rows = int(val)
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Cols", "cols"); err == nil {
+		if val, err := JsonGetNumber(v); err == nil {
+			cols = int(val)
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "ShareX", "sharex"); err == nil {
+		if val, err := JsonGetBoolean(v); err == nil {
+			shareX = val
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "ShareY", "sharey"); err == nil {
+		if val, err := JsonGetBoolean(v); err == nil {
+			shareY = val
+		}
+	}
+
+	var panels []gridPanel
+	if v, err := JsonObjectGetMultipleKey(data, "Panels", "panels"); err == nil {
+		if panels, err = g.parsePanels(v); err != nil {
+			return nil, err
+		}
+	} else if v, err := JsonObjectGetMultipleKey(data, "Facet", "facet"); err == nil {
+		if panels, err = g.parseFacet(v); err != nil {
+			return nil, err
+		}
+		shareX = true
+		shareY = true
+	} else {
+		return nil, fmt.Errorf("\"grid-plotter\" needs either a \"Panels\" or a \"Facet\" field")
+	}
+
+	if len(panels) == 0 {
+		return nil, fmt.Errorf("\"grid-plotter\" doesn't have any panel")
+	}
+
+	// the panels follow the theme and the fonts of the grid unless they have their own
+	for _, keys := range [][]string{{"Theme", "theme"}, {"Font", "font"}} {
+		if v, err := JsonObjectGetMultipleKey(data, keys...); err == nil {
+			for idx := range panels {
+				panels[idx].config = JsonObjectWithDefault(panels[idx].config, v, keys...)
+			}
+		}
+	}
+
+	// figure out the layout, prefer a square looking grid when it is not specified
+	if cols <= 0 && rows <= 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(len(panels)))))
+	}
+	if cols <= 0 {
+		cols = (len(panels) + rows - 1) / rows
+	}
+	if rows <= 0 || rows*cols < len(panels) {
+		rows = (len(panels) + cols - 1) / cols
+	}
+
+	charts := []*Chart{}
+	for idx, panel := range panels {
+		chart, err := RenderChart(panel.plotter, panel.config)
+		if err != nil {
+			return nil, fmt.Errorf("\"grid-plotter\" panel %d,%v", idx, err)
+		}
+		charts = append(charts, chart)
+	}
+
+	if shareX {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, c := range charts {
+			min = math.Min(min, c.Plot.X.Min)
+			max = math.Max(max, c.Plot.X.Max)
+		}
+		for idx, c := range charts {
+			c.Plot.X.Min = min
+			c.Plot.X.Max = max
+			// only the bottom row keeps the label of the shared axis
+			if idx+cols < len(charts) {
+				c.Plot.X.Label.Text = ""
+			}
+		}
+	}
+
+	if shareY {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, c := range charts {
+			min = math.Min(min, c.Plot.Y.Min)
+			max = math.Max(max, c.Plot.Y.Max)
+		}
+		for idx, c := range charts {
+			c.Plot.Y.Min = min
+			c.Plot.Y.Max = max
+			// only the left column keeps the label of the shared axis
+			if idx%cols != 0 {
+				c.Plot.Y.Label.Text = ""
+			}
+		}
+	}
+
+	chart, err := NewChart(data, size)
+	if err != nil {
+		return nil, fmt.Errorf("\"grid-plotter\" cannot create plot due to reason %v", err)
+	}
+	chart.Plot.Title.Text = title
+	chart.Width *= vg.Length(cols)
+	chart.Height *= vg.Length(rows)
+
+	chart.Panels = make([][]*Chart, rows)
+	for r := 0; r < rows; r++ {
+		chart.Panels[r] = make([]*Chart, cols)
+		for c := 0; c < cols; c++ {
+			if idx := r*cols + c; idx < len(charts) {
+				chart.Panels[r][c] = charts[idx]
+			}
+		}
+	}
+
+	return chart, nil
+}
+
+func init() {
+	PlotterFactory["grid-plotter"] = &gridPlotter{}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot/plotter"
+	"image/color"
+	"math"
+)
+
+// histBins decides the bin edges of a histogram. "Bins" is either a count, the name
+// of a rule picking the count from the sample, or the explicit list of edges:
+//
+//   - "sturges", "sqrt", "scott", "fd" (Freedman-Diaconis) and "doane"
+//   - "auto", the smaller width of fd and sturges, which copes with both small
+//     samples and outliers
+//
+// "BinWidth" fixes the width instead, and "LogBins" spaces the bins evenly on a log
+// scale which suits heavy tailed data like latencies. With "LogBins" the width is the
+// ratio between two edges, ie 2 doubles every edge
+type histBins struct {
+	Count int
+	Rule  string
+	Edges []float64
+	Width float64
+	Log   bool
+}
+
+const (
+	kDefaultBins = 8
+
+	// a rule on a sample with a few huge outliers can ask for millions of bins
+	kMaxBins = 1000
+)
+
+func parseHistBins(data Value) (*histBins, error) {
+	b := &histBins{Count: kDefaultBins}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Bins", "bins"); err == nil {
+		switch v.Type {
+		case kValueTypeNumber:
+			if v.Number < 1 || v.Number != math.Floor(v.Number) {
+				return nil, fmt.Errorf("\"Bins\" %v must be a positive integer", v.Number)
+			}
+			b.Count = int(v.Number)
+
+		case kValueTypeString:
+			switch v.String {
+			case "auto", "sturges", "sqrt", "scott", "fd", "doane":
+				b.Rule = v.String
+			default:
+				return nil, fmt.Errorf("\"Bins\" rule %s is unknown, must be auto, sturges, sqrt, scott, fd or doane",
+					v.String)
+			}
+
+		case kValueTypeList:
+			for idx, x := range v.List.Value {
+				val, err := JsonGetNumber(x)
+				if err != nil {
+					return nil, fmt.Errorf("\"Bins\" edge %d is not a number", idx)
+				}
+				if idx != 0 && val <= b.Edges[idx-1] {
+					return nil, fmt.Errorf("\"Bins\" edges must be increasing but edge %d (%v) is not greater "+
+						"than edge %d (%v)", idx, val, idx-1, b.Edges[idx-1])
+				}
+				b.Edges = append(b.Edges, val)
+			}
+			if len(b.Edges) < 2 {
+				return nil, fmt.Errorf("\"Bins\" needs at least 2 edges but got %d", len(b.Edges))
+			}
+
+		default:
+			return nil, fmt.Errorf("\"Bins\" field must be a number, a rule or a list of edges but got type %s",
+				v.Type.GetName())
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "BinWidth", "binwidth"); err == nil {
+		if val, err := JsonGetNumber(v); err != nil || val <= 0 {
+			return nil, fmt.Errorf("\"BinWidth\" field must be a positive number")
+		} else {
+			b.Width = val
+		}
+		if b.Edges != nil {
+			return nil, fmt.Errorf("\"BinWidth\" cannot be used together with a list of edges in \"Bins\"")
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "LogBins", "logbins"); err == nil {
+		if val, err := JsonGetBoolean(v); err != nil {
+			return nil, fmt.Errorf("\"LogBins\" field is not a boolean")
+		} else {
+			b.Log = val
+		}
+		if b.Log && b.Edges != nil {
+			return nil, fmt.Errorf("\"LogBins\" cannot be used together with a list of edges in \"Bins\"")
+		}
+
+		// on a log scale the width is the ratio between two edges
+		if b.Log && b.Width > 0 && b.Width <= 1 {
+			return nil, fmt.Errorf("\"BinWidth\" is the ratio between two edges with \"LogBins\" and must be "+
+				"greater than 1 but got %v", b.Width)
+		}
+	}
+
+	return b, nil
+}
+
+// ruleCount is the number of bins the rule gives for the sample
+func ruleCount(rule string, xs []float64) int {
+	n := float64(len(xs))
+	span := statMax(xs) - statMin(xs)
+
+	fromWidth := func(h float64) int {
+		if h <= 0 || math.IsNaN(h) {
+			return 0
+		}
+		return int(math.Ceil(span / h))
+	}
+
+	sturges := int(math.Ceil(math.Log2(n))) + 1
+	fd := fromWidth(2 * (statPercentile(xs, 75) - statPercentile(xs, 25)) * math.Pow(n, -1.0/3))
+
+	var k int
+	switch rule {
+	case "sturges":
+		k = sturges
+	case "sqrt":
+		k = int(math.Ceil(math.Sqrt(n)))
+	case "scott":
+		k = fromWidth(3.49 * statStdDev(xs) * math.Pow(n, -1.0/3))
+	case "fd":
+		k = fd
+	case "doane":
+		k = sturges
+		if sd := statStdDev(xs); n > 2 && sd > 0 {
+			mean := statMean(xs)
+			skew := 0.0
+			for _, x := range xs {
+				skew += math.Pow((x-mean)/sd, 3)
+			}
+			skew /= n
+			sigma := math.Sqrt(6 * (n - 2) / ((n + 1) * (n + 3)))
+			k = int(math.Ceil(1 + math.Log2(n) + math.Log2(1+math.Abs(skew)/sigma)))
+		}
+	default:
+		// auto, fd gives more bins on large samples, sturges on small ones
+		k = sturges
+		if fd > k {
+			k = fd
+		}
+	}
+
+	if k < 1 {
+		k = sturges
+	}
+	if k > kMaxBins {
+		k = kMaxBins
+	}
+	return k
+}
+
+// edges computes the bin edges for the sample, the sample is never empty
+func (b *histBins) edges(xs []float64) ([]float64, error) {
+	if b.Edges != nil {
+		return b.Edges, nil
+	}
+
+	if b.Log {
+		logs := make([]float64, len(xs))
+		for idx, x := range xs {
+			if x <= 0 {
+				return nil, fmt.Errorf("\"LogBins\" needs positive data but got %v", x)
+			}
+			logs[idx] = math.Log10(x)
+		}
+		edges := b.linearEdges(logs, b.Width > 0)
+		for idx := range edges {
+			edges[idx] = math.Pow(10, edges[idx])
+		}
+
+		// the round trip through log10 must not leave the extremes out
+		edges[0] = math.Min(edges[0], statMin(xs))
+		edges[len(edges)-1] = math.Max(edges[len(edges)-1], statMax(xs))
+		return edges, nil
+	}
+	return b.linearEdges(xs, false), nil
+}
+
+// linearEdges spaces the edges evenly. With a log scale the width is taken as the
+// ratio between two edges
+func (b *histBins) linearEdges(xs []float64, logWidth bool) []float64 {
+	min, max := statMin(xs), statMax(xs)
+	if min == max {
+		min -= 0.5
+		max += 0.5
+	}
+
+	if b.Width > 0 {
+		width := b.Width
+		if logWidth {
+			width = math.Log10(width)
+		}
+		if width > 0 {
+			start := math.Floor(min/width) * width
+			count := int(math.Ceil((max - start) / width))
+			if count < 1 {
+				count = 1
+			}
+			if count <= kMaxBins {
+				edges := make([]float64, count+1)
+				for idx := range edges {
+					edges[idx] = start + float64(idx)*width
+				}
+				return edges
+			}
+		}
+	}
+
+	count := b.Count
+	if b.Rule != "" {
+		count = ruleCount(b.Rule, xs)
+	}
+
+	edges := make([]float64, count+1)
+	for idx := range edges {
+		edges[idx] = min + (max-min)*float64(idx)/float64(count)
+	}
+	return edges
+}
+
+// newHistogram counts the sample into the bins, a value falls into [min, max) of a
+// bin except for the last one which includes its max. Values outside of the edges
+// are not counted, the number of counted values is returned
+func newHistogram(xs []float64, edges []float64) (*plotter.Histogram, int) {
+	bins := make([]plotter.HistogramBin, len(edges)-1)
+	for idx := range bins {
+		bins[idx].Min = edges[idx]
+		bins[idx].Max = edges[idx+1]
+	}
+
+	counted := 0
+	last := edges[len(edges)-1]
+	for _, x := range xs {
+		if x < edges[0] || x > last {
+			continue
+		}
+
+		// the first edge greater than x
+		lo, hi := 0, len(edges)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if edges[mid] > x {
+				hi = mid
+			} else {
+				lo = mid + 1
+			}
+		}
+		idx := lo - 1
+		if idx >= len(bins) {
+			idx = len(bins) - 1
+		}
+		bins[idx].Weight++
+		counted++
+	}
+
+	return &plotter.Histogram{
+		Bins:      bins,
+		Width:     (last - edges[0]) / float64(len(bins)),
+		FillColor: color.Gray{Y: 128},
+		LineStyle: plotter.DefaultLineStyle,
+	}, counted
+}
@@ -2,22 +2,50 @@ package main
 
 import (
 	"fmt"
-	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/vg"
+	"image/color"
+	"math"
+	"sort"
 )
 
 type histPlotter struct{}
 
 func (h *histPlotter) GetName() string { return "hist-plotter" }
 
-func (h *histPlotter) Plot(path string, data Value) error {
+func (h *histPlotter) Summary() string {
+	return "draws the distribution of each sample as a histogram"
+}
+
+func (h *histPlotter) Options() []OptionDoc {
+	return []OptionDoc{
+		{"Title", "string", "plot", "the title of the chart"},
+		{"X", "string", "X", "the label of the X axis"},
+		{"Y", "string", "Y", "the label of the Y axis"},
+		{"Grids", "boolean", "false", "draws grid lines"},
+		{"Size", "number", "4", "the width and the height of the chart in inches"},
+		{"Data", "list|object", "", "a sample of numbers, or the samples by name, each one a list or an object with \"Data\" and \"Color\""},
+		{"Bins", "number|string|list", "8", "the number of bins, a rule like auto or fd, or the list of edges"},
+		{"BinWidth", "number", "", "the width of a bin, instead of the number of them, with LogBins the ratio between two edges greater than 1"},
+		{"LogBins", "boolean", "false", "spaces the bins evenly on a log scale"},
+		{"Normalize", "boolean|string", kHistDensity, "count, density or probability"},
+		{"Cumulative", "boolean", "false", "accumulates the bins from left to right"},
+		{"Mean", "boolean", "false", "marks the mean of each sample"},
+		{"Median", "boolean", "false", "marks the median of each sample"},
+		{"Percentiles", "list", "", "marks the percentiles of each sample, between 0 and 100"},
+		{"Curve", "string", "", "normal or kde, a density curve drawn over the bins"},
+		{"StatsBox", "boolean", "false", "writes the count, mean and deviation of each sample"},
+		{"Style", "string", kHistOverlay, "overlay draws translucent bars, step only the outline of the bins"},
+		{"Alpha", "number", "0.5", "the opacity of the overlaid bars"},
+	}
+}
+
+func (h *histPlotter) Render(data Value) (*Chart, error) {
 	title := "plot"
 	xlabel := "X"
 	ylabel := "Y"
 	size := 4.0
 	grids := false
-	bins := 8
 
 	if v, err := JsonObjectGetMultipleKey(data, "Title", "title"); err == nil {
 		if val, err := JsonGetString(v); err == nil {
@@ -49,48 +77,168 @@ func (h *histPlotter) Plot(path string, data Value) error {
 		}
 	}
 
-	if v, err := JsonObjectGetMultipleKey(data, "Bins", "bins"); err == nil {
-		if val, err := JsonGetNumber(v); err == nil {
-			bins = int(val)
-		}
+	bins, err := parseHistBins(data)
+	if err != nil {
+		return nil, fmt.Errorf("\"hist-plotter\" %v", err)
+	}
+
+	opt, err := parseHistOptions(data)
+	if err != nil {
+		return nil, fmt.Errorf("\"hist-plotter\" %v", err)
 	}
 
-	p, err := plot.New()
+	chart, err := NewChart(data, size)
 	if err != nil {
-		return fmt.Errorf("\"hist-plotter\" cannot create plot due to reason %v", err)
+		return nil, fmt.Errorf("\"hist-plotter\" cannot create plot due to reason %v", err)
 	}
+	p := chart.Plot
 	p.Title.Text = title
 	p.X.Label.Text = xlabel
 	p.Y.Label.Text = ylabel
 	if grids {
-		p.Add(plotter.NewGrid())
+		chart.Add(chart.NewGrid())
 	}
 
-	var vals *plotter.Values
+	var names []string
+	var samples []plotter.Values
+	var colors []Value
 
 	if v, err := JsonObjectGetMultipleKey(data, "Data", "data"); err != nil {
-		return fmt.Errorf("\"hist-plotter\" cannot get \"Data\" field due to reason %v", err)
+		return nil, fmt.Errorf("\"hist-plotter\" cannot get \"Data\" field due to reason %v", err)
 	} else {
-		if val, err := JsonListToVector(v); err != nil {
-			return fmt.Errorf("\"hist-plotter\"'s \"Data\" field must be a list of numbers")
+		if names, samples, colors, err = histSamples(v); err != nil {
+			return nil, fmt.Errorf("\"hist-plotter\"'s \"Data\" field must be a list of numbers or an object "+
+				"of them, %v", err)
+		}
+	}
+
+	// every series shares the same edges so their bins can be compared
+	pooled := []float64{}
+	for _, x := range samples {
+		pooled = append(pooled, x...)
+	}
+	if len(pooled) == 0 {
+		return nil, fmt.Errorf("\"hist-plotter\"'s \"Data\" field is empty")
+	}
+
+	edges, err := bins.edges(pooled)
+	if err != nil {
+		return nil, fmt.Errorf("\"hist-plotter\" cannot create histgram object due to reason %v", err)
+	}
+
+	// log bins look evenly spaced only on a log axis
+	if bins.Log && chart.XAxis == nil {
+		chart.XAxis = &AxisConfig{Scale: "log", Threshold: 1}
+	}
+
+	box := []string{}
+	for idx, xs := range samples {
+		hist, counted := newHistogram(xs, edges)
+		opt.scale(hist, counted)
+
+		pts := make(plotter.XYs, len(hist.Bins))
+		for i, bin := range hist.Bins {
+			pts[i].X = (bin.Min + bin.Max) / 2
+			pts[i].Y = bin.Weight
+		}
+
+		// a single unnamed series keeps the classic gray bars
+		clr := chart.Color(idx)
+		if colors[idx].Type != kValueTypeNull {
+			if clr, err = chart.JsonToColor(colors[idx]); err != nil {
+				return nil, fmt.Errorf("\"hist-plotter\" series %s's field \"Color\" is invalid, %v", names[idx], err)
+			}
+		}
+		if names[idx] != "" {
+			hist.FillColor = withAlpha(clr, opt.Alpha)
+			hist.Color = clr
+		}
+
+		if opt.Style == kHistStep {
+			chart.AddSeries(names[idx], clr, pts, histStep(hist, clr))
 		} else {
-			vals = val
+			chart.AddSeries(names[idx], hist.FillColor, pts, hist)
 		}
+
+		box = append(box, opt.addStats(chart, names[idx], xs, hist, clr)...)
+	}
+
+	if opt.StatsBox {
+		chart.Add(newTextBox(box...))
 	}
 
-	hist, err := plotter.NewHist(*vals, bins)
+	return chart, nil
+}
+
+// histSamples reads the data which is either a list of numbers or an object of
+// named lists, the names are sorted. A named list can be an object with its numbers
+// under "Data" and a "Color", the colors are null when not given
+func histSamples(v Value) ([]string, []plotter.Values, []Value, error) {
+	v, err := resolveList(v)
 	if err != nil {
-		return fmt.Errorf("\"hist-plotter\" cannot create histgram object due to reason %v", err)
+		return nil, nil, nil, err
 	}
 
-	hist.Normalize(1)
-	p.Add(hist)
+	if v.Type != kValueTypeObject {
+		vals, err := JsonListToVector(v)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return []string{""}, []plotter.Values{*vals}, []Value{NewNull()}, nil
+	}
 
-	sz := vg.Length(size)
-	if err := p.Save(sz*vg.Inch, sz*vg.Inch, path); err != nil {
-		return fmt.Errorf("\"hist-plotter\" cannot save fiel to path %s due to reason %v", path, err)
+	names := []string{}
+	for k := range v.Object.Value {
+		names = append(names, k)
 	}
-	return nil
+	sort.Strings(names)
+
+	samples := []plotter.Values{}
+	colors := []Value{}
+	for _, k := range names {
+		x := v.Object.Value[k]
+		clr := NewNull()
+		if isSeriesObject(x) {
+			if t, err := JsonObjectGetMultipleKey(x, "Color", "color"); err == nil {
+				clr = t
+			}
+			x, _ = JsonObjectGetMultipleKey(x, "Data", "data")
+		}
+
+		vals, err := JsonListToVector(x)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("series %s, %v", k, err)
+		}
+		samples = append(samples, *vals)
+		colors = append(colors, clr)
+	}
+	return names, samples, colors, nil
+}
+
+// histStep draws the outline of the bins as a single step line
+func histStep(hist *plotter.Histogram, clr color.Color) *plotter.Line {
+	pts := plotter.XYs{}
+	for idx, b := range hist.Bins {
+		if idx == 0 {
+			pts = append(pts, plotter.XY{X: b.Min, Y: 0})
+		}
+		pts = append(pts, plotter.XY{X: b.Min, Y: b.Weight}, plotter.XY{X: b.Max, Y: b.Weight})
+	}
+	if len(hist.Bins) != 0 {
+		pts = append(pts, plotter.XY{X: hist.Bins[len(hist.Bins)-1].Max, Y: 0})
+	}
+
+	line := &plotter.Line{XYs: pts, LineStyle: plotter.DefaultLineStyle}
+	line.Color = clr
+	line.Width = vg.Points(1.5)
+	return line
+}
+
+// withAlpha makes the color translucent, alpha is in [0, 1]
+func withAlpha(clr color.Color, alpha float64) color.Color {
+	c := color.NRGBAModel.Convert(clr).(color.NRGBA)
+	c.A = uint8(math.Round(alpha * 255))
+	return c
 }
 
 func init() {
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// histOptions are the options of the hist-plotter on how the bins are scaled and
+// which statistics of the sample are drawn on top of them
+type histOptions struct {
+	// "count", "density" or "probability"
+	Normalize  string
+	Cumulative bool
+
+	Mean        bool
+	Median      bool
+	Percentiles []float64
+
+	// "normal" or "kde", empty for no curve
+	Curve string
+
+	StatsBox bool
+
+	// "overlay" draws translucent bars, "step" only the outline of the bins
+	Style string
+	Alpha float64
+}
+
+const (
+	kHistCount       = "count"
+	kHistDensity     = "density"
+	kHistProbability = "probability"
+
+	kHistOverlay = "overlay"
+	kHistStep    = "step"
+
+	kCurveSamples = 200
+)
+
+func parseHistOptions(data Value) (*histOptions, error) {
+	opt := &histOptions{
+		// the bins were always normalized into a density
+		Normalize: kHistDensity,
+		Style:     kHistOverlay,
+		Alpha:     0.5,
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Normalize", "normalize"); err == nil {
+		switch v.Type {
+		case kValueTypeBoolean:
+			if v.Boolean {
+				opt.Normalize = kHistDensity
+			} else {
+				opt.Normalize = kHistCount
+			}
+		case kValueTypeString:
+			switch v.String {
+			case kHistCount, kHistDensity, kHistProbability:
+				opt.Normalize = v.String
+			default:
+				return nil, fmt.Errorf("\"Normalize\" %s is unknown, must be count, density or probability", v.String)
+			}
+		default:
+			return nil, fmt.Errorf("\"Normalize\" field must be a boolean or a string")
+		}
+	}
+
+	for _, x := range []struct {
+		keys []string
+		ptr  *bool
+	}{
+		{[]string{"Cumulative", "cumulative"}, &opt.Cumulative},
+		{[]string{"Mean", "mean"}, &opt.Mean},
+		{[]string{"Median", "median"}, &opt.Median},
+		{[]string{"StatsBox", "statsbox"}, &opt.StatsBox},
+	} {
+		if v, err := JsonObjectGetMultipleKey(data, x.keys...); err == nil {
+			if val, err := JsonGetBoolean(v); err != nil {
+				return nil, fmt.Errorf("\"%s\" field is not a boolean", x.keys[0])
+			} else {
+				*x.ptr = val
+			}
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Percentiles", "percentiles"); err == nil {
+		if v.Type != kValueTypeList {
+			return nil, fmt.Errorf("\"Percentiles\" field must be a list of numbers")
+		}
+		for _, x := range v.List.Value {
+			if val, err := JsonGetNumber(x); err != nil || val < 0 || val > 100 {
+				return nil, fmt.Errorf("\"Percentiles\" field must be a list of numbers between 0 and 100")
+			} else {
+				opt.Percentiles = append(opt.Percentiles, val)
+			}
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Curve", "curve"); err == nil {
+		if val, err := JsonGetString(v); err != nil {
+			return nil, fmt.Errorf("\"Curve\" field is not a string")
+		} else {
+			switch val {
+			case "normal", "kde":
+				opt.Curve = val
+			default:
+				return nil, fmt.Errorf("\"Curve\" %s is unknown, must be normal or kde", val)
+			}
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Style", "style"); err == nil {
+		if val, err := JsonGetString(v); err != nil {
+			return nil, fmt.Errorf("\"Style\" field is not a string")
+		} else {
+			switch val {
+			case kHistOverlay, kHistStep:
+				opt.Style = val
+			default:
+				return nil, fmt.Errorf("\"Style\" %s is unknown, must be overlay or step", val)
+			}
+		}
+	}
+
+	if v, err := JsonObjectGetMultipleKey(data, "Alpha", "alpha"); err == nil {
+		if val, err := JsonGetNumber(v); err != nil || val < 0 || val > 1 {
+			return nil, fmt.Errorf("\"Alpha\" field must be a number between 0 and 1")
+		} else {
+			opt.Alpha = val
+		}
+	}
+
+	return opt, nil
+}
+
+// scale turns the bin counts into what Normalize and Cumulative ask for
+func (o *histOptions) scale(hist *plotter.Histogram, n int) {
+	if n == 0 {
+		return
+	}
+
+	total := float64(n)
+	for idx := range hist.Bins {
+		b := &hist.Bins[idx]
+		switch o.Normalize {
+		case kHistDensity:
+			b.Weight /= total * (b.Max - b.Min)
+		case kHistProbability:
+			b.Weight /= total
+		}
+	}
+
+	if !o.Cumulative {
+		return
+	}
+
+	// a cumulative density is the running probability, it ends at 1
+	sum := 0.0
+	for idx := range hist.Bins {
+		b := &hist.Bins[idx]
+		if o.Normalize == kHistDensity {
+			sum += b.Weight * (b.Max - b.Min)
+		} else {
+			sum += b.Weight
+		}
+		b.Weight = sum
+	}
+}
+
+// curveScale is the factor taking a probability density, or a distribution when
+// cumulative, to the scale of a bin of the width
+func (o *histOptions) curveScale(n int, width float64) float64 {
+	if o.Cumulative {
+		if o.Normalize == kHistCount {
+			return float64(n)
+		}
+		return 1
+	}
+
+	switch o.Normalize {
+	case kHistCount:
+		return float64(n) * width
+	case kHistProbability:
+		return width
+	default:
+		return 1
+	}
+}
+
+// binWidth is the width of the bin x falls in, the bins at the ends take the values
+// outside of them
+func binWidth(bins []plotter.HistogramBin, x float64) float64 {
+	idx := sort.Search(len(bins), func(i int) bool { return x < bins[i].Max })
+	if idx == len(bins) {
+		idx--
+	}
+	return bins[idx].Max - bins[idx].Min
+}
+
+func normalPdf(x, mean, sd float64) float64 {
+	z := (x - mean) / sd
+	return math.Exp(-z*z/2) / (sd * math.Sqrt(2*math.Pi))
+}
+
+func normalCdf(x, mean, sd float64) float64 {
+	return (1 + math.Erf((x-mean)/(sd*math.Sqrt2))) / 2
+}
+
+// kdeBandwidth is Silverman's rule of thumb
+func kdeBandwidth(xs []float64) float64 {
+	sd := statStdDev(xs)
+	iqr := statPercentile(xs, 75) - statPercentile(xs, 25)
+	spread := sd
+	if iqr > 0 && iqr/1.34 < spread {
+		spread = iqr / 1.34
+	}
+	return 0.9 * spread * math.Pow(float64(len(xs)), -0.2)
+}
+
+// curve returns the fitted function of the sample, nil when the sample is too
+// small or has no spread to fit anything. A count or a probability is scaled by the
+// width of the bin under x, so the curve follows bins of different widths
+func (o *histOptions) curve(xs []float64, bins []plotter.HistogramBin) func(float64) float64 {
+	if len(xs) < 2 || len(bins) == 0 {
+		return nil
+	}
+
+	k := func(x float64) float64 { return o.curveScale(len(xs), binWidth(bins, x)) }
+	cumulative := o.Cumulative
+
+	switch o.Curve {
+	case "normal":
+		mean, sd := statMean(xs), statStdDev(xs)
+		if sd == 0 {
+			return nil
+		}
+		if cumulative {
+			return func(x float64) float64 { return k(x) * normalCdf(x, mean, sd) }
+		}
+		return func(x float64) float64 { return k(x) * normalPdf(x, mean, sd) }
+
+	case "kde":
+		h := kdeBandwidth(xs)
+		if h == 0 || math.IsNaN(h) {
+			return nil
+		}
+		n := float64(len(xs))
+		return func(x float64) float64 {
+			sum := 0.0
+			for _, xi := range xs {
+				if cumulative {
+					sum += normalCdf(x, xi, h)
+				} else {
+					sum += normalPdf(x, xi, h)
+				}
+			}
+			return k(x) * sum / n
+		}
+	}
+	return nil
+}
+
+// histMarker is a statistic drawn as a vertical line
+type histMarker struct {
+	name  string
+	value float64
+}
+
+func (o *histOptions) markers(xs []float64) []histMarker {
+	ret := []histMarker{}
+	if o.Mean {
+		ret = append(ret, histMarker{"mean", statMean(xs)})
+	}
+	if o.Median {
+		ret = append(ret, histMarker{"median", statPercentile(xs, 50)})
+	}
+	for _, p := range o.Percentiles {
+		ret = append(ret, histMarker{fmt.Sprintf("p%g", p), statPercentile(xs, p)})
+	}
+	return ret
+}
+
+// addStats puts the statistics of the sample on top of the histogram, the lines of
+// the stats box are returned. A named series gets its name in front of the labels
+// and marks its statistics with its own color
+func (o *histOptions) addStats(chart *Chart, name string, xs []float64, hist *plotter.Histogram,
+	clr color.Color) []string {
+	if len(xs) == 0 {
+		return nil
+	}
+
+	prefix := ""
+	if name != "" {
+		prefix = name + " "
+	}
+
+	if f := o.curve(xs, hist.Bins); f != nil {
+		min, max := hist.Bins[0].Min, hist.Bins[len(hist.Bins)-1].Max
+
+		fn := plotter.NewFunction(f)
+		fn.XMin = min
+		fn.XMax = max
+		fn.Samples = kCurveSamples
+		fn.Width = vg.Points(1.5)
+		fn.Color = clr
+
+		pts := make(plotter.XYs, kCurveSamples)
+		for i := range pts {
+			pts[i].X = min + (max-min)*float64(i)/float64(kCurveSamples-1)
+			pts[i].Y = f(pts[i].X)
+		}
+		chart.AddSeries(prefix+o.Curve, clr, pts, fn)
+	}
+
+	for idx, m := range o.markers(xs) {
+		l := &vLine{X: m.value}
+		l.Width = vg.Points(1)
+		l.Color = chart.Color(idx + 1)
+		if name != "" {
+			l.Color = clr
+		}
+		l.Dashes = plotutil.Dashes(idx + 1)
+		chart.AddSeries(fmt.Sprintf("%s%s %.4g", prefix, m.name, m.value), l.Color, nil, l)
+	}
+
+	indent := ""
+	box := []string{}
+	if name != "" {
+		box = append(box, name)
+		indent = "  "
+	}
+	return append(box,
+		fmt.Sprintf("%sn = %d", indent, len(xs)),
+		fmt.Sprintf("%smean = %.4g", indent, statMean(xs)),
+		fmt.Sprintf("%sstddev = %.4g", indent, statStdDev(xs)),
+		fmt.Sprintf("%smin = %.4g", indent, statMin(xs)),
+		fmt.Sprintf("%smax = %.4g", indent, statMax(xs)),
+	)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot/plotter"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testHistogram is a histogram of the counts over the edges
+func testHistogram(edges []float64, counts ...float64) *plotter.Histogram {
+	bins := make([]plotter.HistogramBin, len(counts))
+	for idx := range bins {
+		bins[idx] = plotter.HistogramBin{Min: edges[idx], Max: edges[idx+1], Weight: counts[idx]}
+	}
+	return &plotter.Histogram{Bins: bins}
+}
+
+func TestStats(t *testing.T) {
+	xs := []float64{4, 1, 3, 2, 5}
+
+	for _, c := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"sum", statSum(xs), 15},
+		{"mean", statMean(xs), 3},
+		{"min", statMin(xs), 1},
+		{"max", statMax(xs), 5},
+		{"stddev", statStdDev(xs), math.Sqrt(2.5)},
+		{"p0", statPercentile(xs, 0), 1},
+		{"p50", statPercentile(xs, 50), 3},
+		{"p90", statPercentile(xs, 90), 4.6},
+		{"p100", statPercentile(xs, 100), 5},
+	} {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("%s got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	if !math.IsNaN(statMean(nil)) || !math.IsNaN(statStdDev([]float64{1})) {
+		t.Errorf("statistics of a sample too small must be NaN")
+	}
+}
+
+func TestHistScale(t *testing.T) {
+	// 10 values in bins of width 1, 1 and 2
+	edges := []float64{0, 1, 2, 4}
+
+	for _, c := range []struct {
+		doc  string
+		want []float64
+	}{
+		{`{"Normalize": "count"}`, []float64{2, 4, 4}},
+		{`{"Normalize": false}`, []float64{2, 4, 4}},
+		{`{}`, []float64{0.2, 0.4, 0.2}},
+		{`{"Normalize": "probability"}`, []float64{0.2, 0.4, 0.4}},
+		{`{"Normalize": "count", "Cumulative": true}`, []float64{2, 6, 10}},
+		{`{"Normalize": "probability", "Cumulative": true}`, []float64{0.2, 0.6, 1}},
+		{`{"Normalize": "density", "Cumulative": true}`, []float64{0.2, 0.6, 1}},
+	} {
+		opt, err := parseHistOptions(mustParseJson(t, c.doc))
+		if err != nil {
+			t.Errorf("options %s failed, %v", c.doc, err)
+			continue
+		}
+		hist := testHistogram(edges, 2, 4, 4)
+		opt.scale(hist, 10)
+		for idx, b := range hist.Bins {
+			if math.Abs(b.Weight-c.want[idx]) > 1e-9 {
+				t.Errorf("options %s bin %d got %v, want %v", c.doc, idx, b.Weight, c.want[idx])
+			}
+		}
+	}
+}
+
+func TestHistCurve(t *testing.T) {
+	xs := []float64{1, 2, 2, 3, 3, 3, 4, 4, 5}
+	mean, sd := statMean(xs), statStdDev(xs)
+	bins := testHistogram([]float64{0, 1, 3, 6}, 0, 0, 0).Bins
+
+	for _, c := range []struct {
+		doc  string
+		x    float64
+		want float64
+	}{
+		{`{"Curve": "normal"}`, 3, normalPdf(3, mean, sd)},
+		{`{"Curve": "normal", "Normalize": "count"}`, 0.5, 9 * 1 * normalPdf(0.5, mean, sd)},
+		{`{"Curve": "normal", "Normalize": "count"}`, 2, 9 * 2 * normalPdf(2, mean, sd)},
+		{`{"Curve": "normal", "Normalize": "count"}`, 7, 9 * 3 * normalPdf(7, mean, sd)},
+		{`{"Curve": "normal", "Normalize": "probability"}`, 4, 3 * normalPdf(4, mean, sd)},
+		{`{"Curve": "normal", "Cumulative": true}`, 3, normalCdf(3, mean, sd)},
+		{`{"Curve": "normal", "Normalize": "count", "Cumulative": true}`, 3, 9 * normalCdf(3, mean, sd)},
+	} {
+		opt, err := parseHistOptions(mustParseJson(t, c.doc))
+		if err != nil {
+			t.Errorf("options %s failed, %v", c.doc, err)
+			continue
+		}
+		f := opt.curve(xs, bins)
+		if f == nil {
+			t.Errorf("options %s has no curve", c.doc)
+		} else if got := f(c.x); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("options %s at %v got %v, want %v", c.doc, c.x, got, c.want)
+		}
+	}
+
+	// a kernel density is a density, its area is 1
+	opt := &histOptions{Curve: "kde", Normalize: kHistDensity}
+	f := opt.curve(xs, bins)
+	area := 0.0
+	for x := -5.0; x < 11; x += 0.01 {
+		area += f(x) * 0.01
+	}
+	if math.Abs(area-1) > 1e-3 {
+		t.Errorf("kde has area %v, want 1", area)
+	}
+
+	if f := (&histOptions{Curve: "normal"}).curve([]float64{2, 2, 2}, bins); f != nil {
+		t.Errorf("a sample without spread must have no curve")
+	}
+}
+
+func TestParseHistOptionsError(t *testing.T) {
+	for _, c := range []struct {
+		doc string
+		msg string
+	}{
+		{`{"Normalize": "percent"}`, `"Normalize" percent is unknown`},
+		{`{"Normalize": 1}`, `"Normalize" field must be a boolean or a string`},
+		{`{"Mean": "yes"}`, `"Mean" field is not a boolean`},
+		{`{"Percentiles": [50, 101]}`, `"Percentiles" field must be a list of numbers between 0 and 100`},
+		{`{"Curve": "gamma"}`, `"Curve" gamma is unknown, must be normal or kde`},
+		{`{"Style": "bars"}`, `"Style" bars is unknown, must be overlay or step`},
+		{`{"Alpha": 2}`, `"Alpha" field must be a number between 0 and 1`},
+	} {
+		_, err := parseHistOptions(mustParseJson(t, c.doc))
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("options %s got error %v, want %q", c.doc, err, c.msg)
+		}
+	}
+}
+
+func TestHistBinsRule(t *testing.T) {
+	xs := make([]float64, 100)
+	for idx := range xs {
+		xs[idx] = float64(idx)
+	}
+	skewed := append(append([]float64{}, xs...), 1000, 2000, 5000)
+
+	for _, c := range []struct {
+		rule string
+		xs   []float64
+		want int
+	}{
+		{"sturges", xs, 8},
+		{"sqrt", xs, 10},
+		{"scott", xs, 5},
+		{"fd", xs, 5},
+		{"auto", xs, 8},
+		{"doane", xs, 8},
+		{"fd", skewed, 230},
+		{"auto", skewed, 230},
+		{"doane", skewed, 13},
+		{"sturges", []float64{1, 1, 1}, 3},
+		{"fd", []float64{1, 1, 1}, 3},
+	} {
+		if got := ruleCount(c.rule, c.xs); got != c.want {
+			t.Errorf("rule %s on %d values got %d bins, want %d", c.rule, len(c.xs), got, c.want)
+		}
+	}
+
+	huge := append([]float64{0, 1e9}, xs...)
+	if got := ruleCount("fd", huge); got != kMaxBins {
+		t.Errorf("rule fd with outliers got %d bins, want at most %d", got, kMaxBins)
+	}
+}
+
+func TestHistBinsEdges(t *testing.T) {
+	for _, c := range []struct {
+		doc  string
+		xs   []float64
+		want []float64
+	}{
+		{`{}`, []float64{0, 8}, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8}},
+		{`{"Bins": 4}`, []float64{2, 10}, []float64{2, 4, 6, 8, 10}},
+		{`{"Bins": 2}`, []float64{3, 3}, []float64{2.5, 3, 3.5}},
+		{`{"Bins": [0, 1, 5]}`, []float64{2, 3}, []float64{0, 1, 5}},
+		{`{"BinWidth": 5}`, []float64{3, 12}, []float64{0, 5, 10, 15}},
+		{`{"BinWidth": 5}`, []float64{-3, 4}, []float64{-5, 0, 5}},
+		{`{"LogBins": true, "Bins": 3}`, []float64{1, 1000}, []float64{1, 10, 100, 1000}},
+		{`{"LogBins": true, "BinWidth": 10}`, []float64{2, 500}, []float64{1, 10, 100, 1000}},
+	} {
+		b, err := parseHistBins(mustParseJson(t, c.doc))
+		if err != nil {
+			t.Errorf("bins %s failed, %v", c.doc, err)
+			continue
+		}
+		got, err := b.edges(c.xs)
+		if err != nil {
+			t.Errorf("bins %s failed, %v", c.doc, err)
+			continue
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("bins %s got edges %v, want %v", c.doc, got, c.want)
+			continue
+		}
+		for idx := range got {
+			if math.Abs(got[idx]-c.want[idx]) > 1e-9*math.Max(1, math.Abs(c.want[idx])) {
+				t.Errorf("bins %s got edges %v, want %v", c.doc, got, c.want)
+				break
+			}
+		}
+	}
+
+	b, _ := parseHistBins(mustParseJson(t, `{"LogBins": true}`))
+	if _, err := b.edges([]float64{1, 0, 3}); err == nil ||
+		!strings.Contains(err.Error(), "needs positive data but got 0") {
+		t.Errorf("log bins of a zero got error %v", err)
+	}
+}
+
+func TestParseHistBinsError(t *testing.T) {
+	for _, c := range []struct {
+		doc string
+		msg string
+	}{
+		{`{"Bins": 0}`, `"Bins" 0 must be a positive integer`},
+		{`{"Bins": 2.5}`, `"Bins" 2.5 must be a positive integer`},
+		{`{"Bins": "rice"}`, `"Bins" rule rice is unknown`},
+		{`{"Bins": [1, 2, 2]}`, `edge 2 (2) is not greater than edge 1 (2)`},
+		{`{"Bins": [1, 5, 3, 7]}`, `edge 2 (3) is not greater than edge 1 (5)`},
+		{`{"Bins": [1, "a"]}`, `"Bins" edge 1 is not a number`},
+		{`{"Bins": [1]}`, `"Bins" needs at least 2 edges but got 1`},
+		{`{"Bins": true}`, `"Bins" field must be a number, a rule or a list of edges but got type boolean`},
+		{`{"BinWidth": 0}`, `"BinWidth" field must be a positive number`},
+		{`{"Bins": [1, 2], "BinWidth": 1}`, `"BinWidth" cannot be used together with a list of edges`},
+		{`{"Bins": [1, 2], "LogBins": true}`, `"LogBins" cannot be used together with a list of edges`},
+		{`{"BinWidth": 0.5, "LogBins": true}`, `must be greater than 1 but got 0.5`},
+	} {
+		_, err := parseHistBins(mustParseJson(t, c.doc))
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("bins %s got error %v, want %q", c.doc, err, c.msg)
+		}
+	}
+}
+
+func TestNewHistogram(t *testing.T) {
+	hist, counted := newHistogram([]float64{-1, 0, 0.5, 1, 1.5, 2, 3, 4}, []float64{0, 1, 2, 3})
+	if counted != 6 {
+		t.Errorf("histogram counted %d values, want 6", counted)
+	}
+	got := []string{}
+	for _, b := range hist.Bins {
+		got = append(got, fmt.Sprintf("[%v,%v):%v", b.Min, b.Max, b.Weight))
+	}
+	if want := "[0,1):2 [1,2):2 [2,3):2"; strings.Join(got, " ") != want {
+		t.Errorf("histogram got %s, want %s", strings.Join(got, " "), want)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgsvg"
+	"html/template"
+	"image/color"
+	"math"
+	"os"
+	"strings"
+)
+
+// Html writer turns a chart into a single self contained html page. The chart is drawn
+// as a stack of inline svg layers sharing the same title and axes: the bottom layer has
+// the title, axes and grids and each series is drawn into a layer of its own, so a
+// series can be toggled by hiding its layer. Every point of each series is embedded
+// as json together with its position on the canvas, which feeds the hover tooltips.
+// Zoom and pan are done by moving the view box of all the layers together
+
+type htmlSeries struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+
+	// each point is [x, y, canvas x, canvas y]
+	Points [][4]float64 `json:"points"`
+}
+
+type htmlChart struct {
+	Width  float64      `json:"width"`
+	Height float64      `json:"height"`
+	Series []htmlSeries `json:"series"`
+
+	// X values are seconds since the unix epoch
+	TimeX bool `json:"timeX"`
+}
+
+type htmlLayer struct {
+	Index int
+	Name  string
+	Color string
+	Svg   template.HTML
+
+	// the series has an entry in the legend, which is what toggles it
+	Legend bool
+}
+
+type htmlPage struct {
+	Title         string
+	DisplayWidth  float64
+	DisplayHeight float64
+	Base          template.HTML
+	Layers        []htmlLayer
+	Data          template.JS
+}
+
+// turn a color into a css color literal
+func cssColor(clr color.Color) string {
+	if clr == nil {
+		return "black"
+	}
+
+	r, g, b, a := clr.RGBA()
+	if a == 0 {
+		return "transparent"
+	}
+
+	ret := fmt.Sprintf("#%02x%02x%02x", r*0xff/a, g*0xff/a, b*0xff/a)
+	if a != 0xffff {
+		ret += fmt.Sprintf("%02x", a>>8)
+	}
+	return ret
+}
+
+// newLayerPlot creates an empty plot which has the same title and axes as p. The
+// axes are copied after the plotters are added since adding plotters can extend
+// the range of the axes
+func newLayerPlot(p *plot.Plot, ps ...plot.Plotter) (*plot.Plot, error) {
+	lp, err := plot.New()
+	if err != nil {
+		return nil, err
+	}
+
+	lp.Add(ps...)
+	lp.Title = p.Title
+	lp.X = p.X
+	lp.Y = p.Y
+	lp.BackgroundColor = p.BackgroundColor
+	return lp, nil
+}
+
+// hideLayerPlot makes everything on lp invisible except its plotters. The text is
+// still laid out so the data area ends up at the same place as the base layer
+func hideLayerPlot(lp *plot.Plot) {
+	lp.BackgroundColor = color.Transparent
+	lp.Title.Color = color.Transparent
+
+	for _, axis := range []*plot.Axis{&lp.X, &lp.Y} {
+		axis.Color = color.Transparent
+		axis.Label.Color = color.Transparent
+		axis.Tick.Color = color.Transparent
+		axis.Tick.Label.Color = color.Transparent
+	}
+}
+
+func (c *Chart) renderSvg(drawer func(draw.Canvas)) (template.HTML, error) {
+	canvas := vgsvg.New(c.Width, c.Height)
+	drawer(draw.New(canvas))
+
+	b := bytes.Buffer{}
+	if _, err := canvas.WriteTo(&b); err != nil {
+		return "", err
+	}
+
+	// drop the xml header since the svg is inlined into html
+	svg := b.String()
+	if idx := strings.Index(svg, "<svg"); idx > 0 {
+		svg = svg[idx:]
+	}
+	return template.HTML(svg), nil
+}
+
+func (c *Chart) saveHtml(path string) error {
+	page := htmlPage{
+		Title:         c.Plot.Title.Text,
+		DisplayWidth:  float64(c.Width) * 4 / 3,
+		DisplayHeight: float64(c.Height) * 4 / 3,
+	}
+
+	data := htmlChart{
+		Width:  float64(c.Width),
+		Height: float64(c.Height),
+		Series: []htmlSeries{},
+		TimeX:  c.XAxis != nil && c.XAxis.Time != nil,
+	}
+
+	// a grid of charts is embedded as a single layer, it can still be zoomed
+	// but doesn't have any series to inspect
+	if c.Panels != nil {
+		var err error
+		if page.Base, err = c.renderSvg(c.Draw); err != nil {
+			return err
+		}
+		return writeHtmlPage(path, page, data)
+	}
+
+	base, err := newLayerPlot(c.Plot, c.decorations...)
+	if err != nil {
+		return err
+	}
+
+	// with a right axis every layer is drawn as a pair of plots, the main one and the
+	// one of the right axis, only one of them has the plotters of the series
+	var right *plot.Plot
+	if c.Right != nil {
+		if right, err = newLayerPlot(c.Right); err != nil {
+			return err
+		}
+	}
+
+	drawLayer := func(left, right *plot.Plot, ps []plot.Plotter) func(draw.Canvas) {
+		if right == nil {
+			return left.Draw
+		}
+		return func(dc draw.Canvas) { drawDual(dc, left, right, ps) }
+	}
+
+	if page.Base, err = c.renderSvg(drawLayer(base, right, nil)); err != nil {
+		return err
+	}
+
+	// the transformation from data coordinate to canvas coordinate, the svg has
+	// its origin at the top left corner while the canvas is at the bottom left
+	dc := draw.New(vgsvg.New(c.Width, c.Height))
+	if right != nil {
+		syncRightAxis(base, right)
+		dc = reserveRightAxis(dc, right)
+	}
+	da := base.DataCanvas(dc)
+	trX, trY := base.Transforms(&da)
+
+	for idx, s := range c.Series {
+		left, layerRight := s.Plotters, []plot.Plotter(nil)
+		if s.Right {
+			left, layerRight = nil, s.Plotters
+		}
+
+		lp, err := newLayerPlot(c.Plot, left...)
+		if err != nil {
+			return err
+		}
+		hideLayerPlot(lp)
+
+		var rp *plot.Plot
+		if right != nil {
+			if rp, err = newLayerPlot(c.Right); err != nil {
+				return err
+			}
+			hideLayerPlot(rp)
+		}
+
+		svg, err := c.renderSvg(drawLayer(lp, rp, layerRight))
+		if err != nil {
+			return err
+		}
+
+		trY := trY
+		if s.Right {
+			_, trY = right.Transforms(&da)
+		}
+
+		clr := cssColor(s.Color)
+		page.Layers = append(page.Layers, htmlLayer{
+			Index:  idx,
+			Name:   s.Name,
+			Color:  clr,
+			Svg:    svg,
+			Legend: c.inLegend(s),
+		})
+
+		hs := htmlSeries{Name: s.Name, Color: clr, Points: [][4]float64{}}
+		for _, pt := range s.Points {
+			if math.IsNaN(pt.X) || math.IsNaN(pt.Y) || math.IsInf(pt.X, 0) || math.IsInf(pt.Y, 0) {
+				continue
+			}
+			hs.Points = append(hs.Points, [4]float64{
+				pt.X,
+				pt.Y,
+				float64(trX(pt.X)),
+				float64(c.Height - trY(pt.Y)),
+			})
+		}
+		data.Series = append(data.Series, hs)
+	}
+
+	return writeHtmlPage(path, page, data)
+}
+
+func writeHtmlPage(path string, page htmlPage, data htmlChart) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	page.Data = template.JS(js)
+
+	b := bytes.Buffer{}
+	if err := htmlTemplate.Execute(&b, page); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b.Bytes(), 0644)
+}
+
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 16px; }
+.jp-plot { position: relative; overflow: hidden; cursor: crosshair; user-select: none;
+  width: {{.DisplayWidth}}px; height: {{.DisplayHeight}}px; }
+.jp-plot.jp-drag { cursor: move; }
+.jp-layer { position: absolute; left: 0; top: 0; width: 100%; height: 100%; pointer-events: none; }
+.jp-layer svg { width: 100%; height: 100%; }
+.jp-hidden { display: none; }
+.jp-tooltip { position: absolute; pointer-events: none; background: rgba(255,255,255,0.95);
+  border: 1px solid #999; border-radius: 3px; padding: 2px 6px; font-size: 12px; white-space: nowrap; }
+.jp-legend { list-style: none; padding: 0; margin: 8px 0; }
+.jp-legend li { display: inline-block; margin-right: 16px; cursor: pointer; }
+.jp-legend li.jp-off { opacity: 0.35; }
+.jp-swatch { display: inline-block; width: 12px; height: 12px; margin-right: 4px; vertical-align: middle; }
+.jp-help { color: #888; font-size: 11px; }
+</style>
+</head>
+<body>
+<div class="jp-plot" id="jp-plot">
+<div class="jp-layer">{{.Base}}</div>
+{{range .Layers}}<div class="jp-layer" data-series="{{.Index}}">{{.Svg}}</div>
+{{end}}<div class="jp-layer"><svg id="jp-overlay" xmlns="http://www.w3.org/2000/svg"></svg></div>
+<div class="jp-tooltip jp-hidden" id="jp-tooltip"></div>
+</div>
+<ul class="jp-legend" id="jp-legend">
+{{range .Layers}}{{if .Legend}}<li data-series="{{.Index}}"><span class="jp-swatch" style="background: {{.Color}}"></span>{{.Name}}</li>
+{{end}}{{end}}</ul>
+<div class="jp-help">scroll to zoom, drag to pan, double click to reset, click a legend entry to toggle its series</div>
+<script>
+(function() {
+  var data = {{.Data}};
+  var root = document.getElementById("jp-plot");
+  var tooltip = document.getElementById("jp-tooltip");
+  var overlay = document.getElementById("jp-overlay");
+  var svgs = root.querySelectorAll("svg");
+  var visible = data.series.map(function() { return true; });
+  var view = { x: 0, y: 0, w: data.width, h: data.height };
+  var drag = null;
+
+  var marker = document.createElementNS("http://www.w3.org/2000/svg", "circle");
+  marker.setAttribute("r", 4);
+  marker.setAttribute("fill", "none");
+  marker.setAttribute("stroke-width", 1.5);
+  marker.style.display = "none";
+  overlay.appendChild(marker);
+
+  function apply() {
+    var box = view.x + " " + view.y + " " + view.w + " " + view.h;
+    for (var i = 0; i < svgs.length; i++) {
+      svgs[i].setAttribute("viewBox", box);
+      svgs[i].setAttribute("preserveAspectRatio", "none");
+    }
+  }
+
+  function clamp() {
+    view.w = Math.min(view.w, data.width);
+    view.h = Math.min(view.h, data.height);
+    view.x = Math.max(0, Math.min(view.x, data.width - view.w));
+    view.y = Math.max(0, Math.min(view.y, data.height - view.h));
+  }
+
+  function toCanvas(e) {
+    var r = root.getBoundingClientRect();
+    return {
+      x: view.x + (e.clientX - r.left) / r.width * view.w,
+      y: view.y + (e.clientY - r.top) / r.height * view.h,
+      scale: view.w / r.width
+    };
+  }
+
+  function format(v) {
+    return String(Math.abs(v) >= 1e6 || (v !== 0 && Math.abs(v) < 1e-3) ? v.toExponential(4) : +v.toPrecision(6));
+  }
+
+  function formatX(v) {
+    return data.timeX ? new Date(v * 1000).toISOString() : format(v);
+  }
+
+  function hide() {
+    tooltip.classList.add("jp-hidden");
+    marker.style.display = "none";
+  }
+
+  function hover(e) {
+    var pos = toCanvas(e);
+    var best = null, bestDist = 10 * pos.scale;
+    data.series.forEach(function(s, si) {
+      if (!visible[si]) return;
+      s.points.forEach(function(p) {
+        var d = Math.sqrt((p[2] - pos.x) * (p[2] - pos.x) + (p[3] - pos.y) * (p[3] - pos.y));
+        if (d < bestDist) { bestDist = d; best = { series: s, point: p }; }
+      });
+    });
+    if (best === null) { hide(); return; }
+
+    var p = best.point, r = root.getBoundingClientRect();
+    marker.setAttribute("cx", p[2]);
+    marker.setAttribute("cy", p[3]);
+    marker.setAttribute("stroke", best.series.color);
+    marker.style.display = "";
+    tooltip.textContent = (best.series.name ? best.series.name + ": " : "") + "(" + formatX(p[0]) + ", " + format(p[1]) + ")";
+    tooltip.style.left = ((p[2] - view.x) / view.w * r.width + 8) + "px";
+    tooltip.style.top = ((p[3] - view.y) / view.h * r.height + 8) + "px";
+    tooltip.classList.remove("jp-hidden");
+  }
+
+  root.addEventListener("wheel", function(e) {
+    e.preventDefault();
+    var pos = toCanvas(e), f = e.deltaY < 0 ? 0.8 : 1.25;
+    view.x = pos.x - (pos.x - view.x) * f;
+    view.y = pos.y - (pos.y - view.y) * f;
+    view.w *= f;
+    view.h *= f;
+    clamp();
+    apply();
+    hide();
+  });
+
+  root.addEventListener("mousedown", function(e) {
+    drag = { x: e.clientX, y: e.clientY, vx: view.x, vy: view.y };
+    root.classList.add("jp-drag");
+  });
+
+  window.addEventListener("mouseup", function() {
+    drag = null;
+    root.classList.remove("jp-drag");
+  });
+
+  root.addEventListener("mousemove", function(e) {
+    if (drag === null) { hover(e); return; }
+    var r = root.getBoundingClientRect();
+    view.x = drag.vx - (e.clientX - drag.x) / r.width * view.w;
+    view.y = drag.vy - (e.clientY - drag.y) / r.height * view.h;
+    clamp();
+    apply();
+    hide();
+  });
+
+  root.addEventListener("mouseleave", hide);
+
+  root.addEventListener("dblclick", function() {
+    view = { x: 0, y: 0, w: data.width, h: data.height };
+    apply();
+  });
+
+  var items = document.querySelectorAll("#jp-legend li");
+  for (var i = 0; i < items.length; i++) {
+    items[i].addEventListener("click", function() {
+      var si = +this.getAttribute("data-series");
+      visible[si] = !visible[si];
+      this.classList.toggle("jp-off", !visible[si]);
+      root.querySelector('.jp-layer[data-series="' + si + '"]').classList.toggle("jp-hidden", !visible[si]);
+      hide();
+    });
+  }
+
+  apply();
+})();
+</script>
+</body>
+</html>
+`))
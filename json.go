@@ -392,7 +392,12 @@ func (parser *JsonParser) parseValue() (Value, error) {
 		return Value{Type: kValueTypeNumber, Number: parser.Lexer.Lexeme.Number}, nil
 	case kJsonTokenString:
 		defer parser.Lexer.Next()
-		return Value{Type: kValueTypeString, String: parser.Lexer.Lexeme.String}, nil
+		return Value{
+			Type:   kValueTypeString,
+			String: parser.Lexer.Lexeme.String,
+			Line:   parser.Lexer.Line,
+			Column: parser.Lexer.CCount - parser.Lexer.Lexeme.Length,
+		}, nil
 	case kJsonTokenBoolean:
 		defer parser.Lexer.Next()
 		return Value{Type: kValueTypeBoolean, Boolean: parser.Lexer.Lexeme.Boolean}, nil
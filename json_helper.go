@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
 	"image/color"
+	"strconv"
+	"strings"
 )
 
 // Json helper has a list of functions to help us manipulate json's results and perform
@@ -83,6 +87,59 @@ func JsonObjectGetMultipleKey(v Value, keys ...string) (Value, error) {
 	return NewNull(), fmt.Errorf("key list :%s doesn't exist in object", keyList.String())
 }
 
+// JsonObjectWithKey returns a copy of the object whose key is set to val, any other
+// spelling of the key is dropped
+func JsonObjectWithKey(v Value, val Value, keys ...string) Value {
+	if v.Type != kValueTypeObject {
+		return v
+	}
+
+	obj := NewObject()
+	for k, x := range v.Object.Value {
+		obj.Value[k] = x
+	}
+	for _, k := range keys {
+		delete(obj.Value, k)
+	}
+	obj.Value[keys[0]] = val
+	return Value{Type: kValueTypeObject, Object: obj}
+}
+
+// JsonObjectWithDefault is JsonObjectWithKey but the object is returned as is when it
+// already has the key
+func JsonObjectWithDefault(v Value, val Value, keys ...string) Value {
+	if _, err := JsonObjectGetMultipleKey(v, keys...); err == nil {
+		return v
+	}
+	return JsonObjectWithKey(v, val, keys...)
+}
+
+// JsonGetPath walks a dotted path like "latency.p99" through nested objects, a
+// segment which is a number indexes into a list
+func JsonGetPath(v Value, path string) (Value, error) {
+	cur := v
+	for _, seg := range strings.Split(path, ".") {
+		if cur.Type == kValueTypeList {
+			idx, err := strconv.Atoi(seg)
+			if err != nil {
+				return NewNull(), fmt.Errorf("path %s, segment %s is not a list index", path, seg)
+			}
+			if idx < 0 {
+				return NewNull(), fmt.Errorf("path %s, index %d is negative", path, idx)
+			}
+			if cur, err = JsonListGet(cur, idx); err != nil {
+				return NewNull(), fmt.Errorf("path %s, %v", path, err)
+			}
+		} else {
+			var err error
+			if cur, err = JsonObjectGet(cur, seg); err != nil {
+				return NewNull(), fmt.Errorf("path %s, %v", path, err)
+			}
+		}
+	}
+	return cur, nil
+}
+
 func jsonGetColorComponent(v Value, k1 string, k2 string) (uint8, error) {
 	var c float64
 	name := k2
@@ -133,8 +190,55 @@ func JsonObjectToColor(v Value) (color.Color, error) {
 	return color.RGBA{R: r, G: g, B: b, A: a}, nil
 }
 
+// JsonObjectToLineStyle reads "Color", "Width" and "Dashes" of a line on top of the
+// default style, width and dashes are in points. A color index refers to the palette
+func JsonObjectToLineStyle(v Value, def draw.LineStyle, palette []color.Color) (draw.LineStyle, error) {
+	if v.Type != kValueTypeObject {
+		return def, fmt.Errorf("value is not type object but type %s", v.Type.GetName())
+	}
+	sty := def
+
+	if t, err := JsonObjectGetMultipleKey(v, "Color", "color"); err == nil {
+		if clr, err := JsonToColor(t, palette); err != nil {
+			return def, fmt.Errorf("\"Color\" field is invalid, %v", err)
+		} else {
+			sty.Color = clr
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Width", "width"); err == nil {
+		if val, err := JsonGetNumber(t); err != nil || val <= 0 {
+			return def, fmt.Errorf("\"Width\" field must be a positive number")
+		} else {
+			sty.Width = vg.Points(val)
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Dashes", "dashes"); err == nil {
+		if t.Type != kValueTypeList {
+			return def, fmt.Errorf("\"Dashes\" field must be a list of numbers")
+		}
+		sty.Dashes = []vg.Length{}
+		for _, x := range t.List.Value {
+			if val, err := JsonGetNumber(x); err != nil || val < 0 {
+				return def, fmt.Errorf("\"Dashes\" field must be a list of numbers")
+			} else {
+				sty.Dashes = append(sty.Dashes, vg.Points(val))
+			}
+		}
+	}
+
+	return sty, nil
+}
+
 // Plotter related Json conversion
 func JsonObjectToPoint(v Value) (float64, float64, error) {
+	return JsonObjectToPointWithX(v, JsonGetNumber)
+}
+
+// JsonObjectToPointWithX is JsonObjectToPoint but the X component is converted by
+// xconv, which allows X to be something other than a number, ie a timestamp
+func JsonObjectToPointWithX(v Value, xconv func(Value) (float64, error)) (float64, float64, error) {
 	if v.Type != kValueTypeObject {
 		return 0, 0, fmt.Errorf("value is not type object but type %s", v.Type.GetName())
 	}
@@ -144,7 +248,7 @@ func JsonObjectToPoint(v Value) (float64, float64, error) {
 	if xval, err := JsonObjectGetMultipleKey(v, "x", "X"); err != nil {
 		return 0, 0, err
 	} else {
-		if dx, err := JsonGetNumber(xval); err != nil {
+		if dx, err := xconv(xval); err != nil {
 			return 0, 0, fmt.Errorf("component X failed, %v", err)
 		} else {
 			x = dx
@@ -165,6 +269,21 @@ func JsonObjectToPoint(v Value) (float64, float64, error) {
 }
 
 func JsonListToPointList(v Value) (*plotter.XYs, error) {
+	return JsonListToPointListWithX(v, JsonGetNumber)
+}
+
+// JsonListToPointListWithX is JsonListToPointList with the X component of each point
+// converted by xconv
+func JsonListToPointListWithX(v Value, xconv func(Value) (float64, error)) (*plotter.XYs, error) {
+	fromSource := IsDataSource(v)
+	v, err := resolveList(v)
+	if err != nil {
+		return nil, err
+	}
+	if fromSource {
+		v = indexPoints(v)
+	}
+
 	if v.Type != kValueTypeList {
 		return nil, fmt.Errorf("value is not type list but type %s", v.Type.GetName())
 	}
@@ -178,7 +297,7 @@ func JsonListToPointList(v Value) (*plotter.XYs, error) {
 		if v.List.Value[0].Type == kValueTypeObject {
 			pts := make(plotter.XYs, len(v.List.Value))
 			for idx, element := range v.List.Value {
-				if x, y, err := JsonObjectToPoint(element); err != nil {
+				if x, y, err := JsonObjectToPointWithX(element, xconv); err != nil {
 					return nil, fmt.Errorf("index %d failed to parse as point due to reason %v", idx, err)
 				} else {
 					pts[idx].X = x
@@ -186,7 +305,7 @@ func JsonListToPointList(v Value) (*plotter.XYs, error) {
 				}
 			}
 			ret = &pts
-		} else if v.List.Value[0].Type == kValueTypeNumber {
+		} else if v.List.Value[0].Type == kValueTypeNumber || v.List.Value[0].Type == kValueTypeString {
 			sz := len(v.List.Value)
 			if sz%2 != 0 {
 				sz = sz - 1
@@ -196,14 +315,14 @@ func JsonListToPointList(v Value) (*plotter.XYs, error) {
 
 			idx := 0
 			for i := 0; i < sz; i += 2 {
-				x := v.List.Value[i]
+				x, err := xconv(v.List.Value[i])
 				y := v.List.Value[i+1]
 
-				if x.Type != kValueTypeNumber || y.Type != kValueTypeNumber {
+				if err != nil || y.Type != kValueTypeNumber {
 					return nil, fmt.Errorf("index %d, failed to parse 2 consecutive number", i)
 				}
 
-				pts[idx].X = x.Number
+				pts[idx].X = x
 				pts[idx].Y = y.Number
 				idx++
 			}
@@ -215,6 +334,12 @@ func JsonListToPointList(v Value) (*plotter.XYs, error) {
 
 func JsonListToVector(v Value) (*plotter.Values, error) {
 	var ret plotter.Values
+
+	v, err := resolveList(v)
+	if err != nil {
+		return nil, err
+	}
+
 	if v.Type != kValueTypeList {
 		return nil, fmt.Errorf("value is not type list but type %s", v.Type.GetName())
 	}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+// mustParseJson parses the json of a test, the test fails when it is invalid
+func mustParseJson(t *testing.T, text string) Value {
+	t.Helper()
+	v, err := NewJsonParser(text).Parse()
+	if err != nil {
+		t.Fatalf("json %s is invalid, %v", text, err)
+	}
+	return v
+}
+
+// mustParseValue parses any json value, the parser only takes a list or an object
+func mustParseValue(t *testing.T, text string) Value {
+	t.Helper()
+	return mustParseJson(t, "["+text+"]").List.Value[0]
+}
+
+// sameJson tells if the values are the same json, the keys of objects in any order
+func sameJson(a, b Value) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case kValueTypeObject:
+		if len(a.Object.Value) != len(b.Object.Value) {
+			return false
+		}
+		for k, x := range a.Object.Value {
+			if y, ok := b.Object.Value[k]; !ok || !sameJson(x, y) {
+				return false
+			}
+		}
+		return true
+	case kValueTypeList:
+		if len(a.List.Value) != len(b.List.Value) {
+			return false
+		}
+		for idx := range a.List.Value {
+			if !sameJson(a.List.Value[idx], b.List.Value[idx]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.ToJson() == b.ToJson()
+	}
+}
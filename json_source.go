@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Json source picks the data out of a json document of any shape with queries:
+//
+//   {"Source": "results.json", "Query": "$.runs[*].latency_ms"}
+//
+// "Query" may also be an object of queries, one per series. When "Y" is given the
+// query must select records and "X", "Y" and "GroupBy" pick their fields just like
+// the json lines source does:
+//
+//   {"Source": "results.json", "Query": "$.runs[?(@.ok == true)]", "X": "ts", "Y": "ms"}
+
+type jsonSource struct {
+	File string
+
+	// a single query, or one per series in Names order
+	Query   string
+	Names   []string
+	Queries map[string]string
+
+	Fields *recordFields
+}
+
+func parseJsonSource(v Value) (*jsonSource, error) {
+	src := &jsonSource{}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Source", "source", "File", "file"); err != nil {
+		return nil, err
+	} else {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("data source \"Source\" field is not a string")
+		} else {
+			src.File = val
+		}
+	}
+
+	// without a query the whole document is the data
+	src.Query = "$"
+
+	if t, err := JsonObjectGetMultipleKey(v, "Query", "query"); err == nil {
+		switch t.Type {
+		case kValueTypeString:
+			src.Query = t.String
+		case kValueTypeObject:
+			src.Queries = make(map[string]string)
+			for name, x := range t.Object.Value {
+				if val, err := JsonGetString(x); err != nil {
+					return nil, fmt.Errorf("data source %s, \"Query\" of series %s is not a string", src.File, name)
+				} else {
+					src.Queries[name] = val
+					src.Names = append(src.Names, name)
+				}
+			}
+			sort.Strings(src.Names)
+		default:
+			return nil, fmt.Errorf("data source %s, \"Query\" field must be a query or an object of them", src.File)
+		}
+	}
+
+	// compile now so a typo is reported before the file is read
+	queries := []string{src.Query}
+	if src.Queries != nil {
+		queries = queries[:0]
+		for _, name := range src.Names {
+			queries = append(queries, src.Queries[name])
+		}
+	}
+	for _, q := range queries {
+		if _, err := CompileQuery(q); err != nil {
+			return nil, fmt.Errorf("data source %s, %v", src.File, err)
+		}
+	}
+
+	if fields, err := parseRecordFields(v); err != nil {
+		return nil, fmt.Errorf("data source %s, %v", src.File, err)
+	} else {
+		src.Fields = fields
+	}
+
+	if src.Fields != nil && src.Queries != nil {
+		return nil, fmt.Errorf("data source %s, \"Query\" must be a single query selecting records when \"Y\" is "+
+			"given", src.File)
+	}
+	return src, nil
+}
+
+func (src *jsonSource) load() (Value, error) {
+	data, err := ioutil.ReadFile(src.File)
+	if err != nil {
+		return NewNull(), err
+	}
+
+	doc, err := NewJsonParser(string(data)).Parse()
+	if err != nil {
+		return NewNull(), err
+	}
+
+	if src.Queries != nil {
+		series := NewObject()
+		for _, name := range src.Names {
+			if val, err := JsonQuery(doc, src.Queries[name]); err != nil {
+				return NewNull(), fmt.Errorf("series %s, %v", name, err)
+			} else {
+				series.Value[name] = val
+			}
+		}
+		return Value{Type: kValueTypeObject, Object: series}, nil
+	}
+
+	if src.Fields == nil {
+		return JsonQuery(doc, src.Query)
+	}
+
+	q, err := CompileQuery(src.Query)
+	if err != nil {
+		return NewNull(), err
+	}
+
+	records := q.Eval(doc)
+	if len(records) == 0 {
+		return NewNull(), fmt.Errorf("query %q doesn't match anything", src.Query)
+	}
+
+	series := src.Fields.newSeries()
+	for _, x := range records {
+		series.add(x)
+	}
+
+	if series.incomplete != 0 {
+		fmt.Fprintf(os.Stderr, "data source %s: %d records, skipped %d values with missing or non numeric "+
+			"fields\n", src.File, len(records), series.incomplete)
+	}
+	return series.value(), nil
+}
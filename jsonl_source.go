@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Jsonl source reads newline delimited json, ie structured logs or the output of a
+// load test, where each line is a json object parsed by JsonParser. Fields are picked
+// by dotted paths:
+//
+//   {"File": "run.jsonl", "X": "ts", "Y": "latency.p99", "GroupBy": "service"}
+//
+// With "GroupBy" the records are split into one series per distinct value of that
+// field. A malformed line is either skipped or fails the whole source depending on
+// "OnError", skipped lines are counted and reported
+
+type jsonlSource struct {
+	File    string
+	OnError string
+	Fields  *recordFields
+}
+
+// recordFields picks the fields of json records that make up the series, it is
+// shared by every data source whose data are json objects
+type recordFields struct {
+	X       string
+	Y       []string
+	GroupBy string
+
+	// Y is given as a list so the output is always an object of series
+	MultipleY bool
+}
+
+const (
+	kOnErrorSkip = "skip"
+	kOnErrorFail = "fail"
+
+	// lines of a structured log can be long
+	kJsonlMaxLine = 16 * 1024 * 1024
+)
+
+func parseJsonlSource(v Value) (*jsonlSource, error) {
+	src := &jsonlSource{OnError: kOnErrorSkip}
+
+	if t, err := JsonObjectGetMultipleKey(v, "File", "file"); err != nil {
+		return nil, err
+	} else {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("data source \"File\" field is not a string")
+		} else {
+			src.File = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "OnError", "onerror"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("data source %s, \"OnError\" field is not a string", src.File)
+		} else {
+			switch val {
+			case kOnErrorSkip, kOnErrorFail:
+				src.OnError = val
+			default:
+				return nil, fmt.Errorf("data source %s, \"OnError\" %s is unknown, must be skip or fail",
+					src.File, val)
+			}
+		}
+	}
+
+	if _, err := JsonObjectGetMultipleKey(v, "Y", "y"); err != nil {
+		return nil, fmt.Errorf("data source %s, %v", src.File, err)
+	}
+
+	if fields, err := parseRecordFields(v); err != nil {
+		return nil, fmt.Errorf("data source %s, %v", src.File, err)
+	} else {
+		src.Fields = fields
+	}
+	return src, nil
+}
+
+// parseRecordFields reads "X", "Y" and "GroupBy", it returns nil when there is no "Y"
+func parseRecordFields(v Value) (*recordFields, error) {
+	fields := &recordFields{}
+
+	t, err := JsonObjectGetMultipleKey(v, "Y", "y")
+	if err != nil {
+		return nil, nil
+	}
+
+	switch t.Type {
+	case kValueTypeString:
+		fields.Y = []string{t.String}
+	case kValueTypeList:
+		for _, x := range t.List.Value {
+			if val, err := JsonGetString(x); err != nil {
+				return nil, fmt.Errorf("\"Y\" field must be a list of field paths")
+			} else {
+				fields.Y = append(fields.Y, val)
+			}
+		}
+		fields.MultipleY = true
+	default:
+		return nil, fmt.Errorf("\"Y\" field must be a field path or a list of them")
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "X", "x"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"X\" field is not a string")
+		} else {
+			fields.X = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "GroupBy", "groupby"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"GroupBy\" field is not a string")
+		} else {
+			fields.GroupBy = val
+		}
+	}
+	return fields, nil
+}
+
+// name of the series a record goes into
+func (f *recordFields) seriesName(group string, y string) string {
+	switch {
+	case f.GroupBy == "":
+		return y
+	case f.MultipleY:
+		return group + "/" + y
+	default:
+		return group
+	}
+}
+
+// recordSeries collects the records into series
+type recordSeries struct {
+	fields *recordFields
+	series *Object
+	order  []string
+
+	// number of values skipped since a field is missing or not a number
+	incomplete int
+}
+
+func (f *recordFields) newSeries() *recordSeries {
+	return &recordSeries{fields: f, series: NewObject()}
+}
+
+func (r *recordSeries) add(record Value) {
+	f := r.fields
+
+	group := ""
+	if f.GroupBy != "" {
+		g, err := JsonGetPath(record, f.GroupBy)
+		if err != nil {
+			r.incomplete++
+			return
+		}
+		switch g.Type {
+		case kValueTypeString:
+			group = g.String
+		case kValueTypeNull, kValueTypeObject, kValueTypeList:
+			r.incomplete++
+			return
+		default:
+			group = strings.TrimSpace(g.ToJson())
+		}
+	}
+
+	var xval Value
+	if f.X != "" {
+		var err error
+		if xval, err = JsonGetPath(record, f.X); err != nil ||
+			(xval.Type != kValueTypeNumber && xval.Type != kValueTypeString) {
+			r.incomplete++
+			return
+		}
+	}
+
+	for _, y := range f.Y {
+		yval, err := JsonGetPath(record, y)
+		if err != nil || yval.Type != kValueTypeNumber {
+			r.incomplete++
+			continue
+		}
+
+		var element Value
+		if f.X != "" {
+			pt := NewObject()
+			pt.Value["X"] = xval
+			pt.Value["Y"] = yval
+			element = Value{Type: kValueTypeObject, Object: pt}
+		} else {
+			element = yval
+		}
+
+		name := f.seriesName(group, y)
+		list, ok := r.series.Value[name]
+		if !ok {
+			list = Value{Type: kValueTypeList, List: NewList()}
+			r.series.Value[name] = list
+			r.order = append(r.order, name)
+		}
+		list.List.Value = append(list.List.Value, element)
+	}
+}
+
+// value gives the series in the same shape as the csv data source
+func (r *recordSeries) value() Value {
+	f := r.fields
+	if f.X == "" && f.GroupBy == "" && !f.MultipleY {
+		if len(r.order) == 0 {
+			return Value{Type: kValueTypeList, List: NewList()}
+		}
+		return r.series.Value[r.order[0]]
+	}
+	return Value{Type: kValueTypeObject, Object: r.series}
+}
+
+func (src *jsonlSource) load() (Value, error) {
+	f, err := os.Open(src.File)
+	if err != nil {
+		return NewNull(), err
+	}
+	defer f.Close()
+
+	series := src.Fields.newSeries()
+	total, malformed := 0, 0
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), kJsonlMaxLine)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		total++
+
+		record, err := NewJsonParser(text).Parse()
+		if err == nil && record.Type != kValueTypeObject {
+			err = fmt.Errorf("record is not an object but type %s", record.Type.GetName())
+		}
+		if err != nil {
+			if src.OnError == kOnErrorFail {
+				return NewNull(), fmt.Errorf("line %d is malformed, %v", line, err)
+			}
+			malformed++
+			continue
+		}
+		series.add(record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return NewNull(), fmt.Errorf("line %d cannot be read, %v", line+1, err)
+	}
+
+	if malformed != 0 || series.incomplete != 0 {
+		fmt.Fprintf(os.Stderr, "data source %s: %d records, skipped %d malformed lines and %d "+
+			"values with missing or non numeric fields\n", src.File, total, malformed, series.incomplete)
+	}
+	return series.value(), nil
+}
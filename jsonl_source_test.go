@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const kJsonlTestData = `{"ts": 1, "latency": {"p50": 10, "p99": 100}, "service": "api"}
+{"ts": 2, "latency": {"p50": 12, "p99": 120}, "service": "web"}
+
+{"ts": 3, "latency": {"p50": 11}, "service": "api"
+{"ts": 4, "latency": {"p50": "slow", "p99": 140}, "service": "api"}
+[5, 6]
+{"ts": 5, "latency": {"p50": 13, "p99": 150}, "service": 7}
+`
+
+func TestJsonlSource(t *testing.T) {
+	file := writeTestFile(t, "a.jsonl", kJsonlTestData)
+
+	for _, c := range []struct {
+		source string
+		want   string
+	}{
+		{`{"Y": "latency.p50"}`, `[10, 12, 13]`},
+		{`{"Y": ["latency.p50"]}`, `{"latency.p50": [10, 12, 13]}`},
+		{`{"X": "ts", "Y": "latency.p99"}`,
+			`{"latency.p99": [{"X": 1, "Y": 100}, {"X": 2, "Y": 120}, {"X": 4, "Y": 140}, {"X": 5, "Y": 150}]}`},
+		{`{"X": "ts", "Y": "latency.p50", "GroupBy": "service"}`,
+			`{"api": [{"X": 1, "Y": 10}], "web": [{"X": 2, "Y": 12}], "7": [{"X": 5, "Y": 13}]}`},
+		{`{"Y": ["latency.p50", "latency.p99"], "GroupBy": "service"}`,
+			`{"api/latency.p50": [10], "api/latency.p99": [100, 140], "web/latency.p50": [12],
+			  "web/latency.p99": [120], "7/latency.p50": [13], "7/latency.p99": [150]}`},
+		{`{"Y": "latency.p75"}`, `[]`},
+		{`{"Y": "latency.p50", "OnError": "skip", "Format": "ndjson"}`, `[10, 12, 13]`},
+	} {
+		got, err := ResolveData(withTestFile(t, c.source, file))
+		if err != nil {
+			t.Errorf("source %s failed, %v", c.source, err)
+			continue
+		}
+		want := mustParseValue(t, c.want)
+		if !sameJson(got, want) {
+			t.Errorf("source %s got %s, want %s", c.source, got.ToJson(), want.ToJson())
+		}
+	}
+}
+
+func TestJsonlSourceError(t *testing.T) {
+	file := writeTestFile(t, "a.jsonl", kJsonlTestData)
+
+	for _, c := range []struct {
+		source string
+		msg    string
+	}{
+		{`{"Y": "latency.p50", "OnError": "fail"}`, "line 4 is malformed"},
+		{`{"Y": "latency.p50", "OnError": "ignore"}`, `"OnError" ignore is unknown, must be skip or fail`},
+		{`{"Y": "latency.p50", "OnError": 1}`, `"OnError" field is not a string`},
+		{`{"X": "ts"}`, "Y"},
+		{`{"Y": 1}`, `"Y" field must be a field path or a list of them`},
+		{`{"Y": ["ts", 1]}`, `"Y" field must be a list of field paths`},
+		{`{"X": 1, "Y": "ts"}`, `"X" field is not a string`},
+		{`{"Y": "ts", "GroupBy": ["service"]}`, `"GroupBy" field is not a string`},
+	} {
+		_, err := ResolveData(withTestFile(t, c.source, file))
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("source %s got error %v, want %q", c.source, err, c.msg)
+		}
+	}
+
+	notObject := writeTestFile(t, "b.jsonl", "[1, 2]\n")
+	_, err := ResolveData(withTestFile(t, `{"Y": "a", "OnError": "fail"}`, notObject))
+	if err == nil || !strings.Contains(err.Error(), "line 1 is malformed, record is not an object but type list") {
+		t.Errorf("source of a list got error %v", err)
+	}
+}
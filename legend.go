@@ -0,0 +1,511 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+	"image"
+	"image/color"
+	"math"
+)
+
+// LegendConfig is the "Legend" block understood by every plotter. The chart draws the
+// legend itself instead of leaving it to gonum, which only knows the four corners of
+// the data area and a single column
+//
+//	"Legend": {
+//	    "Position": "right",
+//	    "Columns": 2,
+//	    "FontSize": 9,
+//	    "Box": {"Color": "white", "Border": {"Color": "gray", "Width": 0.5}},
+//	    "SampleSize": 16,
+//	    "Exclude": ["baseline"]
+//	}
+//
+// "Position" is a corner of the data area, "right" or "bottom" to put the legend next
+// to the plot. Without it the legend starts in the corner given by the theme and moves
+// to another corner, or out to the right, when it would cover the data. "Box" is true
+// for a box in the colors of the theme. "Legend": false hides the legend and a string
+// is a shorthand for the position
+type LegendConfig struct {
+	Position string
+
+	// the position was not given, so the legend is free to move
+	Auto bool
+
+	// 0 for one column, or as many as fit when the legend is at the bottom
+	Columns int
+
+	// 0 for the size of the theme
+	FontSize vg.Length
+
+	Box    bool
+	Fill   color.Color
+	Border draw.LineStyle
+
+	// the width of the thumbnail of each series
+	SampleSize vg.Length
+
+	Hide bool
+
+	// names of the series not listed
+	Exclude map[string]bool
+}
+
+const (
+	kLegendRight  = "right"
+	kLegendBottom = "bottom"
+)
+
+var (
+	// room between the legend and the edge of what it is placed against
+	kLegendMargin = vg.Points(6)
+
+	// room inside of the box
+	kLegendPadding = vg.Points(4)
+
+	// room between the thumbnail and its text, and between columns
+	kLegendGap       = vg.Points(4)
+	kLegendColumnGap = vg.Points(10)
+
+	// the resolution the data is drawn at to find out where the legend would cover it
+	kLegendProbeDPI = 36
+)
+
+// NewLegendConfig is the legend as the theme has it
+func NewLegendConfig(theme *Theme) *LegendConfig {
+	l := &LegendConfig{
+		Position:   theme.Legend,
+		Auto:       true,
+		Fill:       theme.Background,
+		Border:     draw.LineStyle{Color: theme.Foreground, Width: vg.Points(0.5)},
+		SampleSize: vg.Points(20),
+		Exclude:    map[string]bool{},
+	}
+	if theme.Legend == kLegendNone {
+		l.Position = kLegendTopRight
+		l.Hide = true
+	}
+	return l
+}
+
+// ParseLegendConfig reads the legend on top of the one of the theme
+func ParseLegendConfig(v Value, theme *Theme) (*LegendConfig, error) {
+	l := NewLegendConfig(theme)
+
+	switch v.Type {
+	case kValueTypeBoolean:
+		l.Hide = !v.Boolean
+		return l, nil
+	case kValueTypeString:
+		if err := l.setPosition(v.String); err != nil {
+			return nil, err
+		}
+		return l, nil
+	case kValueTypeObject:
+	default:
+		return nil, fmt.Errorf("value must be a boolean, a position or an object but got type %s", v.Type.GetName())
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Position", "position"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Position\" field is not a string")
+		} else if err := l.setPosition(val); err != nil {
+			return nil, err
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Hide", "hide"); err == nil {
+		if val, err := JsonGetBoolean(t); err != nil {
+			return nil, fmt.Errorf("\"Hide\" field is not a boolean")
+		} else {
+			l.Hide = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Columns", "columns"); err == nil {
+		if val, err := JsonGetNumber(t); err != nil || val < 1 || val != math.Floor(val) {
+			return nil, fmt.Errorf("\"Columns\" field must be a positive integer")
+		} else {
+			l.Columns = int(val)
+		}
+	}
+
+	for _, x := range []struct {
+		keys []string
+		ptr  *vg.Length
+	}{
+		{[]string{"FontSize", "fontsize"}, &l.FontSize},
+		{[]string{"SampleSize", "samplesize"}, &l.SampleSize},
+	} {
+		if t, err := JsonObjectGetMultipleKey(v, x.keys...); err == nil {
+			if val, err := JsonGetNumber(t); err != nil || val <= 0 {
+				return nil, fmt.Errorf("\"%s\" field must be a positive number", x.keys[0])
+			} else {
+				*x.ptr = vg.Points(val)
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Box", "box"); err == nil {
+		switch t.Type {
+		case kValueTypeBoolean:
+			l.Box = t.Boolean
+		case kValueTypeObject:
+			l.Box = true
+			if c, err := JsonObjectGetMultipleKey(t, "Color", "color"); err == nil {
+				if clr, err := JsonToColor(c, theme.Palette); err != nil {
+					return nil, fmt.Errorf("\"Box\" field \"Color\" is invalid, %v", err)
+				} else {
+					l.Fill = clr
+				}
+			}
+			if b, err := JsonObjectGetMultipleKey(t, "Border", "border"); err == nil {
+				if sty, err := JsonObjectToLineStyle(b, l.Border, theme.Palette); err != nil {
+					return nil, fmt.Errorf("\"Box\" field \"Border\" is invalid, %v", err)
+				} else {
+					l.Border = sty
+				}
+			}
+		default:
+			return nil, fmt.Errorf("\"Box\" field must be a boolean or an object but got type %s", t.Type.GetName())
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Exclude", "exclude"); err == nil {
+		if t.Type != kValueTypeList {
+			return nil, fmt.Errorf("\"Exclude\" field must be a list of series names")
+		}
+		for _, x := range t.List.Value {
+			if val, err := JsonGetString(x); err != nil {
+				return nil, fmt.Errorf("\"Exclude\" field must be a list of series names")
+			} else {
+				l.Exclude[val] = true
+			}
+		}
+	}
+
+	return l, nil
+}
+
+func (l *LegendConfig) setPosition(val string) error {
+	switch val {
+	case kLegendTopRight, kLegendTopLeft, kLegendBottomRight, kLegendBottomLeft, kLegendRight, kLegendBottom:
+		l.Position = val
+		l.Auto = false
+		l.Hide = false
+		return nil
+	case kLegendNone:
+		l.Hide = true
+		return nil
+	default:
+		return fmt.Errorf("legend position %s is unknown, must be top-right, top-left, bottom-right, "+
+			"bottom-left, right, bottom or none", val)
+	}
+}
+
+func (l *LegendConfig) outside() bool {
+	return l.Position == kLegendRight || l.Position == kLegendBottom
+}
+
+// legendEntry is one line of the legend
+type legendEntry struct {
+	Name   string
+	Thumbs []plot.Thumbnailer
+}
+
+// inLegend tells if the series gets an entry in the legend, the html page follows it
+// as well
+func (c *Chart) inLegend(s *Series) bool {
+	return !c.Legend.Hide && s.Name != "" && !s.NoLegend && !c.Legend.Exclude[s.Name]
+}
+
+// legendEntries are the named series which can draw a thumbnail, in the order they
+// were added
+func (c *Chart) legendEntries() []legendEntry {
+	if c.Legend.Hide {
+		return nil
+	}
+
+	ret := []legendEntry{}
+	for _, s := range c.Series {
+		if !c.inLegend(s) {
+			continue
+		}
+		thumbs := []plot.Thumbnailer{}
+		for _, x := range s.Plotters {
+			if t, ok := x.(plot.Thumbnailer); ok {
+				thumbs = append(thumbs, t)
+			}
+		}
+		if len(thumbs) != 0 {
+			ret = append(ret, legendEntry{Name: s.Name, Thumbs: thumbs})
+		}
+	}
+	return ret
+}
+
+// legendLayout is the size of every part of the legend
+type legendLayout struct {
+	entries []legendEntry
+	sty     draw.TextStyle
+	sample  vg.Length
+	box     bool
+
+	cols      int
+	colWidth  []vg.Length
+	rowHeight vg.Length
+	width     vg.Length
+	height    vg.Length
+}
+
+// layoutLegend measures the legend, the legend at the bottom gets as many columns as
+// fit into maxWidth unless the number is given
+func (c *Chart) layoutLegend(entries []legendEntry, maxWidth vg.Length) *legendLayout {
+	l := &legendLayout{
+		entries: entries,
+		sty:     c.Plot.Legend.TextStyle,
+		sample:  c.Legend.SampleSize,
+		box:     c.Legend.Box,
+		cols:    c.Legend.Columns,
+	}
+	l.sty.XAlign = draw.XLeft
+	l.sty.YAlign = draw.YCenter
+
+	l.rowHeight = l.sty.Height("M")
+	if l.rowHeight < l.sample/2 {
+		l.rowHeight = l.sample / 2
+	}
+
+	if c.Legend.Columns == 0 && c.Legend.Position == kLegendBottom {
+		l.cols = len(entries)
+		for l.cols > 1 && l.measure() > maxWidth {
+			l.cols--
+		}
+	}
+	l.measure()
+	return l
+}
+
+// measure works out the size of the legend with its number of columns
+func (l *legendLayout) measure() vg.Length {
+	if l.cols > len(l.entries) {
+		l.cols = len(l.entries)
+	}
+	if l.cols < 1 {
+		l.cols = 1
+	}
+
+	l.colWidth = make([]vg.Length, l.cols)
+	for idx, e := range l.entries {
+		w := l.sample + kLegendGap + textWidth(l.sty, e.Name)
+		if col := idx % l.cols; w > l.colWidth[col] {
+			l.colWidth[col] = w
+		}
+	}
+
+	l.width = 0
+	for idx, w := range l.colWidth {
+		if idx != 0 {
+			l.width += kLegendColumnGap
+		}
+		l.width += w
+	}
+	rows := (len(l.entries) + l.cols - 1) / l.cols
+	l.height = vg.Length(rows) * l.rowHeight
+
+	if l.box {
+		l.width += 2 * kLegendPadding
+		l.height += 2 * kLegendPadding
+	}
+	return l.width
+}
+
+// draw puts the legend with its top left corner at pt
+func (l *legendLayout) draw(dc draw.Canvas, pt vg.Point, fill color.Color, border draw.LineStyle) {
+	if l.box {
+		rect := []vg.Point{
+			{X: pt.X, Y: pt.Y - l.height},
+			{X: pt.X + l.width, Y: pt.Y - l.height},
+			{X: pt.X + l.width, Y: pt.Y},
+			{X: pt.X, Y: pt.Y},
+		}
+		if fill != nil {
+			dc.FillPolygon(fill, rect)
+		}
+		if border.Color != nil && border.Width > 0 {
+			dc.StrokeLines(border, append(rect, rect[0]))
+		}
+		pt.X += kLegendPadding
+		pt.Y -= kLegendPadding
+	}
+
+	for idx, e := range l.entries {
+		row, col := idx/l.cols, idx%l.cols
+		x := pt.X
+		for _, w := range l.colWidth[:col] {
+			x += w + kLegendColumnGap
+		}
+		top := pt.Y - vg.Length(row)*l.rowHeight
+
+		icon := &draw.Canvas{Canvas: dc.Canvas, Rectangle: vg.Rectangle{
+			Min: vg.Point{X: x, Y: top - l.rowHeight},
+			Max: vg.Point{X: x + l.sample, Y: top},
+		}}
+		for _, t := range e.Thumbs {
+			t.Thumbnail(icon)
+		}
+		dc.FillText(l.sty, vg.Point{X: x + l.sample + kLegendGap, Y: top - l.rowHeight/2}, e.Name)
+	}
+}
+
+// corner is the top left point of the legend in the corner of the data area
+func (l *legendLayout) corner(da draw.Canvas, position string) vg.Point {
+	pt := vg.Point{X: da.Max.X - kLegendMargin - l.width, Y: da.Max.Y - kLegendMargin}
+	if position == kLegendTopLeft || position == kLegendBottomLeft {
+		pt.X = da.Min.X + kLegendMargin
+	}
+	if position == kLegendBottomRight || position == kLegendBottomLeft {
+		pt.Y = da.Min.Y + kLegendMargin + l.height
+	}
+	return pt
+}
+
+// dataCanvas is the data area of the chart drawn onto dc
+func (c *Chart) dataCanvas(dc draw.Canvas) draw.Canvas {
+	if c.Right != nil {
+		syncRightAxis(c.Plot, c.Right)
+		dc = reserveRightAxis(dc, c.Right)
+	}
+	return c.Plot.DataCanvas(dc)
+}
+
+// coverage draws the series alone into a small transparent image and tells for each
+// of the rectangles how much of it is covered by the data, from 0 to 1
+func (c *Chart) coverage(da draw.Canvas, rects []vg.Rectangle) []float64 {
+	ret := make([]float64, len(rects))
+	width, height := da.Max.X, da.Max.Y
+	if width <= 0 || height <= 0 {
+		return ret
+	}
+
+	probe := vgimg.NewWith(
+		vgimg.UseWH(width, height),
+		vgimg.UseDPI(kLegendProbeDPI),
+		vgimg.UseBackgroundColor(color.Transparent),
+	)
+	pc := draw.Canvas{Canvas: probe, Rectangle: da.Rectangle}
+	for _, s := range c.Series {
+		plt := c.Plot
+		if s.Right {
+			plt = c.Right
+		}
+		for _, p := range s.Plotters {
+			p.Plot(pc, plt)
+		}
+	}
+
+	img := probe.Image()
+	if img == nil {
+		return ret
+	}
+	bounds := img.Bounds()
+	scale := float64(kLegendProbeDPI) / float64(vg.Inch)
+
+	for idx, r := range rects {
+		x0, x1 := int(float64(r.Min.X)*scale), int(math.Ceil(float64(r.Max.X)*scale))
+		y0, y1 := int(float64(height-r.Max.Y)*scale), int(math.Ceil(float64(height-r.Min.Y)*scale))
+
+		total, covered := 0, 0
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				if !image.Pt(x, y).In(bounds) {
+					continue
+				}
+				total++
+				if _, _, _, a := img.At(x, y).RGBA(); a != 0 {
+					covered++
+				}
+			}
+		}
+		if total != 0 {
+			ret[idx] = float64(covered) / float64(total)
+		}
+	}
+	return ret
+}
+
+// placeLegend picks the corner for a legend that is free to move, the first one in
+// the order that covers the least data. An empty position means no corner is good
+// enough and the legend should go out to the right
+func (c *Chart) placeLegend(da draw.Canvas, l *legendLayout) string {
+	corners := []string{c.Legend.Position}
+	for _, x := range []string{kLegendTopRight, kLegendTopLeft, kLegendBottomRight, kLegendBottomLeft} {
+		if x != c.Legend.Position {
+			corners = append(corners, x)
+		}
+	}
+
+	rects := make([]vg.Rectangle, len(corners))
+	for idx, x := range corners {
+		pt := l.corner(da, x)
+		rects[idx] = vg.Rectangle{
+			Min: vg.Point{X: pt.X, Y: pt.Y - l.height},
+			Max: vg.Point{X: pt.X + l.width, Y: pt.Y},
+		}
+	}
+
+	// a couple of stray pixels, like the tail of a line, doesn't count
+	best, bestCoverage := "", 0.02
+	for idx, x := range c.coverage(da, rects) {
+		if x < bestCoverage {
+			best, bestCoverage = corners[idx], x
+		}
+	}
+	return best
+}
+
+// drawWithLegend draws the chart through drawPlot and puts the legend where it was
+// asked to go, making room for it when it goes next to the plot
+func (c *Chart) drawWithLegend(dc draw.Canvas, drawPlot func(draw.Canvas)) {
+	entries := c.legendEntries()
+	if len(entries) == 0 {
+		drawPlot(dc)
+		return
+	}
+
+	position := c.Legend.Position
+	l := c.layoutLegend(entries, dc.Max.X-dc.Min.X-2*kLegendMargin)
+
+	if !c.Legend.outside() {
+		da := c.dataCanvas(dc)
+		if c.Legend.Auto {
+			if position = c.placeLegend(da, l); position == "" {
+				position = kLegendRight
+			}
+		}
+		if position != kLegendRight {
+			drawPlot(dc)
+			l.draw(dc, l.corner(da, position), c.Legend.Fill, c.Legend.Border)
+			return
+		}
+	}
+
+	pc := dc
+	if position == kLegendRight {
+		pc.Max.X -= l.width + 2*kLegendMargin
+	} else {
+		pc.Min.Y += l.height + 2*kLegendMargin
+	}
+	drawPlot(pc)
+
+	da := c.dataCanvas(pc)
+	if position == kLegendRight {
+		l.draw(dc, vg.Point{X: pc.Max.X + kLegendMargin, Y: da.Max.Y}, c.Legend.Fill, c.Legend.Border)
+	} else {
+		x := (da.Min.X + da.Max.X - l.width) / 2
+		l.draw(dc, vg.Point{X: x, Y: dc.Min.Y + kLegendMargin + l.height}, c.Legend.Fill, c.Legend.Border)
+	}
+}
@@ -5,93 +5,169 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
-var input = flag.String("input", "-", "the input json for plotting, default to read from stdin")
+// setFlags are the variables given by -set name=value, which can be repeated
+type setFlags map[string]string
 
-func getInput() ([]byte, error) {
-	if *input == "-" {
-		return ioutil.ReadAll(os.Stdin)
-	} else {
-		return ioutil.ReadFile(*input)
+func (s setFlags) String() string {
+	names := []string{}
+	for k, v := range s {
+		names = append(names, k+"="+v)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (s setFlags) Set(x string) error {
+	idx := strings.Index(x, "=")
+	if idx <= 0 {
+		return fmt.Errorf("variable %s must be written as name=value", x)
 	}
+	s[x[:idx]] = x[idx+1:]
+	return nil
 }
 
-func doSinglePlot(index int, jdom Value) error {
-	var plotter Plotter
-	var path string
+// specFlags are the flags of the commands which read a spec
+type specFlags struct {
+	input string
+	fonts string
+	sets  setFlags
+}
+
+func newSpecFlags(fs *flag.FlagSet) *specFlags {
+	f := &specFlags{sets: setFlags{}}
+	fs.StringVar(&f.input, "input", "-", "the input json for plotting, default to read from stdin")
+	fs.StringVar(&f.fonts, "fonts", "", "the directory of TTF/OTF fonts which can be used by \"Font\" by their names")
+	fs.Var(f.sets, "set", "sets the variable of the spec as name=value, can be repeated")
+	return f
+}
 
-	if t, err := JsonObjectGetMultipleKey(jdom, "Type", "type"); err != nil {
-		return fmt.Errorf("index %d,%v", index, err)
+func (f *specFlags) getInput() ([]byte, error) {
+	if f.input == "-" {
+		return ioutil.ReadAll(os.Stdin)
 	} else {
-		if name, err := JsonGetString(t); err != nil {
-			return fmt.Errorf("index %d,\"Type\" field is not a string", index)
-		} else {
-			plotter = NewPlotter(name)
-			if plotter == nil {
-				return fmt.Errorf("index %d,plotter %s doesn't support", index, name)
-			}
-		}
+		return ioutil.ReadFile(f.input)
 	}
+}
 
-	if t, err := JsonObjectGetMultipleKey(jdom, "Path", "path"); err != nil {
-		return fmt.Errorf("index %d,%v", index, err)
-	} else {
-		if name, err := JsonGetString(t); err != nil {
-			return fmt.Errorf("index %d,\"Path\" field is not a string", index)
-		} else {
-			path = name
+// load loads the fonts and parses the spec of the input
+func (f *specFlags) load() (*Spec, error) {
+	if f.fonts != "" {
+		skipped, err := LoadFontDir(f.fonts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load fonts from %s with error %v", f.fonts, err)
+		}
+		for _, x := range skipped {
+			fmt.Fprintf(os.Stderr, "%v, skipped\n", x)
 		}
 	}
 
-	if d, err := JsonObjectGetMultipleKey(jdom, "Config", "config"); err != nil {
-		return fmt.Errorf("index %d,%v", index, err)
-	} else {
-		return plotter.Plot(path, d)
+	data, err := f.getInput()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read input specified as %s with error %v", f.input, err)
 	}
+
+	jdom, err := NewJsonParser(string(data)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	// the paths of the spec are relative to the file it is read from
+	dir := ""
+	if f.input != "-" {
+		dir = filepath.Dir(f.input)
+	}
+	return ParseSpec(jdom, f.sets, dir)
 }
 
-func doPlot(data string) error {
-	jdom, err := NewJsonParser(data).Parse()
+func doSinglePlot(index int, jdom Value) *jobResult {
+	res := newJobResult(index, jdom)
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+
+	job, err := ParseJob(index, jdom, true)
 	if err != nil {
-		return err
+		return res.fail(err)
 	}
 
-	if jdom.Type != kValueTypeObject && jdom.Type != kValueTypeList {
-		return fmt.Errorf("the root element of input json *MUST* be an object")
+	chart, err := job.Render()
+	if err != nil {
+		return res.fail(err)
 	}
 
-	succ := 0
-	jobs := []Value{}
+	if err := chart.Save(job.Path); err != nil {
+		return res.fail(fmt.Errorf("index %d,%s cannot save file to path %s due to reason %v",
+			index, job.Plotter.GetName(), job.Path, err))
+	}
+	res.Status = kJobSucceeded
+	res.Size = fileSize(job.Path)
+	return res
+}
 
-	if jdom.Type == kValueTypeList {
-		jobs = jdom.List.Value
-	} else {
-		jobs = append(jobs, jdom)
+// doPlot renders every job of the spec. The jobs after a failed one are skipped unless
+// keepGoing is set
+func doPlot(spec *Spec, keepGoing bool) *runReport {
+	if spec.Report != nil {
+		return doReport(spec, keepGoing)
 	}
 
-	for idx, x := range jdom.List.Value {
-		if err := doSinglePlot(idx, x); err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
+	rr := &runReport{}
+	jobs := spec.Jobs
+
+	for idx, x := range jobs {
+		if !keepGoing && rr.count(kJobFailed) != 0 {
+			rr.Jobs = append(rr.Jobs, newJobResult(idx, x))
+			continue
+		}
+
+		res := doSinglePlot(idx, x)
+		rr.Jobs = append(rr.Jobs, res)
+		if res.Err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", res.Err)
 		} else {
-			succ++
 			fmt.Fprintf(os.Stdout, "index %d plot succeeded\n", idx)
 		}
 	}
-	fmt.Fprintf(os.Stdout, "Total Job %d; Successful %d; Failed %d\n", len(jobs), succ, len(jobs)-succ)
-	return nil
+	fmt.Fprintf(os.Stdout, "Total Job %d; Successful %d; Failed %d; Skipped %d\n", len(jobs),
+		rr.count(kJobSucceeded), rr.count(kJobFailed), rr.count(kJobSkipped))
+	return rr
 }
 
-func main() {
-	flag.Parse()
-	data, err := getInput()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "cannot read input specified as %s with error %v", *input, err)
-		os.Exit(1)
+// doValidate parses and renders every job without saving anything, it returns the
+// number of invalid jobs
+func doValidate(spec *Spec) int {
+	invalid := 0
+	jobs := spec.Jobs
+	for idx, x := range jobs {
+		job, err := ParseJob(idx, x, spec.Report == nil)
+		if err == nil {
+			_, err = job.Render()
+		}
+		if err != nil {
+			invalid++
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		} else {
+			fmt.Fprintf(os.Stdout, "index %d is valid\n", idx)
+		}
 	}
-	if err := doPlot(string(data)); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+	fmt.Fprintf(os.Stdout, "Total Job %d; Valid %d; Invalid %d\n", len(jobs), len(jobs)-invalid, invalid)
+	return invalid
+}
+
+// doFmt writes the json of the file back out with sorted keys and the same indent,
+// data is returned as is when it is not valid json
+func doFmt(data string) (string, error) {
+	jdom, err := NewJsonParser(data).Parse()
+	if err != nil {
+		return data, err
 	}
-	os.Exit(0)
+	return jdom.ToJson() + "\n", nil
+}
+
+func main() {
+	os.Exit(runCommand(filepath.Base(os.Args[0]), os.Args[1:]))
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"image/color"
+	"math"
+)
+
+// Overlays are small plotters drawn on top of the data to point something out,
+// ie the mean of a histogram
+
+// vLine is a vertical line across the whole data area at X, the label is written at
+// the top next to the line
+type vLine struct {
+	X     float64
+	Label string
+	draw.LineStyle
+}
+
+func (l *vLine) Plot(c draw.Canvas, plt *plot.Plot) {
+	trX, _ := plt.Transforms(&c)
+	x := trX(l.X)
+	if x < c.Min.X || x > c.Max.X {
+		return
+	}
+	c.StrokeLine2(l.LineStyle, x, c.Min.Y, x, c.Max.Y)
+
+	if l.Label != "" {
+		sty := overlayTextStyle(plt, l.Color)
+		sty.XAlign = draw.XLeft
+		sty.YAlign = draw.YTop
+		c.FillText(sty, vg.Point{X: x + vg.Points(2), Y: c.Max.Y - vg.Points(2)}, l.Label)
+	}
+}
+
+// DataRange only covers X, the infinite Y bounds leave the Y range untouched
+func (l *vLine) DataRange() (xmin, xmax, ymin, ymax float64) {
+	return l.X, l.X, math.Inf(1), math.Inf(-1)
+}
+
+func (l *vLine) Texts() []string { return []string{l.Label} }
+
+func (l *vLine) Thumbnail(c *draw.Canvas) {
+	x := c.Center().X
+	c.StrokeLine2(l.LineStyle, x, c.Min.Y, x, c.Max.Y)
+}
+
+// hLine is a horizontal line across the whole data area at Y, the label is written
+// at the right end above the line
+type hLine struct {
+	Y     float64
+	Label string
+	draw.LineStyle
+}
+
+func (l *hLine) Plot(c draw.Canvas, plt *plot.Plot) {
+	_, trY := plt.Transforms(&c)
+	y := trY(l.Y)
+	if y < c.Min.Y || y > c.Max.Y {
+		return
+	}
+	c.StrokeLine2(l.LineStyle, c.Min.X, y, c.Max.X, y)
+
+	if l.Label != "" {
+		sty := overlayTextStyle(plt, l.Color)
+		sty.XAlign = draw.XRight
+		c.FillText(sty, vg.Point{X: c.Max.X - vg.Points(2), Y: y + vg.Points(2)}, l.Label)
+	}
+}
+
+// DataRange only covers Y, the infinite X bounds leave the X range untouched
+func (l *hLine) DataRange() (xmin, xmax, ymin, ymax float64) {
+	return math.Inf(1), math.Inf(-1), l.Y, l.Y
+}
+
+func (l *hLine) Texts() []string { return []string{l.Label} }
+
+func (l *hLine) Thumbnail(c *draw.Canvas) {
+	y := c.Center().Y
+	c.StrokeLine2(l.LineStyle, c.Min.X, y, c.Max.X, y)
+}
+
+// overlayTextStyle is the font of the legend in the color of the overlay
+func overlayTextStyle(plt *plot.Plot, clr color.Color) draw.TextStyle {
+	sty := plt.Legend.TextStyle
+	if clr != nil {
+		sty.Color = clr
+	}
+	return sty
+}
+
+// textBox draws lines of text in the top right corner of the data area with the
+// font of the legend
+type textBox struct {
+	Lines      []string
+	Padding    vg.Length
+	Background color.Color
+	draw.LineStyle
+}
+
+func newTextBox(lines ...string) *textBox {
+	return &textBox{
+		Lines:      lines,
+		Padding:    vg.Points(4),
+		Background: color.NRGBA{R: 255, G: 255, B: 255, A: 220},
+		LineStyle: draw.LineStyle{
+			Color: color.Gray{Y: 128},
+			Width: vg.Points(0.5),
+		},
+	}
+}
+
+func (b *textBox) Texts() []string { return b.Lines }
+
+func (b *textBox) Plot(c draw.Canvas, plt *plot.Plot) {
+	sty := plt.Legend.TextStyle
+	sty.XAlign = draw.XLeft
+	sty.YAlign = draw.YTop
+
+	var width, height vg.Length
+	for _, line := range b.Lines {
+		if w := textWidth(sty, line); w > width {
+			width = w
+		}
+		height += sty.Height(line)
+	}
+	width += 2 * b.Padding
+	height += 2 * b.Padding
+
+	max := vg.Point{X: c.Max.X - b.Padding, Y: c.Max.Y - b.Padding}
+	min := vg.Point{X: max.X - width, Y: max.Y - height}
+	box := []vg.Point{min, {X: max.X, Y: min.Y}, max, {X: min.X, Y: max.Y}}
+
+	c.FillPolygon(b.Background, box)
+	c.StrokeLines(b.LineStyle, append(box, min))
+
+	pt := vg.Point{X: min.X + b.Padding, Y: max.Y - b.Padding}
+	for _, line := range b.Lines {
+		c.FillText(sty, pt, line)
+		pt.Y -= sty.Height(line)
+	}
+}
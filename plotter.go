@@ -1,14 +1,34 @@
 package main
 
 // Plotter is a interface that describe the type of underlying plot implementation
-// It accepts a string represent for saved file path and another [string]Value object
-// represents the input data
+// It accepts a [string]Value object represents the input data and renders it into
+// a Chart which can later be saved into a file
 type Plotter interface {
 
-	// Plot input data described by [string]Value and save the plotted result into
-	// a file specified by the 1st argument
-	Plot(string, Value) error
+	// Render input data described by [string]Value into a chart, the chart is
+	// not saved by the plotter
+	Render(Value) (*Chart, error)
 
 	// Get the name of this plotter
 	GetName() string
 }
+
+// OptionDoc documents an option of the config of a plotter. Type is the json types it
+// takes joined by "|", ie "string|object", and Default is empty when there is none
+type OptionDoc struct {
+	Name    string
+	Type    string
+	Default string
+	Doc     string
+}
+
+// Describer is implemented by the plotters which document their config, it is what
+// the describe and schema commands print
+type Describer interface {
+
+	// a sentence on what the plotter draws
+	Summary() string
+
+	// the options of the plotter itself, the ones of every chart are in chartOptionDocs
+	Options() []OptionDoc
+}
@@ -0,0 +1,619 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query is a small path language to pick values out of an arbitrary json document,
+// ie the dump of some API whose shape has nothing to do with a plot spec. It is a
+// subset of JSONPath:
+//
+//   $.runs[0].latency        child keys and list indexes, negative index from the end
+//   $.runs[*].latency        wildcard over every element of a list or object
+//   $..latency               recursive descent, every latency at any depth
+//   $.runs[1:3]              slice of a list
+//   $['odd key']             quoted key
+//   $.runs[?(@.ok == true && @.ms < 100)].ms
+//                            filter, @ is the element being tested
+//
+// A query starting with "/" is a JSON Pointer (RFC 6901) and one without "$" or "/"
+// is a dotted path relative to the root, ie "runs.0.latency"
+
+const (
+	kQueryChild = iota
+	kQueryIndex
+	kQueryWildcard
+	kQuerySlice
+	kQueryFilter
+)
+
+type querySegment struct {
+	kind int
+
+	// kQueryChild, a key of an object or an index when the value is a list
+	name string
+
+	// kQueryIndex and kQuerySlice
+	index    int
+	hasStart bool
+	start    int
+	hasEnd   bool
+	end      int
+
+	filter *queryFilter
+
+	// the segment is applied to the value and all of its descendants
+	recursive bool
+}
+
+// a filter is a disjunction of conjunctions of comparisons
+type queryFilter struct {
+	or [][]queryCompare
+}
+
+type queryCompare struct {
+	path []querySegment
+
+	// empty when only testing that the path exists
+	op      string
+	literal Value
+}
+
+type Query struct {
+	Text     string
+	segments []querySegment
+
+	// the query can only match a single value, ie no wildcard, slice or filter
+	definite bool
+}
+
+type queryParser struct {
+	text string
+	pos  int
+
+	// a dotted path is parsed with "$." in front of it, errors are reported on the
+	// text as written
+	prefix int
+}
+
+func (p *queryParser) error(format string, args ...interface{}) error {
+	return fmt.Errorf("query %q around %d, %s", p.text[p.prefix:], p.pos-p.prefix, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.text)
+}
+
+func (p *queryParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+func (p *queryParser) skipSpace() {
+	for !p.eof() && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *queryParser) consume(s string) bool {
+	if strings.HasPrefix(p.text[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// name of an unquoted key, inside of a filter it also stops at operators
+func (p *queryParser) name(inFilter bool) string {
+	start := p.pos
+	for !p.eof() {
+		c := p.text[p.pos]
+		if c == '.' || c == '[' {
+			break
+		}
+		if inFilter && strings.IndexByte(" =!<>&|)", c) >= 0 {
+			break
+		}
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+func (p *queryParser) quoted() (string, error) {
+	quote := p.peek()
+	p.pos++
+
+	buf := strings.Builder{}
+	for !p.eof() {
+		c := p.text[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return buf.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", p.error("unterminated string")
+			}
+			buf.WriteByte(p.text[p.pos])
+			p.pos++
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", p.error("unterminated string")
+}
+
+func (p *queryParser) integer() (int, bool) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for !p.eof() && p.text[p.pos] >= '0' && p.text[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.text[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return 0, false
+	}
+	return n, true
+}
+
+func (p *queryParser) segments(inFilter bool) ([]querySegment, error) {
+	ret := []querySegment{}
+	for !p.eof() {
+		recursive := false
+
+		switch p.peek() {
+		case '.':
+			p.pos++
+			if p.peek() == '.' {
+				p.pos++
+				recursive = true
+			}
+			if p.peek() == '[' {
+				// $..[0], the bracket is parsed below
+				break
+			}
+			if p.consume("*") {
+				ret = append(ret, querySegment{kind: kQueryWildcard, recursive: recursive})
+				continue
+			}
+			name := p.name(inFilter)
+			if name == "" {
+				return nil, p.error("expect a key after \".\"")
+			}
+			ret = append(ret, querySegment{kind: kQueryChild, name: name, recursive: recursive})
+			continue
+
+		case '[':
+
+		default:
+			if inFilter {
+				return ret, nil
+			}
+			return nil, p.error("unexpected character %q", p.peek())
+		}
+
+		if p.peek() != '[' {
+			return nil, p.error("expect a \"[\"")
+		}
+		p.pos++
+		p.skipSpace()
+
+		seg, err := p.bracket()
+		if err != nil {
+			return nil, err
+		}
+		seg.recursive = recursive
+
+		p.skipSpace()
+		if !p.consume("]") {
+			return nil, p.error("expect a \"]\"")
+		}
+		ret = append(ret, seg)
+	}
+	return ret, nil
+}
+
+// the selector inside of brackets
+func (p *queryParser) bracket() (querySegment, error) {
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		return querySegment{kind: kQueryWildcard}, nil
+
+	case c == '\'' || c == '"':
+		name, err := p.quoted()
+		if err != nil {
+			return querySegment{}, err
+		}
+		return querySegment{kind: kQueryChild, name: name}, nil
+
+	case c == '?':
+		p.pos++
+		if !p.consume("(") {
+			return querySegment{}, p.error("expect a \"(\" after \"?\"")
+		}
+		filter, err := p.filter()
+		if err != nil {
+			return querySegment{}, err
+		}
+		if !p.consume(")") {
+			return querySegment{}, p.error("expect a \")\" closing the filter")
+		}
+		return querySegment{kind: kQueryFilter, filter: filter}, nil
+
+	default:
+		seg := querySegment{kind: kQueryIndex}
+		if n, ok := p.integer(); ok {
+			seg.index = n
+			seg.hasStart = true
+			seg.start = n
+		}
+		if !p.consume(":") {
+			if !seg.hasStart {
+				return querySegment{}, p.error("expect an index, a slice, a quoted key, \"*\" or a filter")
+			}
+			return seg, nil
+		}
+
+		seg.kind = kQuerySlice
+		if n, ok := p.integer(); ok {
+			seg.hasEnd = true
+			seg.end = n
+		}
+		return seg, nil
+	}
+}
+
+func (p *queryParser) filter() (*queryFilter, error) {
+	f := &queryFilter{}
+	and := []queryCompare{}
+
+	for {
+		p.skipSpace()
+		cmp, err := p.compare()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, cmp)
+
+		p.skipSpace()
+		switch {
+		case p.consume("&&"):
+		case p.consume("||"):
+			f.or = append(f.or, and)
+			and = []queryCompare{}
+		default:
+			f.or = append(f.or, and)
+			return f, nil
+		}
+	}
+}
+
+func (p *queryParser) compare() (queryCompare, error) {
+	cmp := queryCompare{}
+	if !p.consume("@") {
+		return cmp, p.error("expect a path starting with \"@\" in filter")
+	}
+
+	path, err := p.segments(true)
+	if err != nil {
+		return cmp, err
+	}
+	cmp.path = path
+
+	p.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			cmp.op = op
+			break
+		}
+	}
+	if cmp.op == "" {
+		return cmp, nil
+	}
+
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		s, err := p.quoted()
+		if err != nil {
+			return cmp, err
+		}
+		cmp.literal = Value{Type: kValueTypeString, String: s}
+	case p.consume("true"):
+		cmp.literal = Value{Type: kValueTypeBoolean, Boolean: true}
+	case p.consume("false"):
+		cmp.literal = Value{Type: kValueTypeBoolean, Boolean: false}
+	case p.consume("null"):
+		cmp.literal = NewNull()
+	default:
+		start := p.pos
+		for !p.eof() && strings.IndexByte("0123456789+-.eE", p.peek()) >= 0 {
+			p.pos++
+		}
+		num, err := strconv.ParseFloat(p.text[start:p.pos], 64)
+		if err != nil {
+			return cmp, p.error("expect a number, a quoted string, true, false or null after %s", cmp.op)
+		}
+		cmp.literal = Value{Type: kValueTypeNumber, Number: num}
+	}
+	return cmp, nil
+}
+
+// a JSON Pointer, each reference token is a key or a list index
+func compilePointer(text string) []querySegment {
+	ret := []querySegment{}
+	if text == "" {
+		return ret
+	}
+
+	for _, token := range strings.Split(text[1:], "/") {
+		token = strings.ReplaceAll(token, "~1", "/")
+		token = strings.ReplaceAll(token, "~0", "~")
+		ret = append(ret, querySegment{kind: kQueryChild, name: token})
+	}
+	return ret
+}
+
+// CompileQuery parses the query text so it can be evaluated against documents
+func CompileQuery(text string) (*Query, error) {
+	q := &Query{Text: text, definite: true}
+
+	switch {
+	case text == "" || text[0] == '/':
+		q.segments = compilePointer(text)
+
+	default:
+		p := &queryParser{text: text}
+		if !p.consume("$") {
+			// a dotted path without the root, ie "runs.0.latency"
+			p = &queryParser{text: "$." + text, pos: 1, prefix: 2}
+		}
+
+		segs, err := p.segments(false)
+		if err != nil {
+			return nil, err
+		}
+		q.segments = segs
+	}
+
+	for _, s := range q.segments {
+		if s.recursive || (s.kind != kQueryChild && s.kind != kQueryIndex) {
+			q.definite = false
+		}
+	}
+	return q, nil
+}
+
+// children of a value in document order, object keys are sorted since objects don't
+// keep their order
+func queryChildren(v Value) []Value {
+	switch v.Type {
+	case kValueTypeList:
+		return v.List.Value
+	case kValueTypeObject:
+		keys := make([]string, 0, len(v.Object.Value))
+		for k := range v.Object.Value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		ret := make([]Value, 0, len(keys))
+		for _, k := range keys {
+			ret = append(ret, v.Object.Value[k])
+		}
+		return ret
+	default:
+		return nil
+	}
+}
+
+// the value and all of its descendants
+func queryDescendants(v Value, out []Value) []Value {
+	out = append(out, v)
+	for _, x := range queryChildren(v) {
+		out = queryDescendants(x, out)
+	}
+	return out
+}
+
+func listIndex(idx, size int) (int, bool) {
+	if idx < 0 {
+		idx += size
+	}
+	return idx, idx >= 0 && idx < size
+}
+
+func (s *querySegment) apply(v Value, out []Value) []Value {
+	switch s.kind {
+	case kQueryChild:
+		if v.Type == kValueTypeObject {
+			if x, ok := v.Object.Value[s.name]; ok {
+				out = append(out, x)
+			}
+		} else if v.Type == kValueTypeList {
+			if n, err := strconv.Atoi(s.name); err == nil && n >= 0 && n < len(v.List.Value) {
+				out = append(out, v.List.Value[n])
+			}
+		}
+
+	case kQueryIndex:
+		if v.Type == kValueTypeList {
+			if n, ok := listIndex(s.index, len(v.List.Value)); ok {
+				out = append(out, v.List.Value[n])
+			}
+		}
+
+	case kQuerySlice:
+		if v.Type == kValueTypeList {
+			size := len(v.List.Value)
+			start, end := 0, size
+			if s.hasStart {
+				start, _ = listIndex(s.start, size)
+			}
+			if s.hasEnd {
+				end, _ = listIndex(s.end, size)
+			}
+			for idx := start; idx < end; idx++ {
+				if idx >= 0 && idx < size {
+					out = append(out, v.List.Value[idx])
+				}
+			}
+		}
+
+	case kQueryWildcard:
+		out = append(out, queryChildren(v)...)
+
+	case kQueryFilter:
+		for _, x := range queryChildren(v) {
+			if s.filter.match(x) {
+				out = append(out, x)
+			}
+		}
+	}
+	return out
+}
+
+func queryEval(segments []querySegment, v Value) []Value {
+	cur := []Value{v}
+	for idx := range segments {
+		s := &segments[idx]
+		next := []Value{}
+		for _, x := range cur {
+			if s.recursive {
+				for _, d := range queryDescendants(x, nil) {
+					next = s.apply(d, next)
+				}
+			} else {
+				next = s.apply(x, next)
+			}
+		}
+		cur = next
+	}
+	return cur
+}
+
+func (f *queryFilter) match(v Value) bool {
+	for _, and := range f.or {
+		ok := true
+		for _, cmp := range and {
+			if !cmp.match(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *queryCompare) match(v Value) bool {
+	matches := queryEval(c.path, v)
+	if len(matches) == 0 {
+		return false
+	}
+	if c.op == "" {
+		return true
+	}
+
+	x := matches[0]
+	lit := c.literal
+
+	if x.Type != lit.Type {
+		return c.op == "!="
+	}
+
+	var order int
+	switch x.Type {
+	case kValueTypeNumber:
+		switch {
+		case x.Number < lit.Number:
+			order = -1
+		case x.Number > lit.Number:
+			order = 1
+		}
+	case kValueTypeString:
+		order = strings.Compare(x.String, lit.String)
+	case kValueTypeBoolean:
+		if x.Boolean != lit.Boolean {
+			order = 1
+		}
+		if c.op != "==" && c.op != "!=" {
+			return false
+		}
+	case kValueTypeNull:
+		if c.op != "==" && c.op != "!=" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	switch c.op {
+	case "==":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// Eval returns every value matched by the query in document order
+func (q *Query) Eval(v Value) []Value {
+	return queryEval(q.segments, v)
+}
+
+// JsonQuery evaluates the query against the document. A query which can only match
+// one value returns it, otherwise a list of all the matches is returned
+func JsonQuery(v Value, text string) (Value, error) {
+	q, err := CompileQuery(text)
+	if err != nil {
+		return NewNull(), err
+	}
+
+	matches := q.Eval(v)
+	if len(matches) == 0 {
+		return NewNull(), fmt.Errorf("query %q doesn't match anything", text)
+	}
+
+	if q.definite {
+		return matches[0], nil
+	}
+
+	list := NewList()
+	list.Value = matches
+	return Value{Type: kValueTypeList, List: list}, nil
+}
+
+// CompileFilter parses a filter expression on its own, the same syntax as inside
+// of "[?( )]", ie "@.ok == true && @.ms < 100"
+func CompileFilter(text string) (*queryFilter, error) {
+	p := &queryParser{text: text}
+	f, err := p.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.error("unexpected character %q", p.peek())
+	}
+	return f, nil
+}
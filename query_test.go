@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const kQueryTestDoc = `{
+    "runs": [
+        {"name": "a", "ms": 120, "ok": true},
+        {"name": "b", "ms": 80, "ok": false},
+        {"name": "c", "ms": 40, "ok": true}
+    ],
+    "meta": {"odd key": 1, "a/b": 2, "t~x": 3, "ms": 7}
+}`
+
+func TestJsonQuery(t *testing.T) {
+	doc := mustParseJson(t, kQueryTestDoc)
+
+	for _, c := range []struct {
+		query string
+		want  string
+	}{
+		{"$.runs[0].ms", `120`},
+		{"$.runs[-1].name", `"c"`},
+		{"$.runs[*].ms", `[120, 80, 40]`},
+		{"$.runs[1:].name", `["b", "c"]`},
+		{"$.runs[:2].ms", `[120, 80]`},
+		{"$.runs[-2:-1].name", `["b"]`},
+		{"$.runs[?(@.ok == true && @.ms < 100)].name", `["c"]`},
+		{"$.runs[?(@.ms > 100 || @.name == 'b')].name", `["a", "b"]`},
+		{"$.runs[?(@.ok != false)].name", `["a", "c"]`},
+		{"$.runs[?(@.ok)].name", `["a", "b", "c"]`},
+		{"$..ms", `[7, 120, 80, 40]`},
+		{"$.meta.*", `[2, 7, 1, 3]`},
+		{"$['meta']['odd key']", `1`},
+		{`$["meta"]["odd key"]`, `1`},
+		{"/meta/a~1b", `2`},
+		{"/meta/t~0x", `3`},
+		{"/runs/1/name", `"b"`},
+		{"runs.1.name", `"b"`},
+	} {
+		got, err := JsonQuery(doc, c.query)
+		if err != nil {
+			t.Errorf("query %s failed, %v", c.query, err)
+			continue
+		}
+		want := mustParseValue(t, c.want)
+		if !sameJson(got, want) {
+			t.Errorf("query %s got %s, want %s", c.query, got.ToJson(), want.ToJson())
+		}
+	}
+}
+
+func TestJsonQueryNoMatch(t *testing.T) {
+	doc := mustParseJson(t, kQueryTestDoc)
+
+	for _, query := range []string{"$.nothing", "$.runs[5]", "$.runs[?(@.ms > 1000)]", "/meta/none"} {
+		if _, err := JsonQuery(doc, query); err == nil || !strings.Contains(err.Error(), "doesn't match anything") {
+			t.Errorf("query %s got error %v, want no match", query, err)
+		}
+	}
+}
+
+func TestCompileQueryError(t *testing.T) {
+	for _, c := range []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{"$x", 1, `unexpected character 'x'`},
+		{"$.", 2, `expect a key after "."`},
+		{"$.runs[", 7, `expect an index, a slice`},
+		{"$.runs[0", 8, `expect a "]"`},
+		{"$.runs['a", 9, `unterminated string`},
+		{"$.runs[?@.ok]", 8, `expect a "(" after "?"`},
+		{"$.runs[?(ms > 1)]", 9, `expect a path starting with "@"`},
+		{"$.runs[?(@.ms <)]", 15, `expect a number, a quoted string, true, false or null after <`},
+		{"$.runs[?(@.ms == 1]", 18, `expect a ")" closing the filter`},
+		{"runs[", 5, `expect an index, a slice`},
+		{"runs.", 5, `expect a key after "."`},
+		{"runs[0]x", 7, `unexpected character 'x'`},
+	} {
+		_, err := CompileQuery(c.query)
+		if err == nil {
+			t.Errorf("query %s compiled, want an error", c.query)
+			continue
+		}
+		at := fmt.Sprintf("around %d,", c.pos)
+		quoted := fmt.Sprintf("query %q ", c.query)
+		if !strings.HasPrefix(err.Error(), quoted) || !strings.Contains(err.Error(), at) ||
+			!strings.Contains(err.Error(), c.msg) {
+			t.Errorf("query %s got error %q, want %q %s", c.query, err, at, c.msg)
+		}
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	doc := mustParseJson(t, kQueryTestDoc)
+	runs, _ := JsonQuery(doc, "$.runs")
+
+	for _, c := range []struct {
+		filter string
+		want   []bool
+	}{
+		{"@.ok == true", []bool{true, false, true}},
+		{"@.ms >= 80", []bool{true, true, false}},
+		{"@.name != 'a' && @.ms <= 80", []bool{false, true, true}},
+		{"@.ms < 50 || @.ms > 100", []bool{true, false, true}},
+		{"@.missing", []bool{false, false, false}},
+		{"@.ok > false", []bool{false, false, false}},
+	} {
+		f, err := CompileFilter(c.filter)
+		if err != nil {
+			t.Errorf("filter %s failed, %v", c.filter, err)
+			continue
+		}
+		for idx, x := range runs.List.Value {
+			if got := f.match(x); got != c.want[idx] {
+				t.Errorf("filter %s on run %d got %v, want %v", c.filter, idx, got, c.want[idx])
+			}
+		}
+	}
+
+	for _, c := range []struct {
+		filter string
+		pos    int
+	}{
+		{"@.ok == true )", 13},
+		{"ok == true", 0},
+		{"@.ms == ", 8},
+	} {
+		if _, err := CompileFilter(c.filter); err == nil {
+			t.Errorf("filter %s compiled, want an error", c.filter)
+		} else if at := fmt.Sprintf("around %d,", c.pos); !strings.Contains(err.Error(), at) {
+			t.Errorf("filter %s got error %q, want %q", c.filter, err, at)
+		}
+	}
+}
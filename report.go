@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgpdf"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ReportConfig describes how the jobs of a document are put into one multiple pages
+// pdf file. Each job becomes a cell of a page, pages are laid out as a grid of Rows
+// by Cols cells, and the report can have a cover page and a table of contents
+type ReportConfig struct {
+	Path     string
+	Title    string
+	Subtitle string
+	Author   string
+	Cover    bool
+	Contents bool
+	Rows     int
+	Cols     int
+
+	// size of the page in inches
+	Width  float64
+	Height float64
+}
+
+const (
+	kReportMargin      = vg.Inch / 2
+	kReportPadding     = vg.Inch / 4
+	kReportFont        = "Helvetica"
+	kReportBoldFont    = "Helvetica-Bold"
+	kReportTextSize    = vg.Length(11)
+	kReportTitleSize   = vg.Length(28)
+	kReportHeadingSize = vg.Length(18)
+)
+
+func ParseReportConfig(v Value) (*ReportConfig, error) {
+	if v.Type != kValueTypeObject {
+		return nil, fmt.Errorf("value is not type object but type %s", v.Type.GetName())
+	}
+
+	report := &ReportConfig{
+		Title:    "Report",
+		Cover:    false,
+		Contents: true,
+		Rows:     1,
+		Cols:     1,
+		Width:    8.5,
+		Height:   11,
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Path", "path"); err != nil {
+		return nil, err
+	} else {
+		if path, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Path\" field is not a string")
+		} else {
+			report.Path = path
+		}
+	}
+
+	if strings.ToLower(filepath.Ext(report.Path)) != ".pdf" {
+		return nil, fmt.Errorf("report can only be saved as pdf but got path %s", report.Path)
+	}
+
+	for _, x := range []struct {
+		keys []string
+		ptr  *string
+	}{
+		{[]string{"Title", "title"}, &report.Title},
+		{[]string{"Subtitle", "subtitle"}, &report.Subtitle},
+		{[]string{"Author", "author"}, &report.Author},
+	} {
+		if t, err := JsonObjectGetMultipleKey(v, x.keys...); err == nil {
+			if val, err := JsonGetString(t); err != nil {
+				return nil, fmt.Errorf("\"%s\" field is not a string", x.keys[0])
+			} else {
+				*x.ptr = val
+			}
+		}
+	}
+
+	for _, x := range []struct {
+		keys []string
+		ptr  *bool
+	}{
+		{[]string{"Cover", "cover"}, &report.Cover},
+		{[]string{"Contents", "contents"}, &report.Contents},
+	} {
+		if t, err := JsonObjectGetMultipleKey(v, x.keys...); err == nil {
+			if val, err := JsonGetBoolean(t); err != nil {
+				return nil, fmt.Errorf("\"%s\" field is not a boolean", x.keys[0])
+			} else {
+				*x.ptr = val
+			}
+		}
+	}
+
+	for _, x := range []struct {
+		keys []string
+		ptr  *float64
+	}{
+		{[]string{"Width", "width"}, &report.Width},
+		{[]string{"Height", "height"}, &report.Height},
+	} {
+		if t, err := JsonObjectGetMultipleKey(v, x.keys...); err == nil {
+			if val, err := JsonGetNumber(t); err != nil || val <= 0 {
+				return nil, fmt.Errorf("\"%s\" field must be a positive number", x.keys[0])
+			} else {
+				*x.ptr = val
+			}
+		}
+	}
+
+	for _, x := range []struct {
+		keys []string
+		ptr  *int
+	}{
+		{[]string{"Rows", "rows"}, &report.Rows},
+		{[]string{"Cols", "cols"}, &report.Cols},
+	} {
+		if t, err := JsonObjectGetMultipleKey(v, x.keys...); err == nil {
+			if val, err := JsonGetNumber(t); err != nil || int(val) < 1 {
+				return nil, fmt.Errorf("\"%s\" field must be a positive number", x.keys[0])
+			} else {
+				*x.ptr = int(val)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// a job which is rendered successfully and the page it ends up on
+type reportEntry struct {
+	job   *Job
+	chart *Chart
+	page  int
+}
+
+func (e *reportEntry) title() string {
+	if e.job.Caption != "" {
+		return e.job.Caption
+	}
+	if e.chart.Plot.Title.Text != "" {
+		return e.chart.Plot.Title.Text
+	}
+	return fmt.Sprintf("%s #%d", e.job.Plotter.GetName(), e.job.Index)
+}
+
+func reportTextStyle(name string, size vg.Length) (draw.TextStyle, error) {
+	font, err := vg.MakeFont(name, size)
+	if err != nil {
+		return draw.TextStyle{}, err
+	}
+	return draw.TextStyle{
+		Color:  color.Black,
+		Font:   font,
+		XAlign: draw.XCenter,
+		YAlign: draw.YCenter,
+	}, nil
+}
+
+type reportWriter struct {
+	*ReportConfig
+	canvas  *vgpdf.Canvas
+	dc      draw.Canvas
+	page    int
+	text    draw.TextStyle
+	heading draw.TextStyle
+	title   draw.TextStyle
+}
+
+func (r *reportWriter) nextPage() {
+	if r.page > 0 {
+		r.canvas.NextPage()
+	}
+	r.page++
+}
+
+// number of entries a single page of the table of contents can hold
+func (r *reportWriter) contentsPerPage() int {
+	lineHeight := r.text.Font.Size * 2
+	room := r.dc.Max.Y - r.dc.Min.Y - 2*kReportMargin - r.heading.Font.Size*3
+	n := int(room / lineHeight)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func (r *reportWriter) drawPageNumber() {
+	r.dc.FillText(r.text, vg.Point{
+		X: (r.dc.Min.X + r.dc.Max.X) / 2,
+		Y: r.dc.Min.Y + kReportMargin/2,
+	}, fmt.Sprintf("%d", r.page))
+}
+
+func (r *reportWriter) drawCover() {
+	r.nextPage()
+
+	x := (r.dc.Min.X + r.dc.Max.X) / 2
+	y := r.dc.Min.Y + (r.dc.Max.Y-r.dc.Min.Y)*2/3
+
+	r.dc.FillText(r.title, vg.Point{X: x, Y: y}, r.Title)
+	y -= r.title.Font.Size * 2
+
+	for _, line := range []string{r.Subtitle, r.Author, time.Now().Format("2006-01-02")} {
+		if line == "" {
+			continue
+		}
+		r.dc.FillText(r.heading, vg.Point{X: x, Y: y}, line)
+		y -= r.heading.Font.Size * 2
+	}
+}
+
+func (r *reportWriter) drawContents(entries []reportEntry) {
+	perPage := r.contentsPerPage()
+
+	for start := 0; start < len(entries); start += perPage {
+		r.nextPage()
+
+		left := r.dc.Min.X + kReportMargin
+		right := r.dc.Max.X - kReportMargin
+		y := r.dc.Max.Y - kReportMargin
+
+		heading := r.heading
+		heading.XAlign = draw.XLeft
+		r.dc.FillText(heading, vg.Point{X: left, Y: y}, "Contents")
+		y -= r.heading.Font.Size * 3
+
+		end := start + perPage
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		for idx, e := range entries[start:end] {
+			name := r.text
+			name.XAlign = draw.XLeft
+			r.dc.FillText(name, vg.Point{X: left, Y: y}, fmt.Sprintf("%d. %s", start+idx+1, e.title()))
+
+			page := r.text
+			page.XAlign = draw.XRight
+			r.dc.FillText(page, vg.Point{X: right, Y: y}, fmt.Sprintf("%d", e.page))
+			y -= r.text.Font.Size * 2
+		}
+
+		r.drawPageNumber()
+	}
+}
+
+// draw the chart into the cell, the chart keeps its own aspect ratio and its
+// caption goes right below it
+func (r *reportWriter) drawCell(cell draw.Canvas, e *reportEntry) {
+	if e.job.Caption != "" {
+		captionHeight := r.text.Font.Size * 2
+		r.dc.FillText(r.text, vg.Point{
+			X: (cell.Min.X + cell.Max.X) / 2,
+			Y: cell.Min.Y + captionHeight/2,
+		}, e.job.Caption)
+		cell = draw.Crop(cell, 0, 0, captionHeight, 0)
+	}
+
+	cw := cell.Max.X - cell.Min.X
+	ch := cell.Max.Y - cell.Min.Y
+	scale := cw / e.chart.Width
+	if s := ch / e.chart.Height; s < scale {
+		scale = s
+	}
+
+	padX := (cw - e.chart.Width*scale) / 2
+	padY := (ch - e.chart.Height*scale) / 2
+	e.chart.Draw(draw.Crop(cell, padX, -padX, padY, -padY))
+}
+
+func (r *reportWriter) drawCharts(entries []reportEntry) {
+	perPage := r.Rows * r.Cols
+	tiles := draw.Tiles{
+		Rows:      r.Rows,
+		Cols:      r.Cols,
+		PadTop:    kReportMargin,
+		PadBottom: kReportMargin,
+		PadLeft:   kReportMargin,
+		PadRight:  kReportMargin,
+		PadX:      kReportPadding,
+		PadY:      kReportPadding,
+	}
+
+	for start := 0; start < len(entries); start += perPage {
+		r.nextPage()
+		for i := 0; i < perPage && start+i < len(entries); i++ {
+			r.drawCell(tiles.At(r.dc, i%r.Cols, i/r.Cols), &entries[start+i])
+		}
+		r.drawPageNumber()
+	}
+}
+
+func (r *reportWriter) save() error {
+	f, err := os.Create(r.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := r.canvas.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// doReport renders every job of the document into the report. Jobs that fail are
+// reported and left out of the report when keepGoing is set, otherwise the report is
+// not written at all
+func doReport(spec *Spec, keepGoing bool) *runReport {
+	report := spec.Report
+	rr := &runReport{ReportPath: report.Path}
+	entries := []reportEntry{}
+
+	for idx, x := range spec.Jobs {
+		res := newJobResult(idx, x)
+		rr.Jobs = append(rr.Jobs, res)
+		if !keepGoing && rr.count(kJobFailed) != 0 {
+			continue
+		}
+
+		start := time.Now()
+		job, err := ParseJob(idx, x, false)
+		if err == nil {
+			var chart *Chart
+			if chart, err = job.Render(); err == nil {
+				entries = append(entries, reportEntry{job: job, chart: chart})
+				res.Status = kJobSucceeded
+			}
+		}
+		res.Duration = time.Since(start)
+		if err != nil {
+			res.fail(err)
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+
+	if !keepGoing && rr.count(kJobFailed) != 0 {
+		rr.Err = fmt.Errorf("report %s is not written since a job failed, -keep-going leaves it out instead",
+			report.Path)
+		return rr
+	}
+	if err := writeReport(report, entries, len(spec.Jobs)); err != nil {
+		rr.Err = err
+	} else {
+		rr.ReportSize = fileSize(report.Path)
+	}
+	return rr
+}
+
+// writeReport lays out the rendered jobs into the pages of the report
+func writeReport(report *ReportConfig, entries []reportEntry, total int) error {
+	if len(entries) == 0 {
+		return fmt.Errorf("report %s has no job rendered successfully", report.Path)
+	}
+
+	w := vg.Length(report.Width) * vg.Inch
+	h := vg.Length(report.Height) * vg.Inch
+	r := &reportWriter{ReportConfig: report, canvas: vgpdf.New(w, h)}
+	r.dc = draw.New(r.canvas)
+
+	var err error
+	if r.text, err = reportTextStyle(kReportFont, kReportTextSize); err != nil {
+		return err
+	}
+	if r.heading, err = reportTextStyle(kReportFont, kReportHeadingSize); err != nil {
+		return err
+	}
+	if r.title, err = reportTextStyle(kReportBoldFont, kReportTitleSize); err != nil {
+		return err
+	}
+
+	// figure out the page of each chart before anything is drawn, the table of
+	// contents needs them
+	front := 0
+	if report.Cover {
+		front++
+	}
+	if report.Contents {
+		perPage := r.contentsPerPage()
+		front += (len(entries) + perPage - 1) / perPage
+	}
+	for idx := range entries {
+		entries[idx].page = front + idx/(report.Rows*report.Cols) + 1
+	}
+
+	if report.Cover {
+		r.drawCover()
+	}
+	if report.Contents {
+		r.drawContents(entries)
+	}
+	r.drawCharts(entries)
+
+	if err := r.save(); err != nil {
+		return fmt.Errorf("report cannot save file to path %s due to reason %v", report.Path, err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Total Job %d; Reported %d; Failed %d; Pages %d\n",
+		total, len(entries), total-len(entries), r.page)
+	return nil
+}
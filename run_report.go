@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// The run report is a json file written by render -report, so a pipeline can gate on
+// the charts and show what failed:
+//
+//	{
+//	    "Total" : 2, "Succeeded" : 1, "Failed" : 1, "Skipped" : 0, "Error" : null,
+//	    "Jobs" : [
+//	        {"Index" : 0, "Type" : "dot-plotter", "Path" : "a.png", "Status" : "succeeded",
+//	         "Duration" : 0.0213, "Size" : 30512, "Error" : null},
+//	        {"Index" : 1, "Type" : "hist-plotter", "Path" : "b.png", "Status" : "failed",
+//	         "Duration" : 0.0004, "Size" : 0, "Error" : "index 1,..."}
+//	    ]
+//	}
+//
+// Duration is in seconds and Size is the size of the output in bytes. A job is skipped
+// when an earlier one failed and -keep-going is not set. "Error" at the top is an error
+// of the whole run, ie the spec cannot be parsed, and a run writing a pdf report has
+// its file under "Report"
+
+const (
+	kJobSucceeded = "succeeded"
+	kJobFailed    = "failed"
+	kJobSkipped   = "skipped"
+)
+
+// jobResult is what happened to one job
+type jobResult struct {
+	Index    int
+	Type     string
+	Path     string
+	Status   string
+	Duration time.Duration
+	Size     int64
+	Err      error
+}
+
+// newJobResult is a result of the job which has not run yet, the type and the path are
+// taken from the job as far as they can be read
+func newJobResult(index int, jdom Value) *jobResult {
+	res := &jobResult{Index: index, Status: kJobSkipped}
+	if t, err := JsonObjectGetMultipleKey(jdom, "Type", "type"); err == nil {
+		res.Type, _ = JsonGetString(t)
+	}
+	if t, err := JsonObjectGetMultipleKey(jdom, "Path", "path"); err == nil {
+		res.Path, _ = JsonGetString(t)
+	}
+	return res
+}
+
+// fail marks the job as failed with the error
+func (res *jobResult) fail(err error) *jobResult {
+	res.Status = kJobFailed
+	res.Err = err
+	return res
+}
+
+func (res *jobResult) ToValue() Value {
+	obj := NewObject()
+	obj.Value["Index"] = Value{Type: kValueTypeNumber, Number: float64(res.Index)}
+	obj.Value["Type"] = jsonString(res.Type)
+	obj.Value["Path"] = jsonString(res.Path)
+	obj.Value["Status"] = jsonString(res.Status)
+	obj.Value["Duration"] = Value{Type: kValueTypeNumber, Number: res.Duration.Seconds()}
+	obj.Value["Size"] = Value{Type: kValueTypeNumber, Number: float64(res.Size)}
+	obj.Value["Error"] = errorToValue(res.Err)
+	return Value{Type: kValueTypeObject, Object: obj}
+}
+
+func errorToValue(err error) Value {
+	if err == nil {
+		return NewNull()
+	}
+	return jsonString(err.Error())
+}
+
+// runReport is the outcome of a render, Err is set when the run failed as a whole
+type runReport struct {
+	Jobs []*jobResult
+	Err  error
+
+	// the pdf report of the spec, empty when the jobs are saved into their own files
+	ReportPath string
+	ReportSize int64
+}
+
+// count is the number of jobs with the status
+func (r *runReport) count(status string) int {
+	n := 0
+	for _, x := range r.Jobs {
+		if x.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed tells if anything of the run failed, which is what the exit code follows
+func (r *runReport) Failed() bool {
+	return r.Err != nil || r.count(kJobFailed) != 0
+}
+
+func (r *runReport) ToValue() Value {
+	jobs := NewList()
+	for _, x := range r.Jobs {
+		jobs.Value = append(jobs.Value, x.ToValue())
+	}
+
+	obj := NewObject()
+	obj.Value["Total"] = Value{Type: kValueTypeNumber, Number: float64(len(r.Jobs))}
+	obj.Value["Succeeded"] = Value{Type: kValueTypeNumber, Number: float64(r.count(kJobSucceeded))}
+	obj.Value["Failed"] = Value{Type: kValueTypeNumber, Number: float64(r.count(kJobFailed))}
+	obj.Value["Skipped"] = Value{Type: kValueTypeNumber, Number: float64(r.count(kJobSkipped))}
+	obj.Value["Error"] = errorToValue(r.Err)
+	obj.Value["Jobs"] = Value{Type: kValueTypeList, List: jobs}
+	if r.ReportPath != "" {
+		obj.Value["Report"] = jsonObject(
+			"Path", jsonString(r.ReportPath),
+			"Size", Value{Type: kValueTypeNumber, Number: float64(r.ReportSize)},
+		)
+	}
+	return Value{Type: kValueTypeObject, Object: obj}
+}
+
+// Save writes the report as json into the file
+func (r *runReport) Save(path string) error {
+	v := r.ToValue()
+	if err := os.WriteFile(path, []byte(v.ToJson()+"\n"), 0644); err != nil {
+		return fmt.Errorf("run report cannot be written to %s, %v", path, err)
+	}
+	return nil
+}
+
+// fileSize is the size of the file, 0 when it cannot be found
+func fileSize(path string) int64 {
+	if info, err := os.Stat(path); err == nil {
+		return info.Size()
+	}
+	return 0
+}
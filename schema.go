@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The json schema of a spec is made from the options the plotters describe, editors
+// use it to complete and check a spec. Keys are matched without case by the plotters,
+// the schema only knows the spelling of the docs
+
+const kSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+func jsonString(s string) Value {
+	return Value{Type: kValueTypeString, String: s}
+}
+
+func jsonStrings(ss ...string) Value {
+	list := NewList()
+	for _, s := range ss {
+		list.Value = append(list.Value, jsonString(s))
+	}
+	return Value{Type: kValueTypeList, List: list}
+}
+
+func jsonList(vs ...Value) Value {
+	list := NewList()
+	list.Value = append(list.Value, vs...)
+	return Value{Type: kValueTypeList, List: list}
+}
+
+// jsonObject builds an object out of pairs of keys and values
+func jsonObject(kv ...interface{}) Value {
+	obj := NewObject()
+	for i := 0; i+1 < len(kv); i += 2 {
+		obj.Value[kv[i].(string)] = kv[i+1].(Value)
+	}
+	return Value{Type: kValueTypeObject, Object: obj}
+}
+
+// schemaType is "type" of json schema for the types of an option, "list" is "array"
+func schemaType(types string) Value {
+	names := []string{}
+	for _, x := range strings.Split(types, "|") {
+		if x == "list" {
+			x = "array"
+		}
+		names = append(names, x)
+	}
+	if len(names) == 1 {
+		return jsonString(names[0])
+	}
+	return jsonStrings(names...)
+}
+
+// optionDefault is the default of an option as a value, the text of a number or a
+// boolean is one
+func optionDefault(text string) Value {
+	if n, err := strconv.ParseFloat(text, 64); err == nil {
+		return Value{Type: kValueTypeNumber, Number: n}
+	}
+	if text == "true" || text == "false" {
+		return Value{Type: kValueTypeBoolean, Boolean: text == "true"}
+	}
+	return jsonString(text)
+}
+
+func optionSchema(o OptionDoc) Value {
+	v := jsonObject("type", schemaType(o.Type), "description", jsonString(o.Doc))
+	if o.Default != "" {
+		v.Object.Value["default"] = optionDefault(o.Default)
+	}
+	return v
+}
+
+// configSchema is the schema of the config of the plotter. An option which is both an
+// option of every chart and of the plotter takes the types of both
+func configSchema(d Describer) Value {
+	docs := map[string]OptionDoc{}
+	for _, list := range [][]OptionDoc{chartOptionDocs, d.Options()} {
+		for _, o := range list {
+			if old, ok := docs[o.Name]; ok {
+				types := strings.Split(old.Type, "|")
+				for _, x := range strings.Split(o.Type, "|") {
+					if !strings.Contains("|"+old.Type+"|", "|"+x+"|") {
+						types = append(types, x)
+					}
+				}
+				o = OptionDoc{o.Name, strings.Join(types, "|"), old.Default, old.Doc + "; " + o.Doc}
+			}
+			docs[o.Name] = o
+		}
+	}
+
+	props := NewObject()
+	for name, o := range docs {
+		props.Value[name] = optionSchema(o)
+	}
+	return jsonObject(
+		"type", jsonString("object"),
+		"description", jsonString(d.Summary()),
+		"properties", Value{Type: kValueTypeObject, Object: props},
+	)
+}
+
+// jobSchema is the schema of a job, the config is checked by the schema of the
+// plotter named by "Type"
+func jobSchema() Value {
+	names := plotterNames()
+	cases := NewList()
+	for _, name := range names {
+		d, ok := PlotterFactory[name].(Describer)
+		if !ok {
+			continue
+		}
+		cases.Value = append(cases.Value, jsonObject(
+			"if", jsonObject(
+				"required", jsonStrings("Type"),
+				"properties", jsonObject("Type", jsonObject("const", jsonString(name))),
+			),
+			"then", jsonObject("properties", jsonObject("Config", configSchema(d))),
+		))
+	}
+
+	return jsonObject(
+		"type", jsonString("object"),
+		// "Type" can come from the templates of "Extends", and "Config" from "Defaults"
+		"anyOf", jsonList(
+			jsonObject("required", jsonStrings("Type")),
+			jsonObject("required", jsonStrings("type")),
+			jsonObject("required", jsonStrings("Extends")),
+			jsonObject("required", jsonStrings("extends")),
+		),
+		"properties", jsonObject(
+			"Type", jsonObject("enum", jsonStrings(names...)),
+			"Path", jsonObject("type", jsonString("string"),
+				"description", jsonString("the output file, its extension is the format")),
+			"Caption", jsonObject("type", jsonString("string")),
+			"Config", jsonObject("type", jsonString("object")),
+			"Transform", jsonObject("type", jsonString("object")),
+			"Extends", jsonObject("type", jsonStrings("string", "array")),
+			"ForEach", jsonObject("type", jsonStrings("array", "string"),
+				"description", jsonString("a list of items or a glob of files, the job is repeated for each of them")),
+		),
+		"allOf", Value{Type: kValueTypeList, List: cases},
+	)
+}
+
+// SpecSchema is the schema of the input document, a job, a list of jobs or an object
+// with "Jobs"
+func SpecSchema() Value {
+	job := jsonObject("$ref", jsonString("#/definitions/job"))
+	jobs := jsonObject("type", jsonString("array"), "items", job)
+	object := jsonObject("type", jsonString("object"))
+
+	return jsonObject(
+		"$schema", jsonString(kSchemaDraft),
+		"title", jsonString("jsonplot spec"),
+		"definitions", jsonObject("job", jobSchema()),
+		"oneOf", jsonList(
+			job,
+			jobs,
+			jsonObject(
+				"type", jsonString("object"),
+				"required", jsonStrings("Jobs"),
+				"properties", jsonObject(
+					"Jobs", jobs,
+					"Vars", object,
+					"Templates", object,
+					"Defaults", object,
+					"Include", jsonObject("type", jsonStrings("string", "array")),
+					"Theme", jsonObject("type", jsonStrings("string", "object")),
+					"Themes", object,
+					"Report", object,
+				),
+			),
+		),
+	)
+}
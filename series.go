@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg/draw"
+	"image/color"
+	"math"
+)
+
+// seriesOptions are the options of one series of an XY plotter. They are either set
+// at the top of the config and apply to every series, or set on one series by writing
+// it as an object with its points under "Data", which overrides the top ones:
+//
+//	"Fit": "linear",
+//	"Data": {
+//	    "read": [...],
+//	    "write": {"Data": [...], "Fit": {"Type": "poly", "Degree": 3}}
+//	}
+const (
+	kAxisLeft  = "left"
+	kAxisRight = "right"
+)
+
+type seriesOptions struct {
+	// "left" or "right", the Y axis the series is drawn against
+	Axis string
+
+	Fit *fitSpec
+
+	// only set on a series, "Legend" at the top of the config is the legend block
+	HideLegend bool
+
+	// nil for the color of the palette
+	Color    color.Color
+	Colormap *Colormap
+
+	Resample   *resampleSpec
+	Smooth     *smoothSpec
+	Downsample int
+}
+
+// seriesOptionDocs are the options of seriesOptions
+var seriesOptionDocs = []OptionDoc{
+	{"Axis", "string", kAxisLeft, "the Y axis of the series, left or right"},
+	{"Fit", "string|object", "", "a curve fitted to the points, ie linear, poly or lowess"},
+	{"Color", "string|number|object", "", "the color of the series, a number is an index into the palette"},
+	{"Colormap", "string|object", "", "colors each marker by its Y value"},
+	{"Resample", "object", "", "buckets the points into fixed intervals of X and aggregates each bucket"},
+	{"Smooth", "string|object", "", "a moving window over the points, sma, ema or median"},
+	{"Downsample", "number", "", "the number of points kept by Largest-Triangle-Three-Buckets"},
+	{"Legend", "boolean", "true", "only on a series written as an object, false leaves it out of the legend"},
+}
+
+// isSeriesObject tells a series with options apart from a plain list of points or a
+// data source
+func isSeriesObject(v Value) bool {
+	if v.Type != kValueTypeObject || IsDataSource(v) {
+		return false
+	}
+	_, err := JsonObjectGetMultipleKey(v, "Data", "data")
+	return err == nil
+}
+
+// parseSeriesOptions reads the options from v on top of base, base is not modified.
+// A color index refers to the palette
+func parseSeriesOptions(v Value, base *seriesOptions, palette []color.Color) (*seriesOptions, error) {
+	opt := *base
+
+	if t, err := JsonObjectGetMultipleKey(v, "Axis", "axis"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Axis\" field is not a string")
+		} else {
+			switch val {
+			case kAxisLeft, kAxisRight:
+				opt.Axis = val
+			default:
+				return nil, fmt.Errorf("\"Axis\" %s is unknown, must be left or right", val)
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Fit", "fit"); err == nil {
+		if t.Type == kValueTypeNull {
+			opt.Fit = nil
+		} else if f, err := parseFit(t); err != nil {
+			return nil, fmt.Errorf("\"Fit\" field is invalid, %v", err)
+		} else {
+			opt.Fit = f
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Color", "color"); err == nil {
+		if t.Type == kValueTypeNull {
+			opt.Color = nil
+		} else if clr, err := JsonToColor(t, palette); err != nil {
+			return nil, fmt.Errorf("\"Color\" field is invalid, %v", err)
+		} else {
+			opt.Color = clr
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Colormap", "colormap"); err == nil {
+		if t.Type == kValueTypeNull {
+			opt.Colormap = nil
+		} else if m, err := ParseColormap(t); err != nil {
+			return nil, fmt.Errorf("\"Colormap\" field is invalid, %v", err)
+		} else {
+			opt.Colormap = m
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Resample", "resample"); err == nil {
+		if t.Type == kValueTypeNull {
+			opt.Resample = nil
+		} else if r, err := parseResample(t); err != nil {
+			return nil, fmt.Errorf("\"Resample\" field is invalid, %v", err)
+		} else {
+			opt.Resample = r
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Smooth", "smooth"); err == nil {
+		if t.Type == kValueTypeNull {
+			opt.Smooth = nil
+		} else if sm, err := parseSmooth(t); err != nil {
+			return nil, fmt.Errorf("\"Smooth\" field is invalid, %v", err)
+		} else {
+			opt.Smooth = sm
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Downsample", "downsample"); err == nil {
+		if t.Type == kValueTypeNull {
+			opt.Downsample = 0
+		} else if n, err := parseDownsample(t); err != nil {
+			return nil, fmt.Errorf("\"Downsample\" field is invalid, %v", err)
+		} else {
+			opt.Downsample = n
+		}
+	}
+
+	return &opt, nil
+}
+
+// reduce resamples, smooths and downsamples the points, they are returned as is when
+// none of them is set
+func (o *seriesOptions) reduce(pts plotter.XYs) plotter.XYs {
+	if o.Resample == nil && o.Smooth == nil && o.Downsample == 0 {
+		return pts
+	}
+
+	pts = sortByX(pts)
+	if o.Resample != nil {
+		pts = o.Resample.apply(pts)
+	}
+	if o.Smooth != nil {
+		pts = o.Smooth.apply(pts)
+	}
+	if o.Downsample != 0 {
+		pts = lttb(pts, o.Downsample)
+	}
+	return pts
+}
+
+// color is the color of the series, def comes from the palette
+func (o *seriesOptions) color(def color.Color) color.Color {
+	if o.Color != nil {
+		return o.Color
+	}
+	return def
+}
+
+// colorByY sets the color of each marker from the colormap by its Y value
+func (o *seriesOptions) colorByY(sc *plotter.Scatter, pts plotter.XYs) {
+	if o.Colormap == nil || len(pts) == 0 {
+		return
+	}
+
+	// every series has its own domain when it is not given
+	m := *o.Colormap
+	ymin, ymax := pts[0].Y, pts[0].Y
+	for _, pt := range pts {
+		ymin = math.Min(ymin, pt.Y)
+		ymax = math.Max(ymax, pt.Y)
+	}
+	m.SetDomain(ymin, ymax)
+
+	sty := sc.GlyphStyle
+	sc.GlyphStyleFunc = func(idx int) draw.GlyphStyle {
+		ret := sty
+		ret.Color = m.At(pts[idx].Y)
+		return ret
+	}
+}
+
+// addTo puts the series on the chart against the Y axis it asks for
+func (o *seriesOptions) addTo(chart *Chart, name string, clr color.Color, pts plotter.XYs, ps ...plot.Plotter) error {
+	var s *Series
+	if o.Axis == kAxisRight {
+		var err error
+		if s, err = chart.AddRightSeries(name, clr, pts, ps...); err != nil {
+			return err
+		}
+	} else {
+		s = chart.AddSeries(name, clr, pts, ps...)
+	}
+	s.NoLegend = o.HideLegend
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot/plotter"
+	"math"
+	"sort"
+	"time"
+)
+
+// Dense series are reduced before they are drawn, in this order:
+//
+//   - "Resample" buckets the points into fixed intervals of X and aggregates each
+//     bucket, ie {"Interval": "5m", "Aggregate": "p99"}. The interval is in the unit
+//     of X, or a duration like "30s" on a time axis
+//   - "Smooth" is a moving window over the points, "sma" for the simple moving
+//     average, "ema" for the exponential one and "median" for the rolling median, ie
+//     {"Type": "ema", "Window": 20}
+//   - "Downsample" keeps the given number of points with Largest-Triangle-Three-Buckets,
+//     which picks the points that keep the visual shape of the line
+//
+// The points are sorted by X first since all of them walk along X
+
+type smoothSpec struct {
+	Type   string
+	Window int
+	Alpha  float64
+}
+
+type resampleSpec struct {
+	Interval  float64
+	Aggregate *aggregate
+}
+
+const (
+	kDefaultSmoothWindow = 5
+
+	// LTTB always keeps the first and the last point
+	kMinDownsample = 3
+)
+
+func parseSmooth(v Value) (*smoothSpec, error) {
+	s := &smoothSpec{Window: kDefaultSmoothWindow}
+
+	switch v.Type {
+	case kValueTypeString:
+		s.Type = v.String
+	case kValueTypeObject:
+		if t, err := JsonObjectGetMultipleKey(v, "Type", "type"); err != nil {
+			return nil, err
+		} else {
+			if val, err := JsonGetString(t); err != nil {
+				return nil, fmt.Errorf("\"Type\" field is not a string")
+			} else {
+				s.Type = val
+			}
+		}
+
+		if t, err := JsonObjectGetMultipleKey(v, "Window", "window"); err == nil {
+			if val, err := JsonGetNumber(t); err != nil || val < 1 || val != math.Floor(val) {
+				return nil, fmt.Errorf("\"Window\" field must be a positive integer")
+			} else {
+				s.Window = int(val)
+			}
+		}
+
+		if t, err := JsonObjectGetMultipleKey(v, "Alpha", "alpha"); err == nil {
+			if val, err := JsonGetNumber(t); err != nil || val <= 0 || val > 1 {
+				return nil, fmt.Errorf("\"Alpha\" field must be a number in (0, 1]")
+			} else {
+				s.Alpha = val
+			}
+		}
+	default:
+		return nil, fmt.Errorf("value must be a string or an object but got type %s", v.Type.GetName())
+	}
+
+	switch s.Type {
+	case "sma", "ema", "median":
+	default:
+		return nil, fmt.Errorf("smoothing %s is unknown, must be sma, ema or median", s.Type)
+	}
+
+	// the usual alpha giving the ema the same center of mass as the sma
+	if s.Alpha == 0 {
+		s.Alpha = 2 / float64(s.Window+1)
+	}
+	return s, nil
+}
+
+func parseResample(v Value) (*resampleSpec, error) {
+	r := &resampleSpec{Aggregate: &aggregate{op: "mean"}}
+
+	if v.Type != kValueTypeObject {
+		return nil, fmt.Errorf("value must be an object but got type %s", v.Type.GetName())
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Interval", "interval"); err != nil {
+		return nil, err
+	} else {
+		switch t.Type {
+		case kValueTypeNumber:
+			r.Interval = t.Number
+		case kValueTypeString:
+			d, err := time.ParseDuration(t.String)
+			if err != nil {
+				return nil, fmt.Errorf("\"Interval\" %s is not a duration, %v", t.String, err)
+			}
+			r.Interval = d.Seconds()
+		default:
+			return nil, fmt.Errorf("\"Interval\" field must be a number or a duration")
+		}
+		if r.Interval <= 0 {
+			return nil, fmt.Errorf("\"Interval\" field must be positive")
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Aggregate", "aggregate"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Aggregate\" field is not a string")
+		} else {
+			r.Aggregate = &aggregate{op: val}
+			if err := r.Aggregate.parseOp(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func parseDownsample(v Value) (int, error) {
+	if val, err := JsonGetNumber(v); err != nil || val < kMinDownsample || val != math.Floor(val) {
+		return 0, fmt.Errorf("value must be an integer of at least %d", kMinDownsample)
+	} else {
+		return int(val), nil
+	}
+}
+
+func sortByX(pts plotter.XYs) plotter.XYs {
+	ret := make(plotter.XYs, len(pts))
+	copy(ret, pts)
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].X < ret[j].X })
+	return ret
+}
+
+// apply the resampling to points sorted by X, a bucket is placed at its start and
+// empty buckets are left out. Points without a finite X belong to no bucket and are
+// dropped
+func (r *resampleSpec) apply(pts plotter.XYs) plotter.XYs {
+	ret := plotter.XYs{}
+	for i := 0; i < len(pts); {
+		if math.IsNaN(pts[i].X) || math.IsInf(pts[i].X, 0) {
+			i++
+			continue
+		}
+
+		// the bucket always takes its first point, an interval too small for the
+		// precision of X would never move past it otherwise
+		start := math.Floor(pts[i].X/r.Interval) * r.Interval
+		ys := []float64{pts[i].Y}
+		for i++; i < len(pts) && pts[i].X < start+r.Interval; i++ {
+			ys = append(ys, pts[i].Y)
+		}
+		if y := r.Aggregate.reduce(ys); !math.IsNaN(y) {
+			ret = append(ret, plotter.XY{X: start, Y: y})
+		}
+	}
+	return ret
+}
+
+// apply the moving window to points sorted by X. The window trails the point, the
+// first points average over what is available so far
+func (s *smoothSpec) apply(pts plotter.XYs) plotter.XYs {
+	ret := make(plotter.XYs, len(pts))
+	sum := 0.0
+	for idx, p := range pts {
+		ret[idx].X = p.X
+
+		switch s.Type {
+		case "sma":
+			sum += p.Y
+			if idx >= s.Window {
+				sum -= pts[idx-s.Window].Y
+			}
+			ret[idx].Y = sum / math.Min(float64(idx+1), float64(s.Window))
+
+		case "ema":
+			if idx == 0 {
+				ret[idx].Y = p.Y
+			} else {
+				ret[idx].Y = s.Alpha*p.Y + (1-s.Alpha)*ret[idx-1].Y
+			}
+
+		case "median":
+			from := idx - s.Window + 1
+			if from < 0 {
+				from = 0
+			}
+			window := make([]float64, 0, idx-from+1)
+			for _, q := range pts[from : idx+1] {
+				window = append(window, q.Y)
+			}
+			ret[idx].Y = statPercentile(window, 50)
+		}
+	}
+	return ret
+}
+
+// lttb downsamples points sorted by X to n points with Largest-Triangle-Three-Buckets.
+// The points between the first and the last one are split into n-2 buckets, and each
+// bucket keeps the point forming the largest triangle with the point kept from the
+// previous bucket and the average of the next bucket
+func lttb(pts plotter.XYs, n int) plotter.XYs {
+	if n >= len(pts) || n < kMinDownsample {
+		return pts
+	}
+
+	ret := make(plotter.XYs, 0, n)
+	ret = append(ret, pts[0])
+
+	every := float64(len(pts)-2) / float64(n-2)
+	prev := 0
+	for i := 0; i < n-2; i++ {
+		// the average of the next bucket, which is the last point for the last bucket
+		nextFrom := int(math.Floor(float64(i+1)*every)) + 1
+		nextTo := int(math.Floor(float64(i+2)*every)) + 1
+		if nextTo > len(pts) {
+			nextTo = len(pts)
+		}
+		var avgX, avgY float64
+		for _, p := range pts[nextFrom:nextTo] {
+			avgX += p.X
+			avgY += p.Y
+		}
+		if count := float64(nextTo - nextFrom); count > 0 {
+			avgX /= count
+			avgY /= count
+		}
+
+		from := int(math.Floor(float64(i)*every)) + 1
+		to := nextFrom
+		pick, best := from, -1.0
+		for j := from; j < to; j++ {
+			area := math.Abs((pts[prev].X-avgX)*(pts[j].Y-pts[prev].Y) -
+				(pts[prev].X-pts[j].X)*(avgY-pts[prev].Y))
+			if area > best {
+				pick, best = j, area
+			}
+		}
+
+		ret = append(ret, pts[pick])
+		prev = pick
+	}
+
+	return append(ret, pts[len(pts)-1])
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot/plotter"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testSeries is the points at x = 0, 1, 2... with the ys
+func testSeries(ys ...float64) plotter.XYs {
+	pts := make(plotter.XYs, len(ys))
+	for idx, y := range ys {
+		pts[idx] = plotter.XY{X: float64(idx), Y: y}
+	}
+	return pts
+}
+
+// formatPoints writes the points as x:y pairs
+func formatPoints(pts plotter.XYs) string {
+	ret := []string{}
+	for _, p := range pts {
+		ret = append(ret, fmt.Sprintf("%g:%g", p.X, p.Y))
+	}
+	return strings.Join(ret, " ")
+}
+
+func TestSmooth(t *testing.T) {
+	pts := testSeries(3, 6, 9, 0, 3, 30)
+
+	for _, c := range []struct {
+		smooth string
+		want   []float64
+	}{
+		{`{"Type": "sma", "Window": 3}`, []float64{3, 4.5, 6, 5, 4, 11}},
+		{`{"Type": "sma", "Window": 1}`, []float64{3, 6, 9, 0, 3, 30}},
+		{`{"Type": "ema", "Alpha": 0.5}`, []float64{3, 4.5, 6.75, 3.375, 3.1875, 16.59375}},
+		{`{"Type": "ema", "Window": 3}`, []float64{3, 4.5, 6.75, 3.375, 3.1875, 16.59375}},
+		{`{"Type": "median", "Window": 3}`, []float64{3, 4.5, 6, 6, 3, 3}},
+		{`"sma"`, []float64{3, 4.5, 6, 4.5, 4.2, 9.6}},
+	} {
+		s, err := parseSmooth(mustParseValue(t, c.smooth))
+		if err != nil {
+			t.Errorf("smoothing %s is invalid, %v", c.smooth, err)
+			continue
+		}
+		got := s.apply(pts)
+		for idx := range c.want {
+			if got[idx].X != pts[idx].X || math.Abs(got[idx].Y-c.want[idx]) > 1e-9 {
+				t.Errorf("smoothing %s got %s, want the ys %v", c.smooth, formatPoints(got), c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	pts := plotter.XYs{{X: 0, Y: 1}, {X: 4, Y: 3}, {X: 9.5, Y: 8}, {X: 10, Y: 10}, {X: 31, Y: 7},
+		{X: 35, Y: 1}, {X: math.NaN(), Y: 100}}
+
+	for _, c := range []struct {
+		resample string
+		pts      plotter.XYs
+		want     string
+	}{
+		{`{"Interval": 10}`, pts, "0:4 10:10 30:4"},
+		{`{"Interval": 10, "Aggregate": "max"}`, pts, "0:8 10:10 30:7"},
+		{`{"Interval": 10, "Aggregate": "count"}`, pts, "0:3 10:1 30:2"},
+		{`{"Interval": 20, "Aggregate": "sum"}`, pts, "0:22 20:8"},
+		{`{"Interval": "1m", "Aggregate": "min"}`, plotter.XYs{{X: 59, Y: 5}, {X: 60, Y: 3}, {X: 90, Y: 1}},
+			"0:5 60:1"},
+		// an interval below the precision of X still moves on
+		{`{"Interval": 0.000000001}`, plotter.XYs{{X: 1.7e9, Y: 1}, {X: 1.7e9, Y: 3}}, "1.7e+09:1 1.7e+09:3"},
+		{`{"Interval": 5}`, plotter.XYs{}, ""},
+	} {
+		r, err := parseResample(mustParseJson(t, c.resample))
+		if err != nil {
+			t.Errorf("resample %s is invalid, %v", c.resample, err)
+			continue
+		}
+		if got := formatPoints(r.apply(c.pts)); got != c.want {
+			t.Errorf("resample %s got %s, want %s", c.resample, got, c.want)
+		}
+	}
+}
+
+func TestLttb(t *testing.T) {
+	// a flat line with a spike, the spike must survive
+	ys := make([]float64, 100)
+	ys[37] = 50
+	pts := testSeries(ys...)
+
+	got := lttb(pts, 10)
+	if len(got) != 10 || got[0] != pts[0] || got[9] != pts[99] {
+		t.Fatalf("lttb to 10 points got %s", formatPoints(got))
+	}
+	found := false
+	for _, p := range got {
+		found = found || p.Y == 50
+	}
+	if !found {
+		t.Errorf("lttb lost the spike, got %s", formatPoints(got))
+	}
+
+	// every size takes its points from inside of the series in order, whatever the
+	// bucket bounds round to
+	for size := 3; size <= 40; size++ {
+		for n := kMinDownsample; n <= size+1; n++ {
+			got := lttb(testSeries(make([]float64, size)...), n)
+			want := n
+			if n >= size {
+				want = size
+			}
+			if len(got) != want {
+				t.Errorf("lttb of %d points to %d got %d points", size, n, len(got))
+				continue
+			}
+			for idx := 1; idx < len(got); idx++ {
+				if got[idx].X <= got[idx-1].X {
+					t.Errorf("lttb of %d points to %d got %s", size, n, formatPoints(got))
+					break
+				}
+			}
+		}
+	}
+
+	if got := lttb(pts, 2); len(got) != len(pts) {
+		t.Errorf("lttb below %d points got %d points, want them all", kMinDownsample, len(got))
+	}
+}
+
+func TestParseSmoothError(t *testing.T) {
+	for _, c := range []struct {
+		doc string
+		msg string
+	}{
+		{`"wma"`, "smoothing wma is unknown, must be sma, ema or median"},
+		{`{"Type": "sma", "Window": 0}`, `"Window" field must be a positive integer`},
+		{`{"Type": "sma", "Window": 2.5}`, `"Window" field must be a positive integer`},
+		{`{"Type": "ema", "Alpha": 0}`, `"Alpha" field must be a number in (0, 1]`},
+		{`{"Type": 3}`, `"Type" field is not a string`},
+		{`[1]`, "value must be a string or an object but got type list"},
+	} {
+		if _, err := parseSmooth(mustParseValue(t, c.doc)); err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("smoothing %s got error %v, want %q", c.doc, err, c.msg)
+		}
+	}
+
+	for _, c := range []struct {
+		doc string
+		msg string
+	}{
+		{`{"Interval": 0}`, `"Interval" field must be positive`},
+		{`{"Interval": "5 minutes"}`, `"Interval" 5 minutes is not a duration`},
+		{`{"Interval": true}`, `"Interval" field must be a number or a duration`},
+		{`{"Interval": 5, "Aggregate": "mode"}`, "aggregation mode is unknown"},
+		{`{"Interval": 5, "Aggregate": "p200"}`, "percentile p200 must be between p0 and p100"},
+		{`{"Aggregate": "max"}`, "Interval"},
+		{`5`, "value must be an object but got type number"},
+	} {
+		if _, err := parseResample(mustParseValue(t, c.doc)); err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("resample %s got error %v, want %q", c.doc, err, c.msg)
+		}
+	}
+
+	for _, doc := range []string{`2`, `10.5`, `"100"`} {
+		if _, err := parseDownsample(mustParseValue(t, doc)); err == nil ||
+			!strings.Contains(err.Error(), "value must be an integer of at least 3") {
+			t.Errorf("downsample %s got error %v", doc, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Spec is the parsed input document. The root of the input can be a single job, a
+// list of jobs, or an object which carries the list of jobs under "Jobs" together
+// with settings applied to the whole document. The jobs are complete on their own,
+// includes, templates, defaults and "ForEach" are already resolved
+type Spec struct {
+	Jobs []Value
+
+	// not nil when the jobs are rendered into a single report instead of one file
+	// per job
+	Report *ReportConfig
+}
+
+// Job is a single plot request inside of the input document
+type Job struct {
+	Index   int
+	Plotter Plotter
+	Path    string
+	Caption string
+	Config  Value
+
+	// applied to the "Data" of the config before rendering, nil when not given
+	Transform *Transform
+}
+
+func isSpecDocument(root Value) bool {
+	if root.Type != kValueTypeObject {
+		return false
+	}
+	_, err := JsonObjectGetMultipleKey(root, "Jobs", "jobs")
+	return err == nil
+}
+
+// ParseSpec resolves the input document into its jobs. The variables of the command
+// line are in overrides, and dir is the directory of the input which relative paths
+// start from, empty for the working directory
+func ParseSpec(root Value, overrides map[string]string, dir string) (*Spec, error) {
+	spec := &Spec{}
+
+	vars, err := newVarScope(root, overrides)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = substituteExcept(root, vars, "Vars", "vars"); err != nil {
+		return nil, err
+	}
+	if root, err = ExpandIncludes(root, dir, vars); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case root.Type == kValueTypeList:
+		if spec.Jobs, err = expandForEach(root.List.Value, dir); err != nil {
+			return nil, err
+		}
+
+	case isSpecDocument(root):
+		jobs, _ := JsonObjectGetMultipleKey(root, "Jobs", "jobs")
+		if jobs.Type != kValueTypeList {
+			return nil, fmt.Errorf("\"Jobs\" field must be a list but got type %s", jobs.Type.GetName())
+		}
+		if spec.Jobs, err = applyTemplates(root, jobs.List.Value); err != nil {
+			return nil, err
+		}
+		if spec.Jobs, err = expandForEach(spec.Jobs, dir); err != nil {
+			return nil, err
+		}
+
+		// the templates and the defaults are in the jobs by now
+		if root, err = substituteExcept(root, newLoopScope(nil, 0), "Vars", "vars", "Jobs", "jobs",
+			"Templates", "templates", "Defaults", "defaults"); err != nil {
+			return nil, err
+		}
+
+		if v, err := JsonObjectGetMultipleKey(root, "Themes", "themes"); err == nil {
+			if err := RegisterThemes(withDataDir(v, dir)); err != nil {
+				return nil, fmt.Errorf("\"Themes\" field is invalid, %v", err)
+			}
+		}
+
+		// the theme of the document is the default of every job
+		if v, err := JsonObjectGetMultipleKey(root, "Theme", "theme"); err == nil {
+			// the jobs get their font files from dir at the end
+			if _, err := ParseTheme(withDataDir(v, dir)); err != nil {
+				return nil, fmt.Errorf("\"Theme\" field is invalid, %v", err)
+			}
+			for idx, job := range spec.Jobs {
+				if config, err := JsonObjectGetMultipleKey(job, "Config", "config"); err == nil {
+					config = JsonObjectWithDefault(config, v, "Theme", "theme")
+					spec.Jobs[idx] = JsonObjectWithKey(job, config, "Config", "config")
+				}
+			}
+		}
+
+		if v, err := JsonObjectGetMultipleKey(root, "Report", "report"); err == nil {
+			if report, err := ParseReportConfig(v); err != nil {
+				return nil, fmt.Errorf("\"Report\" field is invalid, %v", err)
+			} else {
+				spec.Report = report
+			}
+		}
+
+	case root.Type == kValueTypeObject:
+		if spec.Jobs, err = expandForEach([]Value{root}, dir); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("the root element of input json *MUST* be an object")
+	}
+
+	for idx, job := range spec.Jobs {
+		spec.Jobs[idx] = withDataDir(job, dir)
+	}
+	return spec, nil
+}
+
+// ParseJob checks a job object and finds its plotter. The "Path" field is only
+// required when needPath is true, since jobs inside of a report are not saved
+// into their own files
+func ParseJob(index int, jdom Value, needPath bool) (*Job, error) {
+	job := &Job{Index: index}
+
+	if t, err := JsonObjectGetMultipleKey(jdom, "Type", "type"); err != nil {
+		return nil, fmt.Errorf("index %d,%v", index, err)
+	} else {
+		if name, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("index %d,\"Type\" field is not a string", index)
+		} else {
+			job.Plotter = NewPlotter(name)
+			if job.Plotter == nil {
+				return nil, fmt.Errorf("index %d,plotter %s doesn't support", index, name)
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(jdom, "Path", "path"); err != nil {
+		if needPath {
+			return nil, fmt.Errorf("index %d,%v", index, err)
+		}
+	} else {
+		if name, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("index %d,\"Path\" field is not a string", index)
+		} else {
+			job.Path = name
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(jdom, "Caption", "caption"); err == nil {
+		if caption, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("index %d,\"Caption\" field is not a string", index)
+		} else {
+			job.Caption = caption
+		}
+	}
+
+	if d, err := JsonObjectGetMultipleKey(jdom, "Config", "config"); err != nil {
+		return nil, fmt.Errorf("index %d,%v", index, err)
+	} else {
+		job.Config = d
+	}
+
+	if t, err := JsonObjectGetMultipleKey(jdom, "Transform", "transform"); err == nil {
+		if tr, err := ParseTransform(t); err != nil {
+			return nil, fmt.Errorf("index %d,\"Transform\" field is invalid, %v", index, err)
+		} else {
+			job.Transform = tr
+		}
+	}
+
+	return job, nil
+}
+
+// transformedConfig is a copy of the config whose "Data" went through the transform
+func (job *Job) transformedConfig() (Value, error) {
+	if job.Transform == nil {
+		return job.Config, nil
+	}
+
+	data, err := JsonObjectGetMultipleKey(job.Config, "Data", "data")
+	if err != nil {
+		return NewNull(), fmt.Errorf("\"Transform\" needs a \"Data\" field in config")
+	}
+	if data, err = ResolveData(data); err != nil {
+		return NewNull(), err
+	}
+	if data, err = job.Transform.Apply(data); err != nil {
+		return NewNull(), fmt.Errorf("\"Transform\" %v", err)
+	}
+
+	config := NewObject()
+	for k, v := range job.Config.Object.Value {
+		if k != "data" {
+			config.Value[k] = v
+		}
+	}
+	config.Value["Data"] = data
+	return Value{Type: kValueTypeObject, Object: config}, nil
+}
+
+// Render the job into a chart
+func (job *Job) Render() (*Chart, error) {
+	config, err := job.transformedConfig()
+	if err != nil {
+		return nil, fmt.Errorf("index %d,%v", job.Index, err)
+	}
+
+	chart, err := RenderChart(job.Plotter, config)
+	if err != nil {
+		return nil, fmt.Errorf("index %d,%v", job.Index, err)
+	}
+	return chart, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// a few descriptive statistics over a sample, they don't modify the sample
+
+func statSum(xs []float64) float64 {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum
+}
+
+func statMean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return math.NaN()
+	}
+	return statSum(xs) / float64(len(xs))
+}
+
+func statMin(xs []float64) float64 {
+	if len(xs) == 0 {
+		return math.NaN()
+	}
+	min := xs[0]
+	for _, x := range xs[1:] {
+		min = math.Min(min, x)
+	}
+	return min
+}
+
+func statMax(xs []float64) float64 {
+	if len(xs) == 0 {
+		return math.NaN()
+	}
+	max := xs[0]
+	for _, x := range xs[1:] {
+		max = math.Max(max, x)
+	}
+	return max
+}
+
+// statStdDev is the sample standard deviation
+func statStdDev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return math.NaN()
+	}
+	mean := statMean(xs)
+	ss := 0.0
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	return math.Sqrt(ss / float64(len(xs)-1))
+}
+
+// statPercentile interpolates linearly between the closest ranks, p is in [0, 100]
+func statPercentile(xs []float64, p float64) float64 {
+	if len(xs) == 0 {
+		return math.NaN()
+	}
+
+	sorted := make([]float64, len(xs))
+	copy(sorted, xs)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	if lo < 0 {
+		return sorted[0]
+	}
+	if hi >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
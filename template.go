@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A spec document can cut down on repeating itself in three ways:
+//
+//	{
+//	    "Include": "shared.json",
+//	    "Defaults": {"Size": 6, "Grids": true},
+//	    "Templates": {
+//	        "latency": {"Type": "dot-plotter", "Config": {"Y": "ms", "XAxis": {"Type": "time"}}},
+//	        "p99": {"Extends": "latency", "Config": {"Title": "p99"}}
+//	    },
+//	    "Jobs": [
+//	        {"Extends": "p99", "Path": "p99.png", "Config": {"Data": {...}}}
+//	    ]
+//	}
+//
+// "Include" can be put in any object, the files it names are loaded and the object is
+// merged on top of them, so the keys next to "Include" win. A path is relative to the
+// file the include is written in, or to the directory of the input for the input
+// itself.
+//
+// "Templates" are named job fragments. A job or a template pulls them in by "Extends",
+// a name or a list of names merged in order, and is merged on top of them.
+//
+// "Defaults" is merged under the "Config" of every job.
+//
+// Merging is deep: objects are merged key by key, where keys of options differing
+// only in case are the same key, and everything else is replaced. The keys of the
+// objects under "Data", "Vars", "Templates", "Themes", "Derive", "Aggregate" and
+// "Query" are names, ie the series "A" and "a" stay apart. A null value removes the
+// key
+
+// kNamedKeys are the keys whose object has names for its keys instead of options
+var kNamedKeys = map[string]bool{
+	"data":      true,
+	"vars":      true,
+	"templates": true,
+	"themes":    true,
+	"derive":    true,
+	"aggregate": true,
+	"query":     true,
+}
+
+// JsonMerge deep merges over on top of base, neither of them is modified
+func JsonMerge(base, over Value) Value {
+	return jsonMerge(base, over, true)
+}
+
+// jsonMerge is JsonMerge, fold tells if the keys of the objects are options which
+// are matched without case
+func jsonMerge(base, over Value, fold bool) Value {
+	if base.Type != kValueTypeObject || over.Type != kValueTypeObject {
+		return over
+	}
+
+	obj := NewObject()
+	for k, x := range base.Object.Value {
+		obj.Value[k] = x
+	}
+
+	keys := []string{}
+	for k := range over.Object.Value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		x := over.Object.Value[k]
+
+		// the value under another spelling of the key is what gets merged into
+		old, found := NewNull(), false
+		for bk, bx := range obj.Value {
+			if bk == k || (fold && strings.EqualFold(bk, k)) {
+				old, found = bx, true
+				delete(obj.Value, bk)
+			}
+		}
+
+		switch {
+		case x.Type == kValueTypeNull:
+		case found:
+			obj.Value[k] = jsonMerge(old, x, !fold || !kNamedKeys[strings.ToLower(k)])
+		default:
+			obj.Value[k] = x
+		}
+	}
+	return Value{Type: kValueTypeObject, Object: obj}
+}
+
+// includer expands "Include" while keeping the files being included, which is how
+// a file including itself is found. The variables of the document are replaced in
+// the files as they are loaded
+type includer struct {
+	stack []string
+	vars  *varScope
+}
+
+// ExpandIncludes replaces every "Include" in v, dir is where relative paths start
+func ExpandIncludes(v Value, dir string, vars *varScope) (Value, error) {
+	in := &includer{vars: vars}
+	return in.expand(v, dir)
+}
+
+func (in *includer) expand(v Value, dir string) (Value, error) {
+	switch v.Type {
+	case kValueTypeList:
+		list := NewList()
+		for _, x := range v.List.Value {
+			if val, err := in.expand(x, dir); err != nil {
+				return NewNull(), err
+			} else {
+				list.Value = append(list.Value, val)
+			}
+		}
+		return Value{Type: kValueTypeList, List: list}, nil
+
+	case kValueTypeObject:
+	default:
+		return v, nil
+	}
+
+	obj := NewObject()
+	for k, x := range v.Object.Value {
+		if k == "Include" || k == "include" {
+			continue
+		}
+		if val, err := in.expand(x, dir); err != nil {
+			return NewNull(), err
+		} else {
+			obj.Value[k] = val
+		}
+	}
+	ret := Value{Type: kValueTypeObject, Object: obj}
+
+	t, err := JsonObjectGetMultipleKey(v, "Include", "include")
+	if err != nil {
+		return ret, nil
+	}
+
+	paths := []string{}
+	switch t.Type {
+	case kValueTypeString:
+		paths = append(paths, t.String)
+	case kValueTypeList:
+		for _, x := range t.List.Value {
+			if val, err := JsonGetString(x); err != nil {
+				return NewNull(), fmt.Errorf("\"Include\" field must be a path or a list of paths")
+			} else {
+				paths = append(paths, val)
+			}
+		}
+	default:
+		return NewNull(), fmt.Errorf("\"Include\" field must be a path or a list of paths but got type %s",
+			t.Type.GetName())
+	}
+
+	base := NewNull()
+	for _, path := range paths {
+		included, err := in.load(path, dir)
+		if err != nil {
+			return NewNull(), err
+		}
+		base = JsonMerge(base, included)
+	}
+	return JsonMerge(base, ret), nil
+}
+
+// load reads the file and expands the includes inside of it
+func (in *includer) load(path, dir string) (Value, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return NewNull(), fmt.Errorf("\"Include\" %s is invalid, %v", path, err)
+	}
+
+	for idx, x := range in.stack {
+		if x == abs {
+			chain := append(append([]string{}, in.stack[idx:]...), abs)
+			return NewNull(), fmt.Errorf("\"Include\" %s includes itself through %s", path,
+				strings.Join(chain, " -> "))
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return NewNull(), fmt.Errorf("\"Include\" %s cannot be read, %v", path, err)
+	}
+	v, err := NewJsonParser(string(data)).Parse()
+	if err != nil {
+		return NewNull(), fmt.Errorf("\"Include\" %s is not valid json, %v", path, err)
+	}
+	if in.vars != nil {
+		if v, err = in.vars.substitute(v); err != nil {
+			return NewNull(), fmt.Errorf("\"Include\" %s, %v", path, err)
+		}
+	}
+
+	in.stack = append(in.stack, abs)
+	defer func() { in.stack = in.stack[:len(in.stack)-1] }()
+	return in.expand(v, filepath.Dir(path))
+}
+
+// resolveTemplates merges every template on top of the ones it extends, a template
+// can extend another one no matter the order they are written in
+func resolveTemplates(v Value) (map[string]Value, error) {
+	if v.Type != kValueTypeObject {
+		return nil, fmt.Errorf("value must be an object but got type %s", v.Type.GetName())
+	}
+
+	resolved := map[string]Value{}
+	visiting := map[string]bool{}
+
+	var resolve func(name string) (Value, error)
+	resolve = func(name string) (Value, error) {
+		if x, ok := resolved[name]; ok {
+			return x, nil
+		}
+		def, ok := v.Object.Value[name]
+		if !ok {
+			return NewNull(), fmt.Errorf("template %s is unknown", name)
+		}
+		if def.Type != kValueTypeObject {
+			return NewNull(), fmt.Errorf("template %s must be an object but got type %s", name, def.Type.GetName())
+		}
+		if visiting[name] {
+			return NewNull(), fmt.Errorf("template %s extends itself through other templates", name)
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		x, err := extendTemplates(def, resolve)
+		if err != nil {
+			return NewNull(), fmt.Errorf("template %s, %v", name, err)
+		}
+		resolved[name] = x
+		return x, nil
+	}
+
+	names := []string{}
+	for k := range v.Object.Value {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// extendTemplates merges v on top of the templates named by its "Extends", which is
+// dropped from the result
+func extendTemplates(v Value, lookup func(string) (Value, error)) (Value, error) {
+	t, err := JsonObjectGetMultipleKey(v, "Extends", "extends")
+	if err != nil {
+		return v, nil
+	}
+
+	names := []string{}
+	switch t.Type {
+	case kValueTypeString:
+		names = append(names, t.String)
+	case kValueTypeList:
+		for _, x := range t.List.Value {
+			if val, err := JsonGetString(x); err != nil {
+				return NewNull(), fmt.Errorf("\"Extends\" field must be a name or a list of names")
+			} else {
+				names = append(names, val)
+			}
+		}
+	default:
+		return NewNull(), fmt.Errorf("\"Extends\" field must be a name or a list of names but got type %s",
+			t.Type.GetName())
+	}
+
+	base := NewNull()
+	for _, name := range names {
+		x, err := lookup(name)
+		if err != nil {
+			return NewNull(), err
+		}
+		base = JsonMerge(base, x)
+	}
+
+	own := NewObject()
+	for k, x := range v.Object.Value {
+		if k != "Extends" && k != "extends" {
+			own.Value[k] = x
+		}
+	}
+	return JsonMerge(base, Value{Type: kValueTypeObject, Object: own}), nil
+}
+
+// applyTemplates resolves "Extends" of every job and merges "Defaults" under their
+// configs, either of them can be missing from the document
+func applyTemplates(root Value, jobs []Value) ([]Value, error) {
+	templates := map[string]Value{}
+	if v, err := JsonObjectGetMultipleKey(root, "Templates", "templates"); err == nil {
+		if templates, err = resolveTemplates(v); err != nil {
+			return nil, fmt.Errorf("\"Templates\" field is invalid, %v", err)
+		}
+	}
+	lookup := func(name string) (Value, error) {
+		if x, ok := templates[name]; ok {
+			return x, nil
+		}
+		return NewNull(), fmt.Errorf("template %s is unknown", name)
+	}
+
+	defaults, hasDefaults := NewNull(), false
+	if v, err := JsonObjectGetMultipleKey(root, "Defaults", "defaults"); err == nil {
+		if v.Type != kValueTypeObject {
+			return nil, fmt.Errorf("\"Defaults\" field must be an object but got type %s", v.Type.GetName())
+		}
+		defaults, hasDefaults = v, true
+	}
+
+	ret := make([]Value, len(jobs))
+	for idx, job := range jobs {
+		if job.Type != kValueTypeObject {
+			ret[idx] = job
+			continue
+		}
+
+		x, err := extendTemplates(job, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("index %d,%v", idx, err)
+		}
+
+		if hasDefaults {
+			config, err := JsonObjectGetMultipleKey(x, "Config", "config")
+			if err != nil {
+				config = Value{Type: kValueTypeObject, Object: NewObject()}
+			}
+			x = JsonObjectWithKey(x, JsonMerge(defaults, config), "Config", "config")
+		}
+		ret[idx] = x
+	}
+	return ret, nil
+}
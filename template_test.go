@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles writes the files by their relative paths into a temporary directory,
+// which is returned
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("directory of %s cannot be made, %v", path, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("file %s cannot be written, %v", path, err)
+		}
+	}
+	return dir
+}
+
+func TestJsonMerge(t *testing.T) {
+	for _, c := range []struct {
+		base string
+		over string
+		want string
+	}{
+		{`{"a": 1, "b": 2}`, `{"b": 3, "c": 4}`, `{"a": 1, "b": 3, "c": 4}`},
+		{`{"a": {"x": 1, "y": 2}}`, `{"a": {"y": 3}}`, `{"a": {"x": 1, "y": 3}}`},
+		{`{"a": [1, 2]}`, `{"a": [3]}`, `{"a": [3]}`},
+		{`{"a": {"x": 1}}`, `{"a": 5}`, `{"a": 5}`},
+		{`{"a": 1, "b": 2}`, `{"a": null}`, `{"b": 2}`},
+		{`{"Title": "a", "Size": 4}`, `{"title": "b"}`, `{"title": "b", "Size": 4}`},
+		{`{"XAxis": {"Min": 0}}`, `{"xaxis": {"max": 9}}`, `{"xaxis": {"Min": 0, "max": 9}}`},
+		{`{"Data": {"A": [1]}}`, `{"Data": {"a": [2]}}`, `{"Data": {"A": [1], "a": [2]}}`},
+		{`{"data": {"A": {"File": "a.csv"}}}`, `{"Data": {"A": {"file": "b.csv"}}}`,
+			`{"Data": {"A": {"file": "b.csv"}}}`},
+		{`{"Vars": {"W": 1}, "Query": {"Q": "$"}}`, `{"vars": {"w": 2}, "query": {"q": "$.a"}}`,
+			`{"vars": {"W": 1, "w": 2}, "query": {"Q": "$", "q": "$.a"}}`},
+		{`5`, `{"a": 1}`, `{"a": 1}`},
+	} {
+		base, over := mustParseValue(t, c.base), mustParseValue(t, c.over)
+
+		got := JsonMerge(base, over)
+		want := mustParseValue(t, c.want)
+		if !sameJson(got, want) {
+			t.Errorf("merge of %s and %s got %s, want %s", c.base, c.over, got.ToJson(), want.ToJson())
+		}
+		if !sameJson(base, mustParseValue(t, c.base)) || !sameJson(over, mustParseValue(t, c.over)) {
+			t.Errorf("merge of %s and %s modified them", c.base, c.over)
+		}
+	}
+}
+
+func TestExpandIncludes(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"base.json":        `{"Type": "dot-plotter", "Config": {"Size": 6, "Grids": true}}`,
+		"theme.json":       `{"Config": {"Size": 8, "Title": "${title}"}}`,
+		"sub/nested.json":  `{"Include": "../base.json", "Config": {"Legend": "sub"}}`,
+		"sub/sibling.json": `{"Include": "nested.json", "Path": "out.png"}`,
+	})
+
+	for _, c := range []struct {
+		doc  string
+		want string
+	}{
+		{`{"Include": "base.json", "Config": {"Size": 4}}`,
+			`{"Type": "dot-plotter", "Config": {"Size": 4, "Grids": true}}`},
+		{`{"Include": ["base.json", "theme.json"]}`,
+			`{"Type": "dot-plotter", "Config": {"Size": 8, "Grids": true, "Title": "latency"}}`},
+		{`{"Jobs": [{"Include": "sub/sibling.json"}, {"Path": "b.png"}]}`,
+			`{"Jobs": [{"Type": "dot-plotter", "Path": "out.png", "Config": {"Size": 6, "Grids": true,
+			  "Legend": "sub"}}, {"Path": "b.png"}]}`},
+		{`{"Include": "base.json", "Config": {"Grids": null}}`, `{"Type": "dot-plotter", "Config": {"Size": 6}}`},
+		{`{"Config": {"Include": "theme.json"}}`, `{"Config": {"Config": {"Size": 8, "Title": "latency"}}}`},
+	} {
+		vars, err := newVarScope(mustParseJson(t, `{"Vars": {"title": "latency"}}`), nil)
+		if err != nil {
+			t.Fatalf("variables are invalid, %v", err)
+		}
+		got, err := ExpandIncludes(mustParseJson(t, c.doc), dir, vars)
+		if err != nil {
+			t.Errorf("document %s failed, %v", c.doc, err)
+			continue
+		}
+		want := mustParseJson(t, c.want)
+		if !sameJson(got, want) {
+			t.Errorf("document %s got %s, want %s", c.doc, got.ToJson(), want.ToJson())
+		}
+	}
+}
+
+func TestExpandIncludesError(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"self.json":   `{"Include": "self.json"}`,
+		"a.json":      `{"Include": "sub/b.json"}`,
+		"sub/b.json":  `{"Include": "../a.json"}`,
+		"twice.json":  `{"Include": ["base.json", "base.json"], "Jobs": [{"Include": "base.json"}]}`,
+		"base.json":   `{"Size": 6}`,
+		"broken.json": `{"Size": }`,
+	})
+
+	for _, c := range []struct {
+		doc string
+		msg string
+	}{
+		{`{"Include": "self.json"}`, "self.json includes itself through " + filepath.Join(dir, "self.json") +
+			" -> " + filepath.Join(dir, "self.json")},
+		{`{"Include": "a.json"}`, "includes itself through " + filepath.Join(dir, "a.json") + " -> " +
+			filepath.Join(dir, "sub/b.json") + " -> " + filepath.Join(dir, "a.json")},
+		{`{"Include": "missing.json"}`, `"Include" ` + filepath.Join(dir, "missing.json") + " cannot be read"},
+		{`{"Include": "broken.json"}`, `"Include" ` + filepath.Join(dir, "broken.json") + " is not valid json"},
+		{`{"Include": 5}`, `"Include" field must be a path or a list of paths but got type number`},
+		{`{"Include": ["base.json", 5]}`, `"Include" field must be a path or a list of paths`},
+	} {
+		_, err := ExpandIncludes(mustParseJson(t, c.doc), dir, nil)
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("document %s got error %v, want %q", c.doc, err, c.msg)
+		}
+	}
+
+	// a file included twice without a cycle is fine
+	if _, err := ExpandIncludes(mustParseJson(t, `{"Include": "twice.json"}`), dir, nil); err != nil {
+		t.Errorf("file included twice failed, %v", err)
+	}
+}
+
+func TestApplyTemplates(t *testing.T) {
+	for _, c := range []struct {
+		doc  string
+		want string
+	}{
+		{`{"Jobs": [{"Extends": "p99", "Path": "a.png"}],
+		   "Templates": {
+		       "p99": {"Extends": "latency", "Config": {"Title": "p99"}},
+		       "latency": {"Type": "dot-plotter", "Config": {"Y": "ms", "Title": "latency"}}}}`,
+			`[{"Type": "dot-plotter", "Path": "a.png", "Config": {"Y": "ms", "Title": "p99"}}]`},
+		{`{"Jobs": [{"Extends": ["a", "b"], "Config": {"Size": 3}}],
+		   "Templates": {"a": {"Config": {"Size": 1, "X": "a"}}, "b": {"Config": {"Size": 2}}}}`,
+			`[{"Config": {"Size": 3, "X": "a"}}]`},
+		{`{"Jobs": [{"Config": {"Size": 3}}, {"Path": "b.png"}, 5],
+		   "Defaults": {"Size": 6, "Grids": true}}`,
+			`[{"Config": {"Size": 3, "Grids": true}}, {"Path": "b.png", "Config": {"Size": 6, "Grids": true}}, 5]`},
+		{`{"Jobs": [{"Extends": "t"}],
+		   "Templates": {"t": {"Config": {"Data": {"A": [1]}}}},
+		   "Defaults": {"Data": {"a": [2]}}}`,
+			`[{"Config": {"Data": {"A": [1], "a": [2]}}}]`},
+	} {
+		root := mustParseJson(t, c.doc)
+		jobs, _ := JsonObjectGetMultipleKey(root, "Jobs")
+		got, err := applyTemplates(root, jobs.List.Value)
+		if err != nil {
+			t.Errorf("document %s failed, %v", c.doc, err)
+			continue
+		}
+		want := mustParseJson(t, c.want)
+		if list := (Value{Type: kValueTypeList, List: &List{Value: got}}); !sameJson(list, want) {
+			t.Errorf("document %s got %s, want %s", c.doc, list.ToJson(), want.ToJson())
+		}
+	}
+}
+
+func TestApplyTemplatesError(t *testing.T) {
+	for _, c := range []struct {
+		doc string
+		msg string
+	}{
+		{`{"Jobs": [{"Extends": "p50"}], "Templates": {"p99": {}}}`, "index 0,template p50 is unknown"},
+		{`{"Jobs": [{}], "Templates": {"a": {"Extends": "b"}, "b": {"Extends": "a"}}}`,
+			"template a, template b, template a extends itself through other templates"},
+		{`{"Jobs": [{}], "Templates": {"a": {"Extends": "a"}}}`, "template a extends itself through other templates"},
+		{`{"Jobs": [{}], "Templates": {"a": 5}}`, "template a must be an object but got type number"},
+		{`{"Jobs": [{}], "Templates": []}`, `"Templates" field is invalid, value must be an object but got type list`},
+		{`{"Jobs": [{"Extends": 5}]}`, `"Extends" field must be a name or a list of names but got type number`},
+		{`{"Jobs": [{}], "Defaults": [1]}`, `"Defaults" field must be an object but got type list`},
+	} {
+		root := mustParseJson(t, c.doc)
+		jobs, _ := JsonObjectGetMultipleKey(root, "Jobs")
+		if _, err := applyTemplates(root, jobs.List.Value); err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("document %s got error %v, want %q", c.doc, err, c.msg)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"image/color"
+	"sort"
+)
+
+// Theme is the look shared by every chart: colors of the background and the text,
+// fonts, the style of the grid, the palette of the series and where the legend goes.
+// "Theme" of a config or of the whole document is either the name of a theme or an
+// object defining one, and the "Themes" object of the document defines named themes
+// that can be referenced like the built-in ones. A theme defined in json starts from
+// the one named by "Extends", light by default:
+//
+//	"Themes": {
+//	    "slides": {
+//	        "Extends": "dark",
+//	        "Font": "Helvetica",
+//	        "TitleSize": 18,
+//	        "Grid": {"Color": "#5a5a5a", "Dashes": [2, 2]},
+//	        "Palette": ["gold", "hsl(200, 70%, 60%)", 2],
+//	        "Legend": "top-left"
+//	    }
+//	}
+//
+// Colors take any of the forms of JsonToColor, an index refers to the palette of the
+// extended theme. "Palette" can also be the name of a palette in PaletteFactory
+type Theme struct {
+	Name string
+
+	Background color.Color
+
+	// the color of the text, the axes and the ticks
+	Foreground color.Color
+
+	Font       string
+	TitleSize  vg.Length
+	LabelSize  vg.Length
+	TickSize   vg.Length
+	LegendSize vg.Length
+
+	Grid    draw.LineStyle
+	Palette []color.Color
+
+	// "top-right", "top-left", "bottom-right", "bottom-left" or "none"
+	Legend string
+}
+
+const (
+	kDefaultTheme = "light"
+
+	kLegendTopRight    = "top-right"
+	kLegendTopLeft     = "top-left"
+	kLegendBottomRight = "bottom-right"
+	kLegendBottomLeft  = "bottom-left"
+	kLegendNone        = "none"
+)
+
+var ThemeFactory map[string]*Theme = make(map[string]*Theme)
+
+func NewTheme(name string) *Theme {
+	if v, ok := ThemeFactory[name]; !ok {
+		return nil
+	} else {
+		return v
+	}
+}
+
+func rgb(r, g, b uint8) color.Color {
+	return color.RGBA{R: r, G: g, B: b, A: 255}
+}
+
+// ParseTheme reads the name of a theme or the definition of one
+func ParseTheme(v Value) (*Theme, error) {
+	switch v.Type {
+	case kValueTypeString:
+		if t := NewTheme(v.String); t != nil {
+			return t, nil
+		}
+		names := []string{}
+		for k := range ThemeFactory {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("theme %s is unknown, must be one of %v", v.String, names)
+	case kValueTypeObject:
+		return parseThemeObject(v)
+	default:
+		return nil, fmt.Errorf("theme must be a name or an object but got type %s", v.Type.GetName())
+	}
+}
+
+func parseThemeObject(v Value) (*Theme, error) {
+	base := NewTheme(kDefaultTheme)
+	if t, err := JsonObjectGetMultipleKey(v, "Extends", "extends"); err == nil {
+		if name, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Extends\" field is not a string")
+		} else if base = NewTheme(name); base == nil {
+			return nil, fmt.Errorf("\"Extends\" theme %s is unknown", name)
+		}
+	}
+
+	theme := *base
+	theme.Name = ""
+	theme.Palette = append([]color.Color{}, base.Palette...)
+
+	for _, x := range []struct {
+		keys []string
+		ptr  *color.Color
+	}{
+		{[]string{"Background", "background"}, &theme.Background},
+		{[]string{"Foreground", "foreground"}, &theme.Foreground},
+	} {
+		if t, err := JsonObjectGetMultipleKey(v, x.keys...); err == nil {
+			if clr, err := JsonToColor(t, base.Palette); err != nil {
+				return nil, fmt.Errorf("\"%s\" field is invalid, %v", x.keys[0], err)
+			} else {
+				*x.ptr = clr
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Font", "font"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Font\" field is not a string")
+		} else {
+			theme.Font = val
+		}
+	}
+
+	for _, x := range []struct {
+		keys []string
+		ptr  *vg.Length
+	}{
+		{[]string{"TitleSize", "titlesize"}, &theme.TitleSize},
+		{[]string{"LabelSize", "labelsize"}, &theme.LabelSize},
+		{[]string{"TickSize", "ticksize"}, &theme.TickSize},
+		{[]string{"LegendSize", "legendsize"}, &theme.LegendSize},
+	} {
+		if t, err := JsonObjectGetMultipleKey(v, x.keys...); err == nil {
+			if val, err := JsonGetNumber(t); err != nil || val <= 0 {
+				return nil, fmt.Errorf("\"%s\" field must be a positive number", x.keys[0])
+			} else {
+				*x.ptr = vg.Points(val)
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Grid", "grid"); err == nil {
+		if sty, err := JsonObjectToLineStyle(t, theme.Grid, base.Palette); err != nil {
+			return nil, fmt.Errorf("\"Grid\" field is invalid, %v", err)
+		} else {
+			theme.Grid = sty
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Palette", "palette"); err == nil {
+		if p, err := JsonToPalette(t, base.Palette); err != nil {
+			return nil, fmt.Errorf("\"Palette\" field is invalid, %v", err)
+		} else {
+			theme.Palette = p
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Legend", "legend"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Legend\" field is not a string")
+		} else {
+			switch val {
+			case kLegendTopRight, kLegendTopLeft, kLegendBottomRight, kLegendBottomLeft, kLegendNone:
+				theme.Legend = val
+			default:
+				return nil, fmt.Errorf("\"Legend\" %s is unknown, must be top-right, top-left, bottom-right, "+
+					"bottom-left or none", val)
+			}
+		}
+	}
+
+	// a bad font name is reported here instead of when the chart is created, a font
+	// file is loaded here as well
+	if err := CheckFont(theme.Font); err != nil {
+		return nil, fmt.Errorf("\"Font\" %s cannot be loaded, %v", theme.Font, err)
+	}
+	if _, err := vg.MakeFont(theme.Font, theme.TitleSize); err != nil {
+		return nil, fmt.Errorf("\"Font\" %s cannot be loaded, %v", theme.Font, err)
+	}
+
+	return &theme, nil
+}
+
+// RegisterThemes adds the themes of the "Themes" object of a document. A theme can
+// extend another one of the same object no matter the order they are written in
+func RegisterThemes(v Value) error {
+	if v.Type != kValueTypeObject {
+		return fmt.Errorf("value must be an object but got type %s", v.Type.GetName())
+	}
+
+	visiting := map[string]bool{}
+	var register func(name string) error
+	register = func(name string) error {
+		def := v.Object.Value[name]
+		if visiting[name] {
+			return fmt.Errorf("theme %s extends itself through other themes", name)
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		// the theme it extends is registered first when it is defined here as well
+		if t, err := JsonObjectGetMultipleKey(def, "Extends", "extends"); err == nil && t.Type == kValueTypeString {
+			if _, ok := v.Object.Value[t.String]; ok {
+				if err := register(t.String); err != nil {
+					return err
+				}
+			}
+		}
+
+		if def.Type != kValueTypeObject {
+			return fmt.Errorf("theme %s must be an object but got type %s", name, def.Type.GetName())
+		}
+		theme, err := parseThemeObject(def)
+		if err != nil {
+			return fmt.Errorf("theme %s, %v", name, err)
+		}
+		theme.Name = name
+		ThemeFactory[name] = theme
+		return nil
+	}
+
+	names := []string{}
+	for k := range v.Object.Value {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := register(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply the theme onto the plot
+func (t *Theme) Apply(p *plot.Plot) error {
+	font := func(size vg.Length) (vg.Font, error) {
+		f, err := vg.MakeFont(t.Font, size)
+		if err != nil {
+			return f, fmt.Errorf("theme font %s cannot be loaded, %v", t.Font, err)
+		}
+		return f, nil
+	}
+
+	var err error
+	p.BackgroundColor = t.Background
+
+	p.Title.Color = t.Foreground
+	if p.Title.Font, err = font(t.TitleSize); err != nil {
+		return err
+	}
+
+	for _, axis := range []*plot.Axis{&p.X, &p.Y} {
+		axis.Color = t.Foreground
+		axis.Label.Color = t.Foreground
+		if axis.Label.Font, err = font(t.LabelSize); err != nil {
+			return err
+		}
+		axis.Tick.Color = t.Foreground
+		axis.Tick.Label.Color = t.Foreground
+		if axis.Tick.Label.Font, err = font(t.TickSize); err != nil {
+			return err
+		}
+	}
+
+	p.Legend.TextStyle.Color = t.Foreground
+	if p.Legend.TextStyle.Font, err = font(t.LegendSize); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Color is the color of the idx-th series
+func (t *Theme) Color(idx int) color.Color {
+	return t.Palette[idx%len(t.Palette)]
+}
+
+// NewGrid creates grid lines in the style of the theme
+func (t *Theme) NewGrid() *plotter.Grid {
+	g := plotter.NewGrid()
+	g.Vertical = t.Grid
+	g.Horizontal = t.Grid
+	return g
+}
+
+func init() {
+	// the look gonum gives a plot out of the box
+	ThemeFactory["light"] = &Theme{
+		Name:       "light",
+		Background: color.White,
+		Foreground: color.Black,
+		Font:       "Times-Roman",
+		TitleSize:  vg.Points(12),
+		LabelSize:  vg.Points(12),
+		TickSize:   vg.Points(10),
+		LegendSize: vg.Points(12),
+		Grid:       draw.LineStyle{Color: color.Gray{Y: 128}, Width: vg.Points(0.25)},
+		Palette:    plotutil.SoftColors,
+		Legend:     kLegendBottomRight,
+	}
+
+	ThemeFactory["dark"] = &Theme{
+		Name:       "dark",
+		Background: rgb(30, 30, 34),
+		Foreground: rgb(220, 220, 220),
+		Font:       "Helvetica",
+		TitleSize:  vg.Points(12),
+		LabelSize:  vg.Points(11),
+		TickSize:   vg.Points(9),
+		LegendSize: vg.Points(10),
+		Grid:       draw.LineStyle{Color: rgb(70, 70, 78), Width: vg.Points(0.5)},
+		Palette: []color.Color{
+			rgb(76, 201, 240), rgb(247, 37, 133), rgb(181, 228, 140), rgb(255, 209, 102),
+			rgb(157, 78, 221), rgb(255, 159, 28), rgb(6, 214, 160),
+		},
+		Legend: kLegendTopRight,
+	}
+
+	// black text on white with darker colors which survive a laser printer
+	ThemeFactory["print"] = &Theme{
+		Name:       "print",
+		Background: color.White,
+		Foreground: color.Black,
+		Font:       "Times-Roman",
+		TitleSize:  vg.Points(11),
+		LabelSize:  vg.Points(10),
+		TickSize:   vg.Points(9),
+		LegendSize: vg.Points(9),
+		Grid: draw.LineStyle{
+			Color:  color.Gray{Y: 160},
+			Width:  vg.Points(0.25),
+			Dashes: []vg.Length{vg.Points(1), vg.Points(2)},
+		},
+		Palette: plotutil.DarkColors,
+		Legend:  kLegendTopRight,
+	}
+
+	ThemeFactory["high-contrast"] = &Theme{
+		Name:       "high-contrast",
+		Background: color.White,
+		Foreground: color.Black,
+		Font:       "Helvetica-Bold",
+		TitleSize:  vg.Points(16),
+		LabelSize:  vg.Points(14),
+		TickSize:   vg.Points(12),
+		LegendSize: vg.Points(12),
+		Grid:       draw.LineStyle{Color: color.Gray{Y: 96}, Width: vg.Points(0.75)},
+		Palette: []color.Color{
+			color.Black, rgb(220, 0, 0), rgb(0, 80, 255), rgb(0, 140, 0),
+			rgb(255, 140, 0), rgb(160, 0, 200),
+		},
+		Legend: kLegendTopRight,
+	}
+
+	// Okabe-Ito, told apart by every common kind of color blindness
+	ThemeFactory["colorblind"] = &Theme{
+		Name:       "colorblind",
+		Background: color.White,
+		Foreground: color.Black,
+		Font:       "Helvetica",
+		TitleSize:  vg.Points(12),
+		LabelSize:  vg.Points(11),
+		TickSize:   vg.Points(10),
+		LegendSize: vg.Points(10),
+		Grid:       draw.LineStyle{Color: color.Gray{Y: 200}, Width: vg.Points(0.5)},
+		Palette: []color.Color{
+			rgb(230, 159, 0), rgb(86, 180, 233), rgb(0, 158, 115), rgb(240, 228, 66),
+			rgb(0, 114, 178), rgb(213, 94, 0), rgb(204, 121, 167), color.Black,
+		},
+		Legend: kLegendTopRight,
+	}
+}
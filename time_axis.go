@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"gonum.org/v1/plot"
+	"math"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// Time axis lets the X values be timestamps. Internally a timestamp is the number of
+// seconds since the unix epoch, so the rest of the plotting code keeps dealing with
+// float64. A timestamp can be given as
+//
+//   - RFC 3339 string, the default for strings
+//   - unix seconds or milliseconds, "TimeFormat" set to "unix" or "unixms". Without
+//     "TimeFormat" a number is taken as milliseconds when it is too large to be seconds
+//   - a string in a custom layout declared by "TimeFormat" using Go's reference time
+//
+// Strings without a zone are read in "TimeZone", which is also where the ticks are
+// placed and labeled
+
+const (
+	kTimeFormatRFC3339 = "rfc3339"
+	kTimeFormatUnix    = "unix"
+	kTimeFormatUnixMs  = "unixms"
+
+	// numbers larger than this are treated as milliseconds, it is around year 5138
+	// in seconds
+	kUnixMsThreshold = 1e11
+)
+
+type TimeAxis struct {
+	Format   string
+	Location *time.Location
+}
+
+func parseTimeAxis(v Value) (*TimeAxis, error) {
+	isTime := false
+	axis := &TimeAxis{Location: time.UTC}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Type", "type"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Type\" field is not a string")
+		} else {
+			switch val {
+			case "time":
+				isTime = true
+			case "number":
+			default:
+				return nil, fmt.Errorf("\"Type\" %s is unknown, must be number or time", val)
+			}
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "TimeFormat", "timeformat"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"TimeFormat\" field is not a string")
+		} else {
+			isTime = true
+			axis.Format = val
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "TimeZone", "timezone"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"TimeZone\" field is not a string")
+		} else {
+			if loc, err := time.LoadLocation(val); err != nil {
+				return nil, fmt.Errorf("\"TimeZone\" %s is unknown, %v", val, err)
+			} else {
+				axis.Location = loc
+			}
+		}
+	}
+
+	if !isTime {
+		return nil, nil
+	}
+	return axis, nil
+}
+
+// Parse a timestamp into seconds since the unix epoch
+func (t *TimeAxis) Parse(v Value) (float64, error) {
+	switch v.Type {
+	case kValueTypeNumber:
+		switch strings.ToLower(t.Format) {
+		case kTimeFormatUnix:
+			return v.Number, nil
+		case kTimeFormatUnixMs:
+			return v.Number / 1000, nil
+		case "":
+			if math.Abs(v.Number) > kUnixMsThreshold {
+				return v.Number / 1000, nil
+			}
+			return v.Number, nil
+		default:
+			return 0, fmt.Errorf("timestamp %v is a number but \"TimeFormat\" is %s", v.Number, t.Format)
+		}
+
+	case kValueTypeString:
+		var ts time.Time
+		var err error
+
+		switch strings.ToLower(t.Format) {
+		case "", kTimeFormatRFC3339:
+			ts, err = time.ParseInLocation(time.RFC3339Nano, v.String, t.Location)
+		case kTimeFormatUnix, kTimeFormatUnixMs:
+			return 0, fmt.Errorf("timestamp %q is a string but \"TimeFormat\" is %s", v.String, t.Format)
+		default:
+			ts, err = time.ParseInLocation(t.Format, v.String, t.Location)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse timestamp %q, %v", v.String, err)
+		}
+		return float64(ts.UnixNano()) / 1e9, nil
+
+	default:
+		return 0, fmt.Errorf("timestamp must be a string or a number but got type %s", v.Type.GetName())
+	}
+}
+
+func (t *TimeAxis) toTime(x float64) time.Time {
+	sec, frac := math.Modf(x)
+	return time.Unix(int64(sec), int64(frac*1e9)).In(t.Location)
+}
+
+// one of the steps calendar ticks can be placed at
+type timeStep struct {
+	duration time.Duration
+	days     int
+	months   int
+	layout   string
+}
+
+var timeSteps = []timeStep{
+	{duration: time.Second, layout: "15:04:05"},
+	{duration: 5 * time.Second, layout: "15:04:05"},
+	{duration: 15 * time.Second, layout: "15:04:05"},
+	{duration: 30 * time.Second, layout: "15:04:05"},
+	{duration: time.Minute, layout: "15:04"},
+	{duration: 5 * time.Minute, layout: "15:04"},
+	{duration: 15 * time.Minute, layout: "15:04"},
+	{duration: 30 * time.Minute, layout: "15:04"},
+	{duration: time.Hour, layout: "Jan 02 15:04"},
+	{duration: 3 * time.Hour, layout: "Jan 02 15:04"},
+	{duration: 6 * time.Hour, layout: "Jan 02 15:04"},
+	{duration: 12 * time.Hour, layout: "Jan 02 15:04"},
+	{days: 1, layout: "Jan 02"},
+	{days: 2, layout: "Jan 02"},
+	{days: 7, layout: "Jan 02"},
+	{months: 1, layout: "2006-01"},
+	{months: 3, layout: "2006-01"},
+	{months: 6, layout: "2006-01"},
+	{months: 12, layout: "2006"},
+}
+
+// approximated length of the step, only used to pick a step
+func (s timeStep) approx() float64 {
+	switch {
+	case s.months != 0:
+		return float64(s.months) * 30.44 * 86400
+	case s.days != 0:
+		return float64(s.days) * 86400
+	default:
+		return s.duration.Seconds()
+	}
+}
+
+// first tick of the step at or after t
+func (s timeStep) first(t time.Time) time.Time {
+	y, m, d := t.Date()
+	loc := t.Location()
+
+	switch {
+	case s.months != 0:
+		months := (int(m) - 1) / s.months * s.months
+		ret := time.Date(y, time.Month(months+1), 1, 0, 0, 0, 0, loc)
+		for ret.Before(t) {
+			ret = ret.AddDate(0, s.months, 0)
+		}
+		return ret
+	case s.days != 0:
+		ret := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		if s.days == 7 {
+			// weeks start on monday
+			ret = ret.AddDate(0, 0, -((int(ret.Weekday()) + 6) % 7))
+		}
+		for ret.Before(t) {
+			ret = ret.AddDate(0, 0, s.days)
+		}
+		return ret
+	case s.duration >= time.Hour:
+		hours := int(s.duration / time.Hour)
+		ret := time.Date(y, m, d, t.Hour()/hours*hours, 0, 0, 0, loc)
+		for ret.Before(t) {
+			ret = s.next(ret)
+		}
+		return ret
+	default:
+		midnight := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		n := math.Ceil(float64(t.Sub(midnight)) / float64(s.duration))
+		return midnight.Add(time.Duration(n) * s.duration)
+	}
+}
+
+// next tick of the step after t. Hours go by the clock of the zone, so the ticks stay
+// on round hours across a change of daylight saving time
+func (s timeStep) next(t time.Time) time.Time {
+	switch {
+	case s.months != 0:
+		return t.AddDate(0, s.months, 0)
+	case s.days != 0:
+		return t.AddDate(0, 0, s.days)
+	case s.duration >= time.Hour:
+		y, m, d := t.Date()
+		return time.Date(y, m, d, t.Hour()+int(s.duration/time.Hour), 0, 0, 0, t.Location())
+	default:
+		return t.Add(s.duration)
+	}
+}
+
+// calendarTicks places ticks at round hours, days, months or years of the time zone
+// depending on how long the range is
+type calendarTicks struct {
+	Axis   *TimeAxis
+	Format string
+}
+
+const kMaxCalendarTicks = 8
+
+func (c calendarTicks) Ticks(min, max float64) []plot.Tick {
+	if math.IsInf(min, 0) || math.IsInf(max, 0) || min >= max {
+		return nil
+	}
+
+	step := timeSteps[len(timeSteps)-1]
+	for _, s := range timeSteps {
+		if (max-min)/s.approx() <= kMaxCalendarTicks {
+			step = s
+			break
+		}
+	}
+
+	// a range over a century with yearly ticks, let number ticks do the job
+	if (max-min)/step.approx() > kMaxCalendarTicks*10 {
+		return plot.DefaultTicks{}.Ticks(min, max)
+	}
+
+	layout := step.layout
+	if c.Format != "" {
+		layout = c.Format
+	}
+
+	ticks := []plot.Tick{}
+	end := c.Axis.toTime(max)
+	for t := step.first(c.Axis.toTime(min)); !t.After(end); t = step.next(t) {
+		ticks = append(ticks, plot.Tick{
+			Value: float64(t.UnixNano()) / 1e9,
+			Label: t.Format(layout),
+		})
+	}
+	return ticks
+}
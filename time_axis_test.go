@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mustParseTimeAxis reads the time axis of a test, the test fails when it is not one
+func mustParseTimeAxis(t *testing.T, text string) *TimeAxis {
+	t.Helper()
+	axis, err := parseTimeAxis(mustParseJson(t, text))
+	if err != nil || axis == nil {
+		t.Fatalf("time axis %s is invalid, %v", text, err)
+	}
+	return axis
+}
+
+func TestTimeAxisParse(t *testing.T) {
+	for _, c := range []struct {
+		axis  string
+		value string
+		want  float64
+	}{
+		{`{"Type": "time"}`, `"2024-03-01T12:00:00Z"`, 1709294400},
+		{`{"Type": "time"}`, `"2024-03-01T12:00:00.25Z"`, 1709294400.25},
+		{`{"Type": "time"}`, `"2024-03-01T14:00:00+02:00"`, 1709294400},
+		{`{"Type": "time"}`, `1709294400`, 1709294400},
+		{`{"Type": "time"}`, `1709294400500`, 1709294400.5},
+		{`{"TimeFormat": "unix"}`, `1709294400500`, 1709294400500},
+		{`{"TimeFormat": "unixms"}`, `1500`, 1.5},
+		{`{"TimeFormat": "RFC3339"}`, `"2024-03-01T12:00:00Z"`, 1709294400},
+		{`{"TimeFormat": "2006-01-02 15:04"}`, `"2024-03-01 12:00"`, 1709294400},
+		{`{"TimeFormat": "2006-01-02 15:04", "TimeZone": "Europe/Berlin"}`, `"2024-03-01 13:00"`, 1709294400},
+		{`{"TimeFormat": "2006-01-02 15:04", "TimeZone": "Europe/Berlin"}`, `"2024-07-01 14:00"`, 1719835200},
+		{`{"Type": "time", "TimeZone": "America/New_York"}`, `"2024-03-01T12:00:00Z"`, 1709294400},
+	} {
+		got, err := mustParseTimeAxis(t, c.axis).Parse(mustParseValue(t, c.value))
+		if err != nil {
+			t.Errorf("axis %s value %s failed, %v", c.axis, c.value, err)
+		} else if math.Abs(got-c.want) > 1e-6 {
+			t.Errorf("axis %s value %s got %v, want %v", c.axis, c.value, got, c.want)
+		}
+	}
+}
+
+func TestTimeAxisParseError(t *testing.T) {
+	for _, c := range []struct {
+		axis  string
+		value string
+		msg   string
+	}{
+		{`{"Type": "time"}`, `"2024-03-01"`, `cannot parse timestamp "2024-03-01"`},
+		{`{"Type": "time"}`, `true`, "timestamp must be a string or a number but got type boolean"},
+		{`{"TimeFormat": "unix"}`, `"1709294400"`, `timestamp "1709294400" is a string but "TimeFormat" is unix`},
+		{`{"TimeFormat": "2006-01-02"}`, `1709294400`,
+			`timestamp 1.7092944e+09 is a number but "TimeFormat" is 2006-01-02`},
+		{`{"TimeFormat": "2006-01-02"}`, `"01/03/2024"`, `cannot parse timestamp "01/03/2024"`},
+	} {
+		_, err := mustParseTimeAxis(t, c.axis).Parse(mustParseValue(t, c.value))
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("axis %s value %s got error %v, want %q", c.axis, c.value, err, c.msg)
+		}
+	}
+}
+
+func TestParseTimeAxis(t *testing.T) {
+	if axis, err := parseTimeAxis(mustParseJson(t, `{"Min": 3}`)); axis != nil || err != nil {
+		t.Errorf("axis without a time got %v %v, want none", axis, err)
+	}
+	axis, err := parseTimeAxis(mustParseJson(t, `{"Type": "number", "TimeZone": "UTC"}`))
+	if axis != nil || err != nil {
+		t.Errorf("number axis got %v %v, want none", axis, err)
+	}
+
+	for _, c := range []struct {
+		axis string
+		msg  string
+	}{
+		{`{"Type": "date"}`, `"Type" date is unknown, must be number or time`},
+		{`{"Type": 1}`, `"Type" field is not a string`},
+		{`{"TimeFormat": 1}`, `"TimeFormat" field is not a string`},
+		{`{"Type": "time", "TimeZone": "Mars/Olympus"}`, `"TimeZone" Mars/Olympus is unknown`},
+	} {
+		if _, err := parseTimeAxis(mustParseJson(t, c.axis)); err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("axis %s got error %v, want %q", c.axis, err, c.msg)
+		}
+	}
+}
+
+func TestCalendarTicks(t *testing.T) {
+	at := func(text string) float64 {
+		ts, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			t.Fatalf("time %s is invalid, %v", text, err)
+		}
+		return float64(ts.Unix())
+	}
+
+	for _, c := range []struct {
+		axis     string
+		min, max string
+		format   string
+		want     string
+	}{
+		{`{"Type": "time"}`, "2024-03-01T12:00:10Z", "2024-03-01T12:00:40Z", "",
+			"12:00:10 12:00:15 12:00:20 12:00:25 12:00:30 12:00:35 12:00:40"},
+		{`{"Type": "time"}`, "2024-03-01T09:10:00Z", "2024-03-01T11:00:00Z", "",
+			"09:15 09:30 09:45 10:00 10:15 10:30 10:45 11:00"},
+		{`{"Type": "time"}`, "2024-03-01T01:00:00Z", "2024-03-02T00:00:00Z", "",
+			"Mar 01 03:00 Mar 01 06:00 Mar 01 09:00 Mar 01 12:00 Mar 01 15:00 Mar 01 18:00 Mar 01 21:00 " +
+				"Mar 02 00:00"},
+		{`{"Type": "time"}`, "2024-02-27T00:00:00Z", "2024-03-03T00:00:00Z", "",
+			"Feb 27 Feb 28 Feb 29 Mar 01 Mar 02 Mar 03"},
+		{`{"Type": "time"}`, "2024-03-01T00:00:00Z", "2024-04-10T00:00:00Z", "",
+			"Mar 04 Mar 11 Mar 18 Mar 25 Apr 01 Apr 08"},
+		{`{"Type": "time"}`, "2023-11-15T00:00:00Z", "2024-04-15T00:00:00Z", "",
+			"2023-12 2024-01 2024-02 2024-03 2024-04"},
+		{`{"Type": "time"}`, "2023-01-15T00:00:00Z", "2024-12-15T00:00:00Z", "",
+			"2023-04 2023-07 2023-10 2024-01 2024-04 2024-07 2024-10"},
+		{`{"Type": "time"}`, "2019-06-01T00:00:00Z", "2024-06-01T00:00:00Z", "",
+			"2020 2021 2022 2023 2024"},
+		{`{"Type": "time"}`, "2024-03-01T00:00:00Z", "2024-03-07T00:00:00Z", "Mon 2",
+			"Fri 1 Sat 2 Sun 3 Mon 4 Tue 5 Wed 6 Thu 7"},
+		// the hours of the zone, which has a day of 23 hours when the clocks change
+		{`{"Type": "time", "TimeZone": "Europe/Berlin"}`, "2024-03-30T12:00:00Z", "2024-04-01T12:00:00Z",
+			"02 15:04 -07",
+			"30 18:00 +01 31 00:00 +01 31 06:00 +02 31 12:00 +02 31 18:00 +02 01 00:00 +02 01 06:00 +02 01 12:00 +02"},
+	} {
+		axis := mustParseTimeAxis(t, c.axis)
+		got := []string{}
+		for _, tick := range (calendarTicks{Axis: axis, Format: c.format}).Ticks(at(c.min), at(c.max)) {
+			got = append(got, tick.Label)
+		}
+		if strings.Join(got, " ") != c.want {
+			t.Errorf("axis %s from %s to %s got ticks %s, want %s", c.axis, c.min, c.max, strings.Join(got, " "),
+				c.want)
+		}
+	}
+
+	axis := mustParseTimeAxis(t, `{"Type": "time"}`)
+	if ticks := (calendarTicks{Axis: axis}).Ticks(10, 10); ticks != nil {
+		t.Errorf("an empty range got ticks %v, want none", ticks)
+	}
+}
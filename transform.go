@@ -0,0 +1,667 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Transform is the "Transform" list of a job, a pipeline of steps applied to the
+// "Data" of the config before the plotter sees it. Each step is an object with one
+// of the keys below and works on a list, either of records or of plain numbers
+// where "@" stands for the number itself. When the data is an object of series the
+// steps are applied to every series on its own
+//
+//	{"Filter": "@.ok == true && @.ms < 1000"}        same syntax as query filters
+//	{"Derive": {"s": "ms / 1000"}}                    new fields from expressions
+//	{"GroupBy": "region", "Aggregate": {"p99": "p99(ms)", "n": "count()"}}
+//	{"Sort": "-p99"}                                  "-" sorts descending
+//	{"Top": 5}                                        keeps the first 5
+//	{"Pivot": {"Index": "ts", "Columns": "region", "Values": "ms"}}
+//	{"Select": "ms"}                                  a list of the field values
+//	{"Series": {"X": "ts", "Y": "ms", "GroupBy": "region"}}
+//
+// "Series" turns records into the series the plotters take, the same way data
+// sources pick fields out of json records
+type Transform struct {
+	steps []transformStep
+}
+
+type transformStep interface {
+	apply(list []Value) (Value, error)
+}
+
+type filterStep struct {
+	filter *queryFilter
+}
+
+type deriveStep struct {
+	names []string
+	exprs []*Expr
+}
+
+type groupStep struct {
+	keys []string
+	aggs []*aggregate
+}
+
+type sortKey struct {
+	path string
+	desc bool
+}
+
+type sortStep struct {
+	keys []sortKey
+}
+
+type topStep struct {
+	n int
+}
+
+type pivotStep struct {
+	index   string
+	columns string
+	values  string
+	agg     *aggregate
+}
+
+type selectStep struct {
+	path string
+}
+
+type seriesStep struct {
+	fields *recordFields
+}
+
+// aggregate is a reduction of a field over a group of records, ie "p99(ms)"
+type aggregate struct {
+	name  string
+	op    string
+	field string
+
+	// percentile of the "pNN" op
+	p float64
+}
+
+func listValue(list []Value) Value {
+	l := NewList()
+	l.Value = list
+	return Value{Type: kValueTypeList, List: l}
+}
+
+func stringList(v Value, name string) ([]string, error) {
+	switch v.Type {
+	case kValueTypeString:
+		return []string{v.String}, nil
+	case kValueTypeList:
+		ret := []string{}
+		for _, x := range v.List.Value {
+			if x.Type != kValueTypeString {
+				return nil, fmt.Errorf("\"%s\" field must be a string or a list of strings", name)
+			}
+			ret = append(ret, x.String)
+		}
+		return ret, nil
+	default:
+		return nil, fmt.Errorf("\"%s\" field must be a string or a list of strings", name)
+	}
+}
+
+func ParseTransform(v Value) (*Transform, error) {
+	if v.Type != kValueTypeList {
+		return nil, fmt.Errorf("value is not type list but type %s", v.Type.GetName())
+	}
+
+	t := &Transform{}
+	for idx, x := range v.List.Value {
+		step, err := parseTransformStep(x)
+		if err != nil {
+			return nil, fmt.Errorf("step %d, %v", idx, err)
+		}
+		t.steps = append(t.steps, step)
+	}
+	return t, nil
+}
+
+func parseTransformStep(v Value) (transformStep, error) {
+	if v.Type != kValueTypeObject {
+		return nil, fmt.Errorf("step must be an object but got type %s", v.Type.GetName())
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Filter", "filter"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Filter\" field is not a string")
+		} else {
+			f, err := CompileFilter(val)
+			if err != nil {
+				return nil, err
+			}
+			return &filterStep{filter: f}, nil
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Derive", "derive"); err == nil {
+		if t.Type != kValueTypeObject {
+			return nil, fmt.Errorf("\"Derive\" field must be an object of expressions")
+		}
+		step := &deriveStep{}
+		for name := range t.Object.Value {
+			step.names = append(step.names, name)
+		}
+		sort.Strings(step.names)
+
+		for _, name := range step.names {
+			if val, err := JsonGetString(t.Object.Value[name]); err != nil {
+				return nil, fmt.Errorf("\"Derive\" field %s is not a string", name)
+			} else {
+				e, err := CompileExpr(val)
+				if err != nil {
+					return nil, fmt.Errorf("\"Derive\" field %s, %v", name, err)
+				}
+				step.exprs = append(step.exprs, e)
+			}
+		}
+		return step, nil
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "GroupBy", "groupby"); err == nil {
+		step := &groupStep{}
+		if step.keys, err = stringList(t, "GroupBy"); err != nil {
+			return nil, err
+		}
+
+		if t, err := JsonObjectGetMultipleKey(v, "Aggregate", "aggregate"); err != nil {
+			return nil, fmt.Errorf("\"GroupBy\" needs an \"Aggregate\" field")
+		} else {
+			if t.Type != kValueTypeObject {
+				return nil, fmt.Errorf("\"Aggregate\" field must be an object of aggregations")
+			}
+			names := []string{}
+			for name := range t.Object.Value {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				if val, err := JsonGetString(t.Object.Value[name]); err != nil {
+					return nil, fmt.Errorf("\"Aggregate\" field %s is not a string", name)
+				} else {
+					agg, err := parseAggregate(name, val)
+					if err != nil {
+						return nil, fmt.Errorf("\"Aggregate\" field %s, %v", name, err)
+					}
+					step.aggs = append(step.aggs, agg)
+				}
+			}
+		}
+		return step, nil
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Sort", "sort"); err == nil {
+		keys, err := stringList(t, "Sort")
+		if err != nil {
+			return nil, err
+		}
+		step := &sortStep{}
+		for _, k := range keys {
+			if strings.HasPrefix(k, "-") {
+				step.keys = append(step.keys, sortKey{path: k[1:], desc: true})
+			} else {
+				step.keys = append(step.keys, sortKey{path: strings.TrimPrefix(k, "+")})
+			}
+		}
+		return step, nil
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Top", "top"); err == nil {
+		if val, err := JsonGetNumber(t); err != nil || val < 0 || val != math.Floor(val) {
+			return nil, fmt.Errorf("\"Top\" field must be a non negative integer")
+		} else {
+			return &topStep{n: int(val)}, nil
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Pivot", "pivot"); err == nil {
+		return parsePivot(t)
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Select", "select"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Select\" field is not a string")
+		} else {
+			return &selectStep{path: val}, nil
+		}
+	}
+
+	if t, err := JsonObjectGetMultipleKey(v, "Series", "series"); err == nil {
+		if t.Type != kValueTypeObject {
+			return nil, fmt.Errorf("\"Series\" field must be an object")
+		}
+		fields, err := parseRecordFields(t)
+		if err != nil {
+			return nil, fmt.Errorf("\"Series\" field is invalid, %v", err)
+		}
+		if fields == nil {
+			return nil, fmt.Errorf("\"Series\" field needs a \"Y\"")
+		}
+		return &seriesStep{fields: fields}, nil
+	}
+
+	return nil, fmt.Errorf("step is unknown, it must have one of Filter, Derive, GroupBy, Sort, Top, " +
+		"Pivot, Select or Series")
+}
+
+func parsePivot(v Value) (transformStep, error) {
+	if v.Type != kValueTypeObject {
+		return nil, fmt.Errorf("\"Pivot\" field must be an object")
+	}
+
+	step := &pivotStep{}
+	for _, x := range []struct {
+		key string
+		ptr *string
+	}{
+		{"Index", &step.index},
+		{"Columns", &step.columns},
+		{"Values", &step.values},
+	} {
+		if t, err := JsonObjectGetMultipleKey(v, x.key, strings.ToLower(x.key)); err != nil {
+			return nil, fmt.Errorf("\"Pivot\" needs a \"%s\" field", x.key)
+		} else {
+			if val, err := JsonGetString(t); err != nil {
+				return nil, fmt.Errorf("\"Pivot\" \"%s\" field is not a string", x.key)
+			} else {
+				*x.ptr = val
+			}
+		}
+	}
+
+	op := "mean"
+	if t, err := JsonObjectGetMultipleKey(v, "Aggregate", "aggregate"); err == nil {
+		if val, err := JsonGetString(t); err != nil {
+			return nil, fmt.Errorf("\"Pivot\" \"Aggregate\" field is not a string")
+		} else {
+			op = val
+		}
+	}
+
+	agg, err := parseAggregate("", op+"("+step.values+")")
+	if err != nil {
+		return nil, fmt.Errorf("\"Pivot\" %v", err)
+	}
+	step.agg = agg
+	return step, nil
+}
+
+// parseAggregate reads "op(field)", count can go without a field
+func parseAggregate(name, text string) (*aggregate, error) {
+	agg := &aggregate{name: name}
+
+	text = strings.TrimSpace(text)
+	open := strings.Index(text, "(")
+	if open < 0 {
+		agg.op = text
+	} else {
+		if !strings.HasSuffix(text, ")") {
+			return nil, fmt.Errorf("aggregation %q must look like op(field)", text)
+		}
+		agg.op = strings.TrimSpace(text[:open])
+		agg.field = strings.TrimSpace(text[open+1 : len(text)-1])
+	}
+
+	if err := agg.parseOp(); err != nil {
+		return nil, err
+	}
+
+	if agg.field == "" && agg.op != "count" {
+		return nil, fmt.Errorf("aggregation %s needs a field, ie %s(@)", agg.op, agg.op)
+	}
+	return agg, nil
+}
+
+// parseOp checks the name of the aggregation and reads the percentile out of it
+func (a *aggregate) parseOp() error {
+	switch a.op {
+	case "count":
+	case "sum", "mean", "avg", "min", "max", "median", "stddev":
+	default:
+		if !strings.HasPrefix(a.op, "p") {
+			return fmt.Errorf("aggregation %s is unknown, must be count, sum, mean, min, max, median, "+
+				"stddev or a percentile like p99", a.op)
+		}
+		p, err := strconv.ParseFloat(a.op[1:], 64)
+		if err != nil || p < 0 || p > 100 {
+			return fmt.Errorf("percentile %s must be between p0 and p100", a.op)
+		}
+		a.p = p
+	}
+	return nil
+}
+
+// apply the aggregation on the records, non numeric values are ignored
+func (a *aggregate) apply(records []Value) Value {
+	if a.op == "count" && a.field == "" {
+		return Value{Type: kValueTypeNumber, Number: float64(len(records))}
+	}
+
+	xs := []float64{}
+	for _, r := range records {
+		if v, err := fieldValue(r, a.field); err == nil && v.Type == kValueTypeNumber {
+			xs = append(xs, v.Number)
+		}
+	}
+
+	ret := a.reduce(xs)
+	if math.IsNaN(ret) {
+		return NewNull()
+	}
+	return Value{Type: kValueTypeNumber, Number: ret}
+}
+
+// reduce the numbers into the aggregated one
+func (a *aggregate) reduce(xs []float64) float64 {
+	switch a.op {
+	case "count":
+		return float64(len(xs))
+	case "sum":
+		return statSum(xs)
+	case "mean", "avg":
+		return statMean(xs)
+	case "min":
+		return statMin(xs)
+	case "max":
+		return statMax(xs)
+	case "median":
+		return statPercentile(xs, 50)
+	case "stddev":
+		return statStdDev(xs)
+	default:
+		return statPercentile(xs, a.p)
+	}
+}
+
+func (s *filterStep) apply(list []Value) (Value, error) {
+	ret := []Value{}
+	for _, x := range list {
+		if s.filter.match(x) {
+			ret = append(ret, x)
+		}
+	}
+	return listValue(ret), nil
+}
+
+func (s *deriveStep) apply(list []Value) (Value, error) {
+	ret := []Value{}
+	for idx, x := range list {
+		if x.Type != kValueTypeObject {
+			return NewNull(), fmt.Errorf("\"Derive\" needs records but element %d is type %s", idx, x.Type.GetName())
+		}
+
+		rec := NewObject()
+		for k, v := range x.Object.Value {
+			rec.Value[k] = v
+		}
+		for i, name := range s.names {
+			val, err := s.exprs[i].Eval(x)
+			if err != nil {
+				return NewNull(), fmt.Errorf("\"Derive\" field %s of element %d, %v", name, idx, err)
+			}
+			rec.Value[name] = Value{Type: kValueTypeNumber, Number: val}
+		}
+		ret = append(ret, Value{Type: kValueTypeObject, Object: rec})
+	}
+	return listValue(ret), nil
+}
+
+// groupKey is a printable key of the value used to find its group
+func groupKey(v Value) string {
+	if v.Type == kValueTypeString {
+		return v.String
+	}
+	return strings.TrimSpace(v.ToJson())
+}
+
+// the name of the output field for a path, the last segment of it
+func fieldName(path string) string {
+	if idx := strings.LastIndex(path, "."); idx >= 0 {
+		return path[idx+1:]
+	}
+	return path
+}
+
+func (s *groupStep) apply(list []Value) (Value, error) {
+	type group struct {
+		keys    []Value
+		records []Value
+	}
+
+	groups := map[string]*group{}
+	order := []string{}
+
+	for _, x := range list {
+		keys := []Value{}
+		parts := []string{}
+		for _, k := range s.keys {
+			v, err := fieldValue(x, k)
+			if err != nil {
+				v = NewNull()
+			}
+			keys = append(keys, v)
+			parts = append(parts, groupKey(v))
+		}
+
+		id := strings.Join(parts, "\x00")
+		g, ok := groups[id]
+		if !ok {
+			g = &group{keys: keys}
+			groups[id] = g
+			order = append(order, id)
+		}
+		g.records = append(g.records, x)
+	}
+
+	ret := []Value{}
+	for _, id := range order {
+		g := groups[id]
+		rec := NewObject()
+		for idx, k := range s.keys {
+			rec.Value[fieldName(k)] = g.keys[idx]
+		}
+		for _, agg := range s.aggs {
+			rec.Value[agg.name] = agg.apply(g.records)
+		}
+		ret = append(ret, Value{Type: kValueTypeObject, Object: rec})
+	}
+	return listValue(ret), nil
+}
+
+// compareValues orders numbers before strings and missing values last
+func compareValues(a, b Value, aok, bok bool) int {
+	switch {
+	case !aok && !bok:
+		return 0
+	case !aok:
+		return 1
+	case !bok:
+		return -1
+	}
+
+	rank := func(v Value) int {
+		switch v.Type {
+		case kValueTypeNumber:
+			return 0
+		case kValueTypeString:
+			return 1
+		case kValueTypeBoolean:
+			return 2
+		default:
+			return 3
+		}
+	}
+
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch a.Type {
+	case kValueTypeNumber:
+		switch {
+		case a.Number < b.Number:
+			return -1
+		case a.Number > b.Number:
+			return 1
+		}
+	case kValueTypeString:
+		return strings.Compare(a.String, b.String)
+	case kValueTypeBoolean:
+		if a.Boolean != b.Boolean {
+			if a.Boolean {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func (s *sortStep) apply(list []Value) (Value, error) {
+	ret := make([]Value, len(list))
+	copy(ret, list)
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		for _, k := range s.keys {
+			a, aerr := fieldValue(ret[i], k.path)
+			b, berr := fieldValue(ret[j], k.path)
+			aok := aerr == nil && a.Type != kValueTypeNull
+			bok := berr == nil && b.Type != kValueTypeNull
+
+			c := compareValues(a, b, aok, bok)
+			// missing values stay last in both directions
+			if k.desc && aok && bok {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return listValue(ret), nil
+}
+
+func (s *topStep) apply(list []Value) (Value, error) {
+	if len(list) > s.n {
+		list = list[:s.n]
+	}
+	ret := make([]Value, len(list))
+	copy(ret, list)
+	return listValue(ret), nil
+}
+
+func (s *pivotStep) apply(list []Value) (Value, error) {
+	type row struct {
+		index Value
+		cells map[string][]Value
+	}
+
+	rows := map[string]*row{}
+	order := []string{}
+
+	for _, x := range list {
+		idx, err := fieldValue(x, s.index)
+		if err != nil {
+			continue
+		}
+		col, err := fieldValue(x, s.columns)
+		if err != nil {
+			continue
+		}
+
+		id := groupKey(idx)
+		r, ok := rows[id]
+		if !ok {
+			r = &row{index: idx, cells: map[string][]Value{}}
+			rows[id] = r
+			order = append(order, id)
+		}
+		name := groupKey(col)
+		r.cells[name] = append(r.cells[name], x)
+	}
+
+	ret := []Value{}
+	for _, id := range order {
+		r := rows[id]
+		rec := NewObject()
+		rec.Value[fieldName(s.index)] = r.index
+		for name, records := range r.cells {
+			rec.Value[name] = s.agg.apply(records)
+		}
+		ret = append(ret, Value{Type: kValueTypeObject, Object: rec})
+	}
+	return listValue(ret), nil
+}
+
+func (s *selectStep) apply(list []Value) (Value, error) {
+	ret := []Value{}
+	for _, x := range list {
+		if v, err := fieldValue(x, s.path); err == nil && v.Type != kValueTypeNull {
+			ret = append(ret, v)
+		}
+	}
+	return listValue(ret), nil
+}
+
+func (s *seriesStep) apply(list []Value) (Value, error) {
+	series := s.fields.newSeries()
+	for _, x := range list {
+		series.add(x)
+	}
+	return series.value(), nil
+}
+
+// applyStep runs the step on a list, or on every list of an object of series
+func applyStep(step transformStep, v Value) (Value, error) {
+	switch v.Type {
+	case kValueTypeList:
+		return step.apply(v.List.Value)
+
+	case kValueTypeObject:
+		names := []string{}
+		for name := range v.Object.Value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		ret := NewObject()
+		for _, name := range names {
+			x := v.Object.Value[name]
+			if x.Type != kValueTypeList {
+				return NewNull(), fmt.Errorf("series %s must be a list but got type %s", name, x.Type.GetName())
+			}
+			val, err := step.apply(x.List.Value)
+			if err != nil {
+				return NewNull(), fmt.Errorf("series %s, %v", name, err)
+			}
+			ret.Value[name] = val
+		}
+		return Value{Type: kValueTypeObject, Object: ret}, nil
+
+	default:
+		return NewNull(), fmt.Errorf("data must be a list or an object of lists but got type %s", v.Type.GetName())
+	}
+}
+
+// Apply runs the pipeline on the data
+func (t *Transform) Apply(data Value) (Value, error) {
+	cur := data
+	for idx, step := range t.steps {
+		next, err := applyStep(step, cur)
+		if err != nil {
+			return NewNull(), fmt.Errorf("step %d, %v", idx, err)
+		}
+		cur = next
+	}
+	return cur, nil
+}
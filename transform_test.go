@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const kTransformTestData = `[
+    {"r": "eu", "ms": 100, "ok": true},
+    {"r": "us", "ms": 300, "ok": true},
+    {"r": "eu", "ms": 200, "ok": false},
+    {"r": "us", "ms": 50, "ok": true}
+]`
+
+// mustParseTransform parses the steps of a test, the test fails when they are invalid
+func mustParseTransform(t *testing.T, text string) *Transform {
+	t.Helper()
+	tr, err := ParseTransform(mustParseJson(t, text))
+	if err != nil {
+		t.Fatalf("transform %s is invalid, %v", text, err)
+	}
+	return tr
+}
+
+func TestTransformApply(t *testing.T) {
+	for _, c := range []struct {
+		data  string
+		steps string
+		want  string
+	}{
+		{kTransformTestData, `[{"Filter": "@.ok == true"}, {"Select": "ms"}]`, `[100, 300, 50]`},
+		{kTransformTestData, `[{"Derive": {"s": "ms / 100"}}, {"Select": "s"}]`, `[1, 3, 2, 0.5]`},
+		{kTransformTestData, `[{"GroupBy": "r", "Aggregate": {"n": "count()", "top": "max(ms)", "sum": "sum(ms)"}}]`,
+			`[{"r": "eu", "n": 2, "top": 200, "sum": 300}, {"r": "us", "n": 2, "top": 300, "sum": 350}]`},
+		{kTransformTestData, `[{"GroupBy": ["r", "ok"], "Aggregate": {"n": "count"}}, {"Select": "n"}]`, `[1, 2, 1]`},
+		{kTransformTestData, `[{"Sort": "-ms"}, {"Top": 2}, {"Select": "r"}]`, `["us", "eu"]`},
+		{kTransformTestData, `[{"Sort": ["r", "ms"]}, {"Select": "ms"}]`, `[100, 200, 50, 300]`},
+		{kTransformTestData, `[{"Top": 0}]`, `[]`},
+		{kTransformTestData, `[{"Pivot": {"Index": "ok", "Columns": "r", "Values": "ms"}}]`,
+			`[{"ok": true, "eu": 100, "us": 175}, {"ok": false, "eu": 200}]`},
+		{kTransformTestData, `[{"Pivot": {"Index": "r", "Columns": "ok", "Values": "ms", "Aggregate": "count"}}]`,
+			`[{"r": "eu", "true": 1, "false": 1}, {"r": "us", "true": 2}]`},
+		{`{"a": [3, 1, 2], "b": [5, 4]}`, `[{"Sort": "@"}]`, `{"a": [1, 2, 3], "b": [4, 5]}`},
+		{`{"a": [3, 1, 2], "b": [5, 4]}`, `[{"Filter": "@ >= 2"}]`, `{"a": [3, 2], "b": [5, 4]}`},
+		{`[1, 2, 3, 4]`, `[{"Sort": "-@"}, {"Top": 3}, {"Filter": "@ != 3"}]`, `[4, 2]`},
+	} {
+		got, err := mustParseTransform(t, c.steps).Apply(mustParseJson(t, c.data))
+		if err != nil {
+			t.Errorf("transform %s failed, %v", c.steps, err)
+			continue
+		}
+		want := mustParseJson(t, c.want)
+		if !sameJson(got, want) {
+			t.Errorf("transform %s got %s, want %s", c.steps, got.ToJson(), want.ToJson())
+		}
+	}
+}
+
+func TestParseTransformError(t *testing.T) {
+	for _, c := range []struct {
+		steps string
+		msg   string
+	}{
+		{`{"Filter": "@.ok"}`, "value is not type list but type object"},
+		{`[1]`, "step 0, step must be an object but got type number"},
+		{`[{"Bogus": 1}]`, "step 0, step is unknown"},
+		{`[{"Top": -1}]`, `step 0, "Top" field must be a non negative integer`},
+		{`[{"Top": 1.5}]`, `step 0, "Top" field must be a non negative integer`},
+		{`[{"Filter": "@.ok =="}]`, `step 0, query "@.ok ==" around 7, expect a number`},
+		{`[{"Filter": "@.ok == true )"}]`, `step 0, query "@.ok == true )" around 13, unexpected character ')'`},
+		{`[{"Derive": {"s": "ms +"}}]`, `step 0, "Derive" field s, expression "ms +" around 4, expression ends unexpectedly`},
+		{`[{"Derive": {"s": 1}}]`, `step 0, "Derive" field s is not a string`},
+		{`[{"Sort": "ms"}, {"GroupBy": "r"}]`, `step 1, "GroupBy" needs an "Aggregate" field`},
+		{`[{"GroupBy": "r", "Aggregate": {"x": "p101(ms)"}}]`, "percentile p101 must be between p0 and p100"},
+		{`[{"GroupBy": "r", "Aggregate": {"x": "sum"}}]`, "aggregation sum needs a field"},
+		{`[{"GroupBy": "r", "Aggregate": {"x": "mode(ms)"}}]`, "aggregation mode is unknown"},
+		{`[{"GroupBy": "r", "Aggregate": {"x": "sum(ms"}}]`, `aggregation "sum(ms" must look like op(field)`},
+		{`[{"Pivot": {"Index": "a"}}]`, `"Pivot" needs a "Columns" field`},
+		{`[{"Series": {"X": "ts"}}]`, `"Series" field needs a "Y"`},
+	} {
+		_, err := ParseTransform(mustParseJson(t, c.steps))
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("transform %s got error %v, want %q", c.steps, err, c.msg)
+		}
+	}
+}
+
+func TestTransformApplyError(t *testing.T) {
+	for _, c := range []struct {
+		data  string
+		steps string
+		msg   string
+	}{
+		{`[1, 2]`, `[{"Derive": {"s": "@ * 2"}}]`, `step 0, "Derive" needs records but element 0 is type number`},
+		{kTransformTestData, `[{"Derive": {"s": "r * 2"}}]`,
+			`step 0, "Derive" field s of element 0, field r is not a number but type string`},
+		{`{"a": [1], "b": 2}`, `[{"Top": 1}]`, "step 0, series b must be a list but got type number"},
+		{`{"a": [{"x": 1}]}`, `[{"Top": 1}, {"Derive": {"y": "z"}}]`, `step 1, series a, "Derive" field y of element 0`},
+	} {
+		_, err := mustParseTransform(t, c.steps).Apply(mustParseJson(t, c.data))
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("transform %s got error %v, want %q", c.steps, err, c.msg)
+		}
+	}
+}
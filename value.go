@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strconv"
 )
 
@@ -25,6 +26,10 @@ type Value struct {
 	Boolean bool
 	Object  *Object
 	List    *List
+
+	// where a string starts in the source, 0 when it is not parsed from text
+	Line   int
+	Column int
 }
 
 type Object struct {
@@ -95,24 +100,38 @@ func (v *Value) toJson(b *bytes.Buffer, indent int) {
 }
 
 func (obj *Object) toJson(b *bytes.Buffer, idt int) {
+	if len(obj.Value) == 0 {
+		b.WriteString("{}")
+		return
+	}
 	b.WriteString("{\n")
 
-	idx := 0
-	for k, v := range obj.Value {
+	// sorted so the same object is always written the same way
+	keys := []string{}
+	for k := range obj.Value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for idx, k := range keys {
+		v := obj.Value[k]
 		indent(b, idt+1).WriteString(PrintQuotedString(k))
 		b.WriteString(" : ")
 		v.toJson(b, idt+1)
-		if idx < len(obj.Value)-1 {
+		if idx < len(keys)-1 {
 			b.WriteString(",")
 		}
 		b.WriteString("\n")
-		idx++
 	}
 
 	indent(b, idt).WriteString("}")
 }
 
 func (l *List) toJson(b *bytes.Buffer, idt int) {
+	if len(l.Value) == 0 {
+		b.WriteString("[]")
+		return
+	}
 	b.WriteString("[\n")
 
 	idx := 0
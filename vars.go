@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Variables are written as ${name} in any string of the document, files pulled in by
+// "Include" included. They are defined by the "Vars" object of the document and by
+// -set name=value on the command line, which wins over "Vars". ${env:NAME} is the
+// environment variable NAME:
+//
+//	{
+//	    "Vars": {"build": "dev", "out": "out/${build}"},
+//	    "Jobs": [{"Type": "dot-plotter", "Path": "${out}/latency.png",
+//	              "Config": {"Title": "Latency of ${build} on ${env:HOSTNAME}", ...}}]
+//	}
+//
+// A string which is nothing but one variable becomes the value of the variable, so a
+// number stays a number. -set gives a string, unless the variable is a number or a
+// boolean in "Vars" or the type is written after the name, ie -set width:number=6
+// and -set grids:boolean=true. A variable inside of a longer string must be a string,
+// a number or a boolean. "$${" writes "${" as is. Using a variable which is not
+// defined is an error pointing at where it is used.
+//
+// ${item} and ${index} are the variables of "ForEach". They are left alone when the
+// document is expanded, together with "$${", and replaced once the jobs are expanded
+
+const kEnvVarPrefix = "env:"
+
+// varScope resolves the variables, a variable can use other ones in its definition
+type varScope struct {
+	defs     map[string]Value
+	resolved map[string]Value
+	visiting map[string]bool
+
+	// the text of -set for the variables it turned into a number or a boolean, which
+	// is what goes into a longer string so "0123" is not written as "123"
+	texts map[string]string
+
+	// the variables of the document are replaced first, this leaves the variables of
+	// "ForEach" and "$${" to the scope of the job
+	deferLoop bool
+
+	// the item of "ForEach" and its index, nil for a job without "ForEach"
+	item  *Value
+	index int
+}
+
+// isLoopVar tells the variables of "ForEach" apart from the ones of the document
+func isLoopVar(name string) bool {
+	return name == "item" || name == "index" || strings.HasPrefix(name, "item.")
+}
+
+// newVarScope collects the "Vars" of the document and the overrides of the command line
+func newVarScope(root Value, overrides map[string]string) (*varScope, error) {
+	s := &varScope{
+		defs:      map[string]Value{},
+		resolved:  map[string]Value{},
+		visiting:  map[string]bool{},
+		texts:     map[string]string{},
+		deferLoop: true,
+	}
+
+	if v, err := JsonObjectGetMultipleKey(root, "Vars", "vars"); err == nil {
+		if v.Type != kValueTypeObject {
+			return nil, fmt.Errorf("\"Vars\" field must be an object but got type %s", v.Type.GetName())
+		}
+		for k, x := range v.Object.Value {
+			if strings.HasPrefix(k, kEnvVarPrefix) {
+				return nil, fmt.Errorf("\"Vars\" %s cannot be defined, %s is for the environment", k, kEnvVarPrefix)
+			}
+			if isLoopVar(k) {
+				return nil, fmt.Errorf("\"Vars\" %s cannot be defined, it is the variable of \"ForEach\"", k)
+			}
+			s.defs[k] = x
+		}
+	}
+
+	names := []string{}
+	for k := range overrides {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		name, kind := k, ""
+		if idx := strings.LastIndex(k, ":"); idx > 0 && !strings.HasPrefix(k, kEnvVarPrefix) {
+			name, kind = k[:idx], k[idx+1:]
+		}
+		if isLoopVar(name) {
+			return nil, fmt.Errorf("variable %s cannot be set, it is the variable of \"ForEach\"", name)
+		}
+
+		def, hasDef := s.defs[name]
+		if kind == "" && hasDef {
+			// the type of "Vars" is kept, a number stays a number
+			switch def.Type {
+			case kValueTypeNumber:
+				kind = "number"
+			case kValueTypeBoolean:
+				kind = "boolean"
+			}
+		}
+
+		x, err := parseVarOverride(overrides[k], kind)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s cannot be set, %v", name, err)
+		}
+		s.defs[name] = x
+		if x.Type != kValueTypeString {
+			s.texts[name] = overrides[k]
+		}
+	}
+	return s, nil
+}
+
+// newLoopScope replaces the variables of "ForEach" in a job, item is nil for a job
+// without "ForEach"
+func newLoopScope(item *Value, index int) *varScope {
+	return &varScope{
+		defs:     map[string]Value{},
+		resolved: map[string]Value{},
+		visiting: map[string]bool{},
+		texts:    map[string]string{},
+		item:     item,
+		index:    index,
+	}
+}
+
+// lookupLoop finds the variables of "ForEach", a path after "item." goes into the
+// item. A string item, ie a file of a glob, has "name", "stem" and "dir" as well
+func (s *varScope) lookupLoop(name string) (Value, error) {
+	if s.item == nil {
+		return NewNull(), fmt.Errorf("variable %s is only defined in a job with \"ForEach\"", name)
+	}
+
+	switch name {
+	case "item":
+		return *s.item, nil
+	case "index":
+		return Value{Type: kValueTypeNumber, Number: float64(s.index)}, nil
+	}
+
+	path := strings.TrimPrefix(name, "item.")
+	if s.item.Type == kValueTypeString {
+		file := s.item.String
+		switch path {
+		case "name":
+			return Value{Type: kValueTypeString, String: filepath.Base(file)}, nil
+		case "stem":
+			base := filepath.Base(file)
+			return Value{Type: kValueTypeString, String: strings.TrimSuffix(base, filepath.Ext(base))}, nil
+		case "dir":
+			return Value{Type: kValueTypeString, String: filepath.Dir(file)}, nil
+		}
+	}
+	if val, err := JsonGetPath(*s.item, path); err != nil {
+		return NewNull(), fmt.Errorf("variable %s, %v", name, err)
+	} else {
+		return val, nil
+	}
+}
+
+// parseVarOverride reads the text of the command line as the kind of value, which is
+// "number", "boolean" or empty for a string
+func parseVarOverride(text, kind string) (Value, error) {
+	switch kind {
+	case "":
+		return Value{Type: kValueTypeString, String: text}, nil
+	case "number":
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return NewNull(), fmt.Errorf("%s is not a number", text)
+		}
+		return Value{Type: kValueTypeNumber, Number: n}, nil
+	case "boolean", "bool":
+		if text != "true" && text != "false" {
+			return NewNull(), fmt.Errorf("%s is not true or false", text)
+		}
+		return Value{Type: kValueTypeBoolean, Boolean: text == "true"}, nil
+	default:
+		return NewNull(), fmt.Errorf("type %s is unknown, must be number or boolean", kind)
+	}
+}
+
+func (s *varScope) lookup(name string) (Value, error) {
+	if isLoopVar(name) {
+		return s.lookupLoop(name)
+	}
+	if strings.HasPrefix(name, kEnvVarPrefix) {
+		env := strings.TrimPrefix(name, kEnvVarPrefix)
+		if val, ok := os.LookupEnv(env); ok {
+			return Value{Type: kValueTypeString, String: val}, nil
+		}
+		return NewNull(), fmt.Errorf("environment variable %s is not set", env)
+	}
+
+	if x, ok := s.resolved[name]; ok {
+		return x, nil
+	}
+	def, ok := s.defs[name]
+	if !ok {
+		return NewNull(), fmt.Errorf("variable %s is not defined", name)
+	}
+	if s.visiting[name] {
+		return NewNull(), fmt.Errorf("variable %s is defined by itself through other variables", name)
+	}
+	s.visiting[name] = true
+	defer delete(s.visiting, name)
+
+	x, err := s.substitute(def)
+	if err != nil {
+		return NewNull(), fmt.Errorf("variable %s, %v", name, err)
+	}
+	s.resolved[name] = x
+	return x, nil
+}
+
+// substitute replaces the variables in every string of v
+func (s *varScope) substitute(v Value) (Value, error) {
+	switch v.Type {
+	case kValueTypeString:
+		return s.expandString(v)
+
+	case kValueTypeList:
+		list := NewList()
+		for _, x := range v.List.Value {
+			if val, err := s.substitute(x); err != nil {
+				return NewNull(), err
+			} else {
+				list.Value = append(list.Value, val)
+			}
+		}
+		return Value{Type: kValueTypeList, List: list}, nil
+
+	case kValueTypeObject:
+		keys := []string{}
+		for k := range v.Object.Value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		obj := NewObject()
+		for _, k := range keys {
+			if val, err := s.substitute(v.Object.Value[k]); err != nil {
+				return NewNull(), err
+			} else {
+				obj.Value[k] = val
+			}
+		}
+		return Value{Type: kValueTypeObject, Object: obj}, nil
+
+	default:
+		return v, nil
+	}
+}
+
+// expandString replaces the variables of a string value, errors carry the position
+// of the variable when the string comes from the source
+func (s *varScope) expandString(v Value) (Value, error) {
+	text := v.String
+	if !strings.Contains(text, "${") {
+		return v, nil
+	}
+
+	fail := func(offset int, err error) (Value, error) {
+		if v.Line == 0 {
+			return NewNull(), err
+		}
+		return NewNull(), fmt.Errorf("around %d,%d, %v", v.Line, v.Column+1+offset, err)
+	}
+
+	b := strings.Builder{}
+	for i := 0; i < len(text); {
+		if strings.HasPrefix(text[i:], "$${") {
+			if s.deferLoop {
+				b.WriteString("$${")
+			} else {
+				b.WriteString("${")
+			}
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(text[i:], "${") {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(text[i:], '}')
+		if end < 0 {
+			return fail(i, fmt.Errorf("variable is not closed by \"}\""))
+		}
+		name := strings.TrimSpace(text[i+2 : i+end])
+		if name == "" {
+			return fail(i, fmt.Errorf("variable has no name"))
+		}
+		if s.deferLoop && isLoopVar(name) {
+			b.WriteString(text[i : i+end+1])
+			i += end + 1
+			continue
+		}
+
+		val, err := s.lookup(name)
+		if err != nil {
+			return fail(i, err)
+		}
+
+		// the whole string is the variable, so it takes the type of the variable
+		if i == 0 && end == len(text)-1 {
+			return val, nil
+		}
+
+		if text, ok := s.texts[name]; ok {
+			b.WriteString(text)
+			i += end + 1
+			continue
+		}
+
+		switch val.Type {
+		case kValueTypeString:
+			b.WriteString(val.String)
+		case kValueTypeNumber:
+			b.WriteString(strconv.FormatFloat(val.Number, 'f', -1, 64))
+		case kValueTypeBoolean:
+			b.WriteString(strconv.FormatBool(val.Boolean))
+		default:
+			return fail(i, fmt.Errorf("variable %s is type %s, it cannot be put into a string", name,
+				val.Type.GetName()))
+		}
+		i += end + 1
+	}
+
+	ret := v
+	ret.String = b.String()
+	return ret, nil
+}
+
+// substituteExcept replaces the variables of the document except under the keys, ie
+// "Vars" itself is left as is since its variables are resolved when they are used
+func substituteExcept(root Value, scope *varScope, skip ...string) (Value, error) {
+	if root.Type != kValueTypeObject {
+		return scope.substitute(root)
+	}
+
+	keys := []string{}
+	for k := range root.Object.Value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	obj := NewObject()
+	for _, k := range keys {
+		x := root.Object.Value[k]
+		skipped := false
+		for _, key := range skip {
+			skipped = skipped || k == key
+		}
+		if skipped {
+			obj.Value[k] = x
+			continue
+		}
+		if val, err := scope.substitute(x); err != nil {
+			return NewNull(), err
+		} else {
+			obj.Value[k] = val
+		}
+	}
+	return Value{Type: kValueTypeObject, Object: obj}, nil
+}
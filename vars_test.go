@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// substituteVars replaces the variables of the document the way ParseSpec does, the
+// value of its "V" field is returned
+func substituteVars(t *testing.T, doc string, sets map[string]string) (Value, error) {
+	t.Helper()
+	root := mustParseJson(t, doc)
+	scope, err := newVarScope(root, sets)
+	if err != nil {
+		return NewNull(), err
+	}
+	if root, err = substituteExcept(root, scope, "Vars", "vars"); err != nil {
+		return NewNull(), err
+	}
+	return JsonObjectGetMultipleKey(root, "V")
+}
+
+func TestVarsSubstitute(t *testing.T) {
+	t.Setenv("JSONPLOT_TEST_VAR", "from env")
+
+	for _, c := range []struct {
+		doc  string
+		sets map[string]string
+		want string
+	}{
+		{`{"Vars": {"w": 6}, "V": "${w}"}`, nil, `6`},
+		{`{"Vars": {"w": 6}, "V": "${ w }"}`, nil, `6`},
+		{`{"Vars": {"w": 6.5}, "V": "w=${w}px"}`, nil, `"w=6.5px"`},
+		{`{"Vars": {"a": "x", "b": "${a}-y"}, "V": "${b}"}`, nil, `"x-y"`},
+		{`{"Vars": {"on": true}, "V": "${on}"}`, nil, `true`},
+		{`{"Vars": {"on": false}, "V": "is ${on}"}`, nil, `"is false"`},
+		{`{"Vars": {"l": [1, 2]}, "V": "${l}"}`, nil, `[1, 2]`},
+		{`{"Vars": {"w": 6, "a": "x"}, "V": ["${w}", {"k": "${a}${a}"}]}`, nil, `[6, {"k": "xx"}]`},
+		{`{"Vars": {}, "V": "$${w} ${item} ${index}"}`, nil, `"$${w} ${item} ${index}"`},
+		{`{"Vars": {}, "V": "${env:JSONPLOT_TEST_VAR}"}`, nil, `"from env"`},
+		{`{"Vars": {"w": 6}, "V": "${w}"}`, map[string]string{"w": "8"}, `8`},
+		{`{"Vars": {"g": true}, "V": "${g}"}`, map[string]string{"g": "false"}, `false`},
+		{`{"Vars": {"w": "6"}, "V": "${w}"}`, map[string]string{"w": "8"}, `"8"`},
+		{`{"V": "${id}"}`, map[string]string{"id": "0123"}, `"0123"`},
+		{`{"V": "${n}"}`, map[string]string{"n:number": "0123"}, `123`},
+		{`{"V": "id-${n}"}`, map[string]string{"n:number": "0123"}, `"id-0123"`},
+		{`{"V": "${g}"}`, map[string]string{"g:boolean": "true"}, `true`},
+		{`{"V": "${g}"}`, map[string]string{"g:bool": "false"}, `false`},
+		{`{"V": "${url}"}`, map[string]string{"url": "http://host:80"}, `"http://host:80"`},
+	} {
+		got, err := substituteVars(t, c.doc, c.sets)
+		if err != nil {
+			t.Errorf("document %s with %v failed, %v", c.doc, c.sets, err)
+			continue
+		}
+		want := mustParseValue(t, c.want)
+		if !sameJson(got, want) {
+			t.Errorf("document %s with %v got %s, want %s", c.doc, c.sets, got.ToJson(), want.ToJson())
+		}
+	}
+}
+
+func TestVarsSubstituteError(t *testing.T) {
+	for _, c := range []struct {
+		doc  string
+		sets map[string]string
+		msg  string
+	}{
+		{`{"Vars": {}, "V": "ab ${nope}"}`, nil, "around 1,23, variable nope is not defined"},
+		{`{"Vars": {}, "V": "ab ${nope"}`, nil, `around 1,23, variable is not closed by "}"`},
+		{`{"Vars": {}, "V": "${}"}`, nil, "around 1,20, variable has no name"},
+		{"{\"Vars\": {},\n \"V\": [1,\n  \"x ${a}\"]}", nil, "around 3,6, variable a is not defined"},
+		{`{"Vars": {"a": "${b}", "b": "${a}"}, "V": "${a}"}`, nil, "is defined by itself through other variables"},
+		{`{"Vars": {"l": [1]}, "V": "x${l}"}`, nil, "around 1,29, variable l is type list, it cannot be put into a string"},
+		{`{"Vars": {}, "V": "${env:JSONPLOT_TEST_UNSET_VAR}"}`, nil,
+			"around 1,20, environment variable JSONPLOT_TEST_UNSET_VAR is not set"},
+		{`{"Vars": {"env:X": 1}, "V": 1}`, nil, `"Vars" env:X cannot be defined`},
+		{`{"Vars": {"item": 1}, "V": 1}`, nil, `"Vars" item cannot be defined, it is the variable of "ForEach"`},
+		{`{"Vars": {"w": 6}, "V": 1}`, map[string]string{"w": "abc"}, "variable w cannot be set, abc is not a number"},
+		{`{"Vars": {"g": true}, "V": 1}`, map[string]string{"g": "yes"}, "variable g cannot be set, yes is not true or false"},
+		{`{"V": 1}`, map[string]string{"n:number": "NaN"}, "variable n cannot be set, NaN is not a number"},
+		{`{"V": 1}`, map[string]string{"n:float": "1"}, "variable n cannot be set, type float is unknown"},
+		{`{"V": 1}`, map[string]string{"index": "1"}, `variable index cannot be set, it is the variable of "ForEach"`},
+	} {
+		_, err := substituteVars(t, c.doc, c.sets)
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("document %s with %v got error %v, want %q", c.doc, c.sets, err, c.msg)
+		}
+	}
+}
+
+func TestLoopVarsSubstitute(t *testing.T) {
+	record := mustParseJson(t, `{"name": "api", "n": 3, "tags": ["a", "b"]}`)
+	file := Value{Type: kValueTypeString, String: "data/latency.csv"}
+
+	for _, c := range []struct {
+		item *Value
+		text string
+		want string
+	}{
+		{&record, "${item.name}-${index}", `"api-2"`},
+		{&record, "${item.n}", `3`},
+		{&record, "${item.tags.1}", `"b"`},
+		{&record, "${index}", `2`},
+		{&file, "${item}", `"data/latency.csv"`},
+		{&file, "${item.name}", `"latency.csv"`},
+		{&file, "out/${item.stem}.png", `"out/latency.png"`},
+		{&file, "${item.dir}", `"data"`},
+		{&file, "$${item}", `"${item}"`},
+		{nil, "$${x} stays", `"${x} stays"`},
+	} {
+		got, err := newLoopScope(c.item, 2).substitute(Value{Type: kValueTypeString, String: c.text})
+		if err != nil {
+			t.Errorf("text %s failed, %v", c.text, err)
+			continue
+		}
+		want := mustParseValue(t, c.want)
+		if !sameJson(got, want) {
+			t.Errorf("text %s got %s, want %s", c.text, got.ToJson(), want.ToJson())
+		}
+	}
+
+	for _, c := range []struct {
+		item *Value
+		text string
+		msg  string
+	}{
+		{nil, "${item}", `variable item is only defined in a job with "ForEach"`},
+		{nil, "${index}", `variable index is only defined in a job with "ForEach"`},
+		{&record, "${item.missing}", "variable item.missing"},
+		{&record, "x ${item.tags}", "variable item.tags is type list, it cannot be put into a string"},
+	} {
+		_, err := newLoopScope(c.item, 0).substitute(Value{Type: kValueTypeString, String: c.text})
+		if err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("text %s got error %v, want %q", c.text, err, c.msg)
+		}
+	}
+}